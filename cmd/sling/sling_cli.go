@@ -97,6 +97,24 @@ var cliRunFlags = []g.Flag{
 		Type:        "string",
 		Description: "Only run specific streams from a replication. (comma separated)",
 	},
+	{
+		Name:        "retry-failed",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Only run the failed or interrupted streams of the last replication execution, or of the given exec id.",
+	},
+	{
+		Name:        "log-format",
+		ShortName:   "",
+		Type:        "string",
+		Description: "The log output format: text (default) or json (one JSON object per event, also with SLING_LOGGING=json).",
+	},
+	{
+		Name:        "report",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Write a JSON report of the run (per stream results and totals) to this path or file system URL (e.g. report.json).",
+	},
 	{
 		Name:        "stdout",
 		ShortName:   "",
@@ -145,6 +163,24 @@ var cliRunFlags = []g.Flag{
 		Type:        "string",
 		Description: "The update key to use for incremental.\n",
 	},
+	{
+		Name:        "plan",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Print the source query, target DDL and SQL statements for each stream, without moving any rows.",
+	},
+	{
+		Name:        "metrics-addr",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Expose the stream metrics in the Prometheus format at this address (e.g. :9090/metrics).",
+	},
+	{
+		Name:        "metrics-push-url",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Push the stream metrics to this Prometheus Pushgateway URL.",
+	},
 	{
 		Name:        "debug",
 		ShortName:   "d",
@@ -263,6 +299,10 @@ var cliConns = &g.CliSC{
 				},
 			},
 		},
+		{
+			Name:        "encrypt",
+			Description: "encrypt the connection values in the sling env file (with SLING_ENV_KEY or a key file)",
+		},
 		{
 			Name:        "exec",
 			Description: "execute a SQL query on a Database connection",
@@ -285,6 +325,127 @@ var cliConns = &g.CliSC{
 	ExecProcess: processConns,
 }
 
+var cliValidate = &g.CliSC{
+	Name:                  "validate",
+	Description:           "Validate a replication configuration, without running it",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	Flags: []g.Flag{
+		{
+			Name:        "replication",
+			ShortName:   "r",
+			Type:        "string",
+			Description: "The replication config file to use (YAML or JSON).",
+		},
+		{
+			Name:        "json-schema",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Print the JSON Schema of the replication config, for editor autocompletion.",
+		},
+	},
+	ExecProcess: processValidate,
+}
+
+var historyFilterFlags = []g.Flag{
+	{
+		Name:        "stream",
+		ShortName:   "s",
+		Type:        "string",
+		Description: "Filter by stream name (use * as wildcard).",
+	},
+	{
+		Name:        "replication",
+		ShortName:   "r",
+		Type:        "string",
+		Description: "Filter by replication file path or MD5.",
+	},
+	{
+		Name:        "since",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Filter runs started since a date or a duration ago (e.g. 2024-01-01, 12h, 7d).",
+	},
+	{
+		Name:        "until",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Filter runs started before a date or a duration ago (e.g. 2024-02-01, 1d).",
+	},
+}
+
+var cliHistory = &g.CliSC{
+	Name:                  "history",
+	Description:           "List the past executions, from the local .sling.db",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	ExecuteWithoutFlags:   true,
+	Flags: append([]g.Flag{
+		{
+			Name:        "status",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Filter by status (e.g. success, error, interrupted).",
+		},
+		{
+			Name:        "limit",
+			ShortName:   "l",
+			Type:        "string",
+			Description: "The number of executions to show (default 30).",
+		},
+	}, historyFilterFlags...),
+	SubComs: []*g.CliSC{
+		{
+			Name:        "show",
+			Description: "show the output and config of an execution",
+			PosFlags: []g.Flag{
+				{
+					Name:        "exec_id",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The execution ID",
+				},
+			},
+		},
+	},
+	ExecProcess: processHistory,
+}
+
+var cliStats = &g.CliSC{
+	Name:                  "stats",
+	Description:           "Show rows, bytes, duration trends and failure rates per stream, from the local .sling.db",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	ExecuteWithoutFlags:   true,
+	Flags:                 historyFilterFlags,
+	ExecProcess:           processStats,
+}
+
+var cliServe = &g.CliSC{
+	Name:                  "serve",
+	Description:           "Serve a REST API to submit runs, check their status, stream logs and cancel them",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	ExecuteWithoutFlags:   true,
+	Flags: []g.Flag{
+		{
+			Name:        "addr",
+			ShortName:   "a",
+			Type:        "string",
+			Description: "The address to listen on (default 127.0.0.1:8080). Also with SLING_SERVE_ADDR.",
+		},
+		{
+			Name:        "token",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The bearer token required by the API. Also with SLING_SERVE_TOKEN. A random one is generated if not provided.",
+		},
+		{
+			Name:        "queue-size",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The max number of queued runs (default 100).",
+		},
+	},
+	ExecProcess: processServe,
+}
+
 var cliCloud = &g.CliSC{
 	Name:                  "cloud",
 	Singular:              "cloud",
@@ -334,9 +495,13 @@ func init() {
 	// cliAuth.Make().Add()
 	// cliCloud.Make().Add()
 	cliConns.Make().Add()
+	cliHistory.Make().Add()
 	// cliProject.Make().Add()
 	cliRun.Make().Add()
+	cliServe.Make().Add()
+	cliStats.Make().Add()
 	cliUpdate.Make().Add()
+	cliValidate.Make().Add()
 	// cliUi.Make().Add()
 
 	if telemetry {
@@ -410,7 +575,7 @@ func main() {
 	signal.Notify(interrupt, os.Interrupt)
 	signal.Notify(kill, syscall.SIGTERM)
 
-	sling.ShowProgress = os.Getenv("SLING_SHOW_PROGRESS") != "false"
+	sling.ShowProgress = os.Getenv("SLING_SHOW_PROGRESS") != "false" && !env.IsJSONLogging()
 	database.UseBulkExportFlowCSV = cast.ToBool(os.Getenv("SLING_BULK_EXPORT_FLOW_CSV"))
 
 	go func() {
@@ -447,6 +612,19 @@ func main() {
 	}
 }
 
+// setDefaultFlagValue sets the value of a string flag provided without one,
+// such as `--retry-failed` alone, meaning the last execution
+func setDefaultFlagValue(args []string, flag, value string) []string {
+	newArgs := []string{}
+	for i, arg := range args {
+		newArgs = append(newArgs, arg)
+		if arg == flag && (i == len(args)-1 || strings.HasPrefix(args[i+1], "-")) {
+			newArgs = append(newArgs, value)
+		}
+	}
+	return newArgs
+}
+
 func cliInit() int {
 
 	// recover from panic
@@ -468,7 +646,7 @@ func cliInit() int {
 	}
 
 	flaggy.ShowHelpOnUnexpectedDisable()
-	flaggy.Parse()
+	flaggy.ParseArgs(setDefaultFlagValue(os.Args[1:], "--retry-failed", "last"))
 
 	setSentry()
 	ok, err := g.CliProcess()
@@ -492,7 +670,11 @@ func cliInit() int {
 			Track(eventName)
 		}
 
-		g.PrintFatal(err)
+		if env.IsJSONLogging() {
+			g.ZLogErr.Error().Str("error", err.Error()).Msg("fatal")
+		} else {
+			g.PrintFatal(err)
+		}
 		return 1
 	} else if !ok {
 		flaggy.ShowHelp("")
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/slingdata-io/sling-cli/core/store"
+	"github.com/spf13/cast"
+)
+
+func processHistory(c *g.CliSC) (ok bool, err error) {
+	ok = true
+	asJSON := os.Getenv("SLING_OUTPUT") == "json"
+
+	env.SetTelVal("task_start_time", time.Now())
+	defer func() {
+		env.SetTelVal("task_status", lo.Ternary(err != nil, "error", "success"))
+		env.SetTelVal("task_end_time", time.Now())
+	}()
+
+	if c.UsedSC() == "show" {
+		execID := cast.ToString(c.Vals["exec_id"])
+		if execID == "" {
+			flaggy.ShowHelp("")
+			return ok, nil
+		}
+		return ok, showExecution(execID, asJSON)
+	}
+
+	filter, err := getHistoryFilter(c)
+	if err != nil {
+		return ok, err
+	}
+	filter.Status = sling.ExecStatus(cast.ToString(c.Vals["status"]))
+	filter.Limit = lo.Ternary(cast.ToInt(c.Vals["limit"]) > 0, cast.ToInt(c.Vals["limit"]), 30)
+
+	execs, err := store.ListExecutions(filter)
+	if err != nil {
+		return ok, g.Error(err, "could not list executions")
+	}
+
+	if asJSON {
+		fmt.Println(g.Marshal(execs))
+		return ok, nil
+	}
+
+	rows := lo.Map(execs, func(e store.Execution, i int) []any {
+		return []any{
+			e.ExecID, e.Stream, e.Status, formatTime(e.StartTime),
+			formatDuration(e.Duration()), humanize.Comma(cast.ToInt64(e.Rows)),
+			humanize.Bytes(e.Bytes), lo.Ternary(e.Attempts > 1, cast.ToString(e.Attempts), ""),
+		}
+	})
+	fmt.Println(g.PrettyTable([]string{"Exec ID", "Stream", "Status", "Started", "Duration", "Rows", "Bytes", "Attempts"}, rows))
+
+	return ok, nil
+}
+
+// showExecution prints the details, config and output of an execution
+func showExecution(execID string, asJSON bool) (err error) {
+	execs, err := store.GetExecution(execID)
+	if err != nil {
+		return g.Error(err, "could not get execution")
+	}
+
+	if asJSON {
+		fmt.Println(g.Marshal(execs))
+		return nil
+	}
+
+	for _, e := range execs {
+		lines := []string{env.CyanString(g.F("Execution %s | %s", e.ExecID, e.Stream))}
+		add := func(label, value string) {
+			if value = strings.TrimSpace(value); value != "" {
+				lines = append(lines, g.F("%s: %s", env.DarkGrayString(label), value))
+			}
+		}
+
+		add("status", string(e.Status))
+		add("started", formatTime(e.StartTime))
+		add("ended", formatTime(e.EndTime))
+		add("duration", formatDuration(e.Duration()))
+		add("rows", humanize.Comma(cast.ToInt64(e.Rows)))
+		add("bytes", humanize.Bytes(e.Bytes))
+		add("attempts", lo.Ternary(e.Attempts > 0, cast.ToString(e.Attempts), ""))
+		add("retry of", e.RetryOf)
+		add("version", e.Version)
+		if e.FilePath != nil {
+			add("file", *e.FilePath)
+		}
+		if e.Err != nil {
+			add("error", *e.Err)
+		}
+		if e.Task != nil {
+			add("config", "\n"+g.Pretty(e.Task.Task))
+		}
+		add("output", "\n"+e.Output)
+
+		fmt.Println(strings.Join(lines, "\n") + "\n")
+	}
+
+	return nil
+}
+
+func processStats(c *g.CliSC) (ok bool, err error) {
+	ok = true
+	asJSON := os.Getenv("SLING_OUTPUT") == "json"
+
+	env.SetTelVal("task_start_time", time.Now())
+	defer func() {
+		env.SetTelVal("task_status", lo.Ternary(err != nil, "error", "success"))
+		env.SetTelVal("task_end_time", time.Now())
+	}()
+
+	filter, err := getHistoryFilter(c)
+	if err != nil {
+		return ok, err
+	}
+
+	stats, err := store.GetStreamStats(filter)
+	if err != nil {
+		return ok, g.Error(err, "could not get stream stats")
+	}
+
+	if asJSON {
+		fmt.Println(g.Marshal(stats))
+		return ok, nil
+	}
+
+	rows := lo.Map(stats, func(s store.StreamStats, i int) []any {
+		return []any{
+			s.Stream, s.Runs, g.F("%.0f%%", s.FailureRate*100), s.LastStatus,
+			g.F("%s / %s", humanize.Comma(cast.ToInt64(s.LastRows)), humanize.Comma(int64(math.Round(s.AvgRows)))),
+			g.F("%s / %s", humanize.Bytes(s.LastBytes), humanize.Bytes(uint64(s.AvgBytes))),
+			g.F("%s / %s", formatDuration(s.LastDuration), formatDuration(s.AvgDuration)),
+			sparkline(s.Durations),
+		}
+	})
+	fmt.Println(g.PrettyTable([]string{"Stream", "Runs", "Failure Rate", "Last Status", "Rows (last / avg)", "Bytes (last / avg)", "Duration (last / avg)", "Duration Trend"}, rows))
+
+	return ok, nil
+}
+
+// getHistoryFilter returns the filter from the stream, replication,
+// since and until flags
+func getHistoryFilter(c *g.CliSC) (filter store.HistoryFilter, err error) {
+	filter.Stream = cast.ToString(c.Vals["stream"])
+	filter.Replication = cast.ToString(c.Vals["replication"])
+
+	if val := cast.ToString(c.Vals["since"]); val != "" {
+		since, err := parseTimeAgo(val)
+		if err != nil {
+			return filter, g.Error(err, "invalid value for --since: %s", val)
+		}
+		filter.Since = &since
+	}
+
+	if val := cast.ToString(c.Vals["until"]); val != "" {
+		until, err := parseTimeAgo(val)
+		if err != nil {
+			return filter, g.Error(err, "invalid value for --until: %s", val)
+		}
+		filter.Until = &until
+	}
+
+	return
+}
+
+// parseTimeAgo parses a date, or a duration ago such as `12h` or `7d`
+func parseTimeAgo(val string) (t time.Time, err error) {
+	if days, err := cast.ToIntE(strings.TrimSuffix(val, "d")); err == nil && strings.HasSuffix(val, "d") {
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+
+	if duration, err := time.ParseDuration(val); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	return cast.ToTimeE(val)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatDuration(secs float64) string {
+	return (time.Duration(secs*1000) * time.Millisecond).Round(time.Second).String()
+}
+
+// sparkline returns the values as a line of bars
+func sparkline(values []float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	if len(values) == 0 {
+		return ""
+	}
+
+	min, max := lo.Min(values), lo.Max(values)
+	line := make([]rune, len(values))
+	for i, val := range values {
+		index := 0
+		if max > min {
+			index = int(math.Round((val - min) / (max - min) * float64(len(bars)-1)))
+		}
+		line[i] = bars[index]
+	}
+	return string(line)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -27,12 +28,21 @@ import (
 
 	"github.com/flarco/g"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
 	projectID     = os.Getenv("SLING_PROJECT_ID")
 	updateMessage = ""
 	updateVersion = ""
+	planOnly      = false
+
+	// replicationTraceCtx holds the span of the running replication,
+	// parent of the stream spans
+	replicationTraceCtx context.Context
+
+	// runReport collects the stream results, when using --report
+	runReport *sling.RunReport
 )
 
 func init() {
@@ -47,6 +57,10 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 	taskCfgStr := ""
 	showExamples := false
 	selectStreams := []string{}
+	retryFailed := ""
+	reportURL := ""
+	metricsAddr := os.Getenv("SLING_METRICS_ADDR")
+	metricsPushURL := os.Getenv("SLING_METRICS_PUSH_URL")
 	iterate := 1
 	itNumber := 1
 
@@ -162,6 +176,28 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 			cfg.Source.Select = strings.Split(cast.ToString(v), ",")
 		case "streams":
 			selectStreams = strings.Split(cast.ToString(v), ",")
+		case "retry-failed":
+			retryFailed = cast.ToString(v)
+		case "report":
+			reportURL = cast.ToString(v)
+		case "log-format":
+			switch format := strings.ToLower(cast.ToString(v)); format {
+			case "json":
+				os.Setenv("SLING_LOGGING", "JSON")
+			case "text":
+				if env.IsJSONLogging() {
+					os.Unsetenv("SLING_LOGGING") // overrides SLING_LOGGING=json
+					env.NoColor = false
+				}
+			default:
+				return ok, g.Error("invalid log format: %s. Expecting text or json", format)
+			}
+			env.SetLogger()
+			sling.ShowProgress = os.Getenv("SLING_SHOW_PROGRESS") != "false" && !env.IsJSONLogging()
+		case "metrics-addr":
+			metricsAddr = cast.ToString(v)
+		case "metrics-push-url":
+			metricsPushURL = cast.ToString(v)
 		case "debug":
 			cfg.Options.Debug = cast.ToBool(v)
 			if cfg.Options.Debug && os.Getenv("DEBUG") == "" {
@@ -170,6 +206,8 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 			}
 		case "examples":
 			showExamples = cast.ToBool(v)
+		case "plan":
+			planOnly = cast.ToBool(v)
 		}
 	}
 
@@ -182,6 +220,33 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 		return ok, g.Error("cannot provide replication and task configuration. Choose one.")
 	}
 
+	if retryFailed != "" {
+		if replicationCfgPath == "" {
+			return ok, g.Error("must provide a replication (-r) with --retry-failed")
+		} else if len(selectStreams) > 0 {
+			return ok, g.Error("cannot use --streams with --retry-failed")
+		}
+
+		replication, err := sling.LoadReplicationConfig(replicationCfgPath)
+		if err != nil {
+			return ok, g.Error(err, "Error parsing replication config")
+		} else if err = replication.ProcessWildcards(); err != nil {
+			return ok, g.Error(err, "could not process streams using wildcard")
+		}
+
+		execID := lo.Ternary(retryFailed == "last", "", retryFailed)
+		execID, selectStreams, err = store.GetFailedStreams(execID, replicationCfgPath, replication)
+		if err != nil {
+			return ok, g.Error(err, "could not get failed streams to retry")
+		} else if len(selectStreams) == 0 {
+			g.Info("no failed streams to retry in execution %s", execID)
+			return ok, nil
+		}
+
+		g.Info("retrying %d failed stream(s) of execution %s", len(selectStreams), execID)
+		os.Setenv("SLING_RETRY_OF", execID)
+	}
+
 	os.Setenv("SLING_CLI", "TRUE")
 	os.Setenv("SLING_CLI_ARGS", g.Marshal(os.Args[1:]))
 	if os.Getenv("SLING_EXEC_ID") == "" {
@@ -189,14 +254,44 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 		os.Setenv("SLING_EXEC_ID", sling.NewExecID())
 	}
 
+	// expose / push metrics
+	stopMetrics, err := startMetrics(metricsAddr, metricsPushURL)
+	if err != nil {
+		return ok, g.Error(err, "could not start metrics")
+	}
+	defer stopMetrics()
+
+	// export traces, if OTEL_EXPORTER_OTLP_ENDPOINT is set
+	stopTracing, err := sling.InitTracing(ctx.Ctx)
+	if err != nil {
+		return ok, g.Error(err, "could not start tracing")
+	}
+	defer stopTracing()
+
+	// write the run report at the end, even if failed
+	if reportURL != "" {
+		runReport = sling.NewRunReport(os.Getenv("SLING_EXEC_ID"))
+		defer func() {
+			runReport.Finish(err)
+			if wErr := runReport.Write(reportURL); wErr != nil {
+				g.LogError(wErr, "could not write run report")
+			} else {
+				g.Info("wrote run report to %s", reportURL)
+			}
+			runReport = nil
+		}()
+	}
+
 	// check for update, and print note
 	go checkUpdate(false)
 	defer printUpdateAvailable()
 
+	state := &runState{execID: os.Getenv("SLING_EXEC_ID"), ctx: &ctx}
+
 	for {
 		if replicationCfgPath != "" {
 			//  run replication
-			err = runReplication(replicationCfgPath, cfg, selectStreams...)
+			err = runReplication(replicationCfgPath, cfg, state, selectStreams...)
 			if err != nil {
 				return ok, g.Error(err, "failure running replication (see docs @ https://docs.slingdata.io/sling-cli)")
 			}
@@ -221,7 +316,7 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 				continue // run replication
 			}
 
-			err = runTask(cfg, nil)
+			err = runTask(cfg, nil, state)
 			if err != nil {
 				return ok, g.Error(err, "failure running task (see docs @ https://docs.slingdata.io/sling-cli)")
 			}
@@ -232,14 +327,26 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 
 		itNumber++
 		time.Sleep(1 * time.Second) // sleep for one second
-		println()
+		env.Println("")
 		g.Info("Iteration #%d", itNumber)
 	}
 
 	return ok, nil
 }
 
-func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error) {
+// runState is the state of a run, such as of a job of sling serve
+type runState struct {
+	execID  string
+	ctx     *g.Context
+	secrets *connection.SecretCache // the secrets of the run (the process cache if nil)
+}
+
+// logFields returns the fields of the JSON log events between the tasks
+func (state *runState) logFields() map[string]any {
+	return g.M("exec_id", state.execID)
+}
+
+func runTask(cfg *sling.Config, replication *sling.ReplicationConfig, state *runState) (err error) {
 	var task *sling.TaskExecution
 
 	taskMap := g.M()
@@ -266,6 +373,7 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 			taskOptions["tgt_add_new_columns"] = task.Config.Target.Options.AddNewColumns
 			taskOptions["tgt_adjust_column_type"] = task.Config.Target.Options.AdjustColumnType
 			taskOptions["tgt_column_casing"] = task.Config.Target.Options.ColumnCasing
+			taskOptions["tgt_on_row_error"] = task.Config.Target.Options.OnRowError
 
 			taskMap["md5"] = task.Config.MD5()
 			taskMap["type"] = task.Type
@@ -333,6 +441,15 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 		Track("run")
 	}()
 
+	// add to the run report, unless only planning
+	addToReport := runReport != nil
+	defer func() {
+		if addToReport {
+			runReport.AddStream(cfg, task, err)
+		}
+	}()
+
+	cfg.SetSecretCache(state.secrets)
 	err = cfg.Prepare()
 	if err != nil {
 		err = g.Error(err, "could not set task configuration")
@@ -344,17 +461,30 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 	cfg.Env["SLING_PROJECT_ID"] = projectID
 
 	// set logging
-	if val := cfg.Env["SLING_LOGGING"]; val != "" {
+	if val := cfg.Env["SLING_LOGGING"]; val != "" && val != os.Getenv("SLING_LOGGING") {
 		os.Setenv("SLING_LOGGING", val)
+		env.SetLogger()
+		sling.ShowProgress = sling.ShowProgress && !env.IsJSONLogging()
 	}
 
-	task = sling.NewTask(os.Getenv("SLING_EXEC_ID"), cfg)
+	task = sling.NewTask(state.execID, cfg)
 	task.Replication = replication
+	task.Reported = addToReport
+
+	// add the exec_id, stream, stage and rows to the JSON log events
+	env.SetLogFields(task.LogFields)
+	defer env.SetLogFields(state.logFields)
 
 	if cast.ToBool(cfg.Env["SLING_DRY_RUN"]) || cast.ToBool(os.Getenv("SLING_DRY_RUN")) {
+		addToReport = false
 		return nil
 	}
 
+	if planOnly {
+		addToReport = false
+		return printPlan(task, state)
+	}
+
 	// insert into store for history keeping
 	sling.StoreInsert(task)
 
@@ -364,7 +494,10 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 	}
 
 	// set context
-	task.Context = &ctx
+	task.Context = state.ctx
+	if replication != nil {
+		task.TraceCtx = replicationTraceCtx
+	}
 
 	// run task
 	setTM()
@@ -376,7 +509,23 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 	return nil
 }
 
-func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ...string) (err error) {
+// printPlan prints the plan of the task, without moving any rows
+func printPlan(task *sling.TaskExecution, state *runState) (err error) {
+	task.Context = state.ctx
+	plan, err := task.Plan()
+	if err != nil {
+		return g.Error(err, "could not build plan")
+	}
+
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		fmt.Println(g.Marshal(plan))
+	} else {
+		fmt.Println(plan.Pretty())
+	}
+	return nil
+}
+
+func runReplication(cfgPath string, cfgOverwrite *sling.Config, state *runState, selectStreams ...string) (err error) {
 	startTime := time.Now()
 
 	replication, err := sling.LoadReplicationConfig(cfgPath)
@@ -414,11 +563,28 @@ func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 	streamsOrdered := replication.StreamsOrdered()
 	eG := g.ErrorGroup{}
 	succcess := 0
+
+	traceCtx, span := sling.StartSpan(sling.TraceParentContext(state.ctx.Ctx), "replication",
+		attribute.String("sling.exec_id", state.execID),
+		attribute.String("sling.replication", cfgPath),
+		attribute.String("sling.source", replication.Source),
+		attribute.String("sling.target", replication.Target),
+		attribute.Int("sling.streams", streamCnt),
+	)
+	replicationTraceCtx = traceCtx
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("sling.successes", succcess),
+			attribute.Int("sling.failures", len(eG.Errors)),
+		)
+		sling.EndSpan(span, err)
+		replicationTraceCtx = nil
+	}()
 	errors := make([]error, len(streamsOrdered))
 
 	counter := 0
 	for i, name := range streamsOrdered {
-		if interrupted {
+		if interrupted || state.ctx.Ctx.Err() != nil {
 			break
 		}
 
@@ -455,33 +621,9 @@ func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 			}
 		}
 
-		cfg := sling.Config{
-			Source: sling.Source{
-				Conn:        replication.Source,
-				Stream:      name,
-				Select:      stream.Select,
-				PrimaryKeyI: stream.PrimaryKey(),
-				UpdateKey:   stream.UpdateKey,
-			},
-			Target: sling.Target{
-				Conn:   replication.Target,
-				Object: stream.Object,
-			},
-			Mode:            stream.Mode,
-			ReplicationMode: true,
-			Env:             g.ToMapString(replication.Env),
-			StreamName:      name,
-		}
-
-		// so that the next stream does not retain previous pointer values
-		g.Unmarshal(g.Marshal(stream.SourceOptions), &cfg.Source.Options)
-		g.Unmarshal(g.Marshal(stream.TargetOptions), &cfg.Target.Options)
-
-		if stream.SQL != "" {
-			cfg.Source.Stream = stream.SQL
-		}
+		cfg := replication.StreamConfig(name, stream)
 
-		println()
+		env.Println("")
 
 		if stream.Disabled {
 			g.Debug("[%d / %d] skipping stream %s since it is disabled", counter, streamCnt, name)
@@ -492,9 +634,13 @@ func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 
 		env.TelMap = g.M("begin_time", time.Now().UnixMicro(), "run_mode", "replication") // reset map
 		env.SetTelVal("replication_md5", replication.MD5())
-		err = runTask(&cfg, &replication)
+		err = runTask(&cfg, &replication, state)
 		if err != nil {
-			g.Info(env.RedString(err.Error()))
+			if env.IsJSONLogging() {
+				g.ZLogErr.Error().Str("stream", name).Str("error", err.Error()).Msg("stream failed")
+			} else {
+				g.Info(env.RedString(err.Error()))
+			}
 			if eh := sling.ErrorHelper(err); eh != "" {
 				env.Println("")
 				env.Println(env.MagentaString(eh))
@@ -508,7 +654,7 @@ func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		}
 	}
 
-	println()
+	env.Println("")
 	delta := time.Since(startTime)
 
 	successStr := env.GreenString(g.F("%d Successes", succcess))
@@ -521,6 +667,12 @@ func runReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 
 	g.Info("Sling Replication Completed in %s | %s -> %s | %s | %s\n", g.DurationString(delta), replication.Source, replication.Target, successStr, failureStr)
 
+	if runReport != nil {
+		runReport.Replication = cfgPath
+		runReport.Source = replication.Source
+		runReport.Target = replication.Target
+	}
+
 	return eG.Err()
 }
 
@@ -569,6 +721,12 @@ func processConns(c *g.CliSC) (ok bool, err error) {
 			return ok, g.Error(err, "could not set %s (See https://docs.slingdata.io/sling-cli/environment)", name)
 		}
 		g.Info("connection `%s` has been set in %s. Please test with `sling conns test %s`", name, ec.EnvFile.Path, name)
+	case "encrypt":
+		err := ec.Encrypt()
+		if err != nil {
+			return ok, g.Error(err, "could not encrypt %s", ec.EnvFile.Path)
+		}
+		g.Info("connections in %s have been encrypted", ec.EnvFile.Path)
 	case "exec":
 		env.SetTelVal("task", g.Marshal(g.M("type", sling.ConnExec)))
 
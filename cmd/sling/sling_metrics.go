@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// startMetrics exposes the stream metrics at the address (host:port/path)
+// and pushes them to the Pushgateway URL periodically, if provided.
+// The returned function pushes the final values and stops.
+func startMetrics(addr, pushURL string) (stop func(), err error) {
+	stop = func() {}
+
+	if addr != "" {
+		path := "/metrics"
+		if i := strings.Index(addr, "/"); i > -1 {
+			addr, path = addr[:i], addr[i:]
+		}
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return stop, g.Error(err, "could not listen on %s", addr)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(path, sling.MetricsHandler())
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go server.Serve(listener)
+
+		g.Debug("serving metrics on http://%s%s", listener.Addr().String(), path)
+		stop = func() { server.Close() }
+	}
+
+	if pushURL != "" {
+		interval := 15 * time.Second
+		if val := cast.ToInt(os.Getenv("SLING_METRICS_PUSH_INTERVAL")); val > 0 {
+			interval = time.Duration(val) * time.Second
+		}
+
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := sling.PushMetrics(pushURL); err != nil {
+						g.Warn(err.Error())
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		stopServer := stop
+		stop = func() {
+			close(done)
+			if err := sling.PushMetrics(pushURL); err != nil {
+				g.Warn(err.Error())
+			}
+			stopServer()
+		}
+	}
+
+	return stop, nil
+}
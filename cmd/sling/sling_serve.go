@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	dbioEnv "github.com/slingdata-io/sling-cli/core/dbio/env"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/slingdata-io/sling-cli/core/store"
+	"github.com/spf13/cast"
+)
+
+// slingServer serves the REST API of `sling serve`. The submitted runs are
+// queued in the local .sling.db and executed one at a time.
+type slingServer struct {
+	token     string
+	queueSize int
+	wake      chan struct{}
+
+	mux     sync.Mutex
+	running *store.Job // the job being executed
+	output  []byte     // the output of the running job, up to maxJobOutput
+	cancel  func()     // cancels the context of the running job
+}
+
+// maxJobOutput is the maximum size of the output kept for a run
+const maxJobOutput = 5 * 1024 * 1024
+
+// runRequest is the body to submit a run. Either the task or the
+// replication config is provided, as an object or a YAML / JSON string.
+type runRequest struct {
+	Task        any      `json:"task"`
+	Replication any      `json:"replication"`
+	Streams     []string `json:"streams"`
+}
+
+func processServe(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if store.Db == nil {
+		return ok, g.Error("local .sling.db is not available, it is required to queue the runs")
+	}
+
+	addr := lo.Ternary(os.Getenv("SLING_SERVE_ADDR") != "", os.Getenv("SLING_SERVE_ADDR"), "127.0.0.1:8080")
+	if val := cast.ToString(c.Vals["addr"]); val != "" {
+		addr = val
+	}
+
+	s := &slingServer{
+		token:     lo.Ternary(cast.ToString(c.Vals["token"]) != "", cast.ToString(c.Vals["token"]), os.Getenv("SLING_SERVE_TOKEN")),
+		queueSize: 100,
+		wake:      make(chan struct{}, 1),
+	}
+	if val := cast.ToInt(c.Vals["queue-size"]); val > 0 {
+		s.queueSize = val
+	}
+	if s.token == "" {
+		s.token, err = newServeToken()
+		if err != nil {
+			return ok, g.Error(err, "could not generate token")
+		}
+		g.Info("no token provided, using generated token: %s", s.token)
+	}
+
+	// jobs left running by a previous server cannot be resumed
+	if err = store.InterruptRunningJobs(); err != nil {
+		return ok, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return ok, g.Error(err, "could not listen on %s", addr)
+	}
+
+	go s.work()
+
+	g.Info("Sling API listening on http://%s", listener.Addr().String())
+	server := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	if err = server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return ok, g.Error(err, "could not serve API")
+	}
+
+	return ok, nil
+}
+
+func newServeToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *slingServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, g.M("status", "ok", "version", core.Version))
+	})
+	mux.HandleFunc("/api/v1/runs", s.authorize(s.handleRuns))
+	mux.HandleFunc("/api/v1/runs/", s.authorize(s.handleRun))
+	mux.HandleFunc("/api/v1/connections", s.authorize(s.handleConnections))
+	mux.HandleFunc("/api/v1/connections/", s.authorize(s.handleDiscover))
+	return mux
+}
+
+// authorize requires the bearer token
+func (s *slingServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, g.Error("invalid or missing bearer token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(g.Marshal(value)))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, g.M("error", g.ErrMsgSimple(err)))
+}
+
+// handleRuns lists the runs (GET) or submits one (POST)
+func (s *slingServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := 30
+		if val := cast.ToInt(r.URL.Query().Get("limit")); val > 0 {
+			limit = val
+		}
+
+		jobs, err := store.ListJobs(sling.ExecStatus(r.URL.Query().Get("status")), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, g.M("runs", jobs))
+
+	case http.MethodPost:
+		req := runRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, g.Error(err, "could not parse request body"))
+			return
+		}
+
+		job, err := newJob(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err = store.InsertJob(job, s.queueSize); err != nil {
+			writeError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+
+		writeJSON(w, http.StatusAccepted, job)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, g.Error("method %s not allowed", r.Method))
+	}
+}
+
+// newJob validates the submitted config and returns the job to queue
+func newJob(req runRequest) (job *store.Job, err error) {
+	configString := func(value any) string {
+		if str, ok := value.(string); ok {
+			return str
+		}
+		return g.Marshal(value)
+	}
+
+	job = &store.Job{ExecID: sling.NewExecID(), Streams: req.Streams}
+	switch {
+	case req.Task != nil && req.Replication != nil:
+		return nil, g.Error("provide either a task or a replication, not both")
+	case req.Replication != nil:
+		job.Type = store.JobTypeReplication
+		job.Config = configString(req.Replication)
+		if _, err = sling.UnmarshalReplication(job.Config); err != nil {
+			return nil, g.Error(err, "invalid replication config")
+		}
+	case req.Task != nil:
+		job.Type = store.JobTypeTask
+		job.Config = configString(req.Task)
+		if err = (&sling.Config{}).UnmarshalInline(job.Config); err != nil {
+			return nil, g.Error(err, "invalid task config")
+		}
+		if len(req.Streams) > 0 {
+			return nil, g.Error("streams can only be selected for a replication")
+		}
+	default:
+		return nil, g.Error("provide a task or a replication config")
+	}
+
+	// the configs cannot read the files or run commands of the server
+	if refs := connection.LocalSecretRefs(job.Config); len(refs) > 0 {
+		return nil, g.Error("secret references with the file or cmd providers are not allowed in a submitted config: %s", strings.Join(refs, ", "))
+	}
+
+	return job, nil
+}
+
+// handleRun returns the status of a run (GET /runs/{exec_id}), streams its
+// logs (GET /runs/{exec_id}/logs) or cancels it (POST /runs/{exec_id}/cancel)
+func (s *slingServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/runs/"), "/")
+	execID, action := parts[0], ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		job, err := s.getJob(execID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+
+		// the executions (one per stream) do not exist until started
+		execs, _ := store.GetExecution(execID)
+		writeJSON(w, http.StatusOK, g.M("run", job, "executions", lo.Ternary(execs == nil, []store.Execution{}, execs)))
+
+	case r.Method == http.MethodGet && action == "logs":
+		s.streamLogs(w, r, execID)
+
+	case r.Method == http.MethodPost && action == "cancel":
+		s.cancelJob(w, execID)
+
+	default:
+		writeError(w, http.StatusNotFound, g.Error("route not found"))
+	}
+}
+
+// getJob returns the job, from memory if running
+func (s *slingServer) getJob(execID string) (job *store.Job, err error) {
+	s.mux.Lock()
+	if s.running != nil && s.running.ExecID == execID {
+		job := *s.running
+		job.Output = string(s.output)
+		s.mux.Unlock()
+		return &job, nil
+	}
+	s.mux.Unlock()
+
+	return store.GetJob(execID)
+}
+
+// streamLogs writes the output of the run. With `?follow=true`, it keeps
+// writing the new output until the run ends.
+func (s *slingServer) streamLogs(w http.ResponseWriter, r *http.Request, execID string) {
+	follow := cast.ToBool(r.URL.Query().Get("follow"))
+	flusher, _ := w.(http.Flusher)
+
+	offset := 0
+	for i := 0; ; i++ {
+		job, err := s.getJob(execID)
+		if err != nil {
+			if i == 0 {
+				writeError(w, http.StatusNotFound, err)
+			}
+			return
+		}
+
+		if i == 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+		}
+
+		if len(job.Output) > offset {
+			w.Write([]byte(job.Output[offset:]))
+			offset = len(job.Output)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if !follow || job.Status.IsFinished() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// cancelJob removes a queued run from the queue, or cancels the context of
+// the running one, which interrupts the task execution
+func (s *slingServer) cancelJob(w http.ResponseWriter, execID string) {
+	s.mux.Lock()
+	if s.running != nil && s.running.ExecID == execID {
+		s.cancel()
+		s.mux.Unlock()
+		writeJSON(w, http.StatusAccepted, g.M("exec_id", execID, "status", "cancelling"))
+		return
+	}
+	s.mux.Unlock()
+
+	ok, err := store.CancelJob(execID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	} else if !ok {
+		if _, err = store.GetJob(execID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+		} else {
+			writeError(w, http.StatusConflict, g.Error("run %s is not queued or running", execID))
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, g.M("exec_id", execID, "status", sling.ExecStatusTerminated))
+}
+
+// handleConnections lists the connections, without their credentials
+func (s *slingServer) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, g.Error("method %s not allowed", r.Method))
+		return
+	}
+
+	conns := lo.Map(connection.GetLocalConns(true), func(conn connection.ConnEntry, i int) map[string]any {
+		return g.M(
+			"name", conn.Name,
+			"type", conn.Connection.Type,
+			"description", conn.Description,
+			"source", conn.Source,
+		)
+	})
+	writeJSON(w, http.StatusOK, g.M("connections", conns))
+}
+
+// handleDiscover lists the streams (tables or files) of a connection,
+// at GET /connections/{name}/streams?pattern=&columns=&recursive=
+func (s *slingServer) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/connections/"), "/")
+	if r.Method != http.MethodGet || len(parts) != 2 || parts[1] != "streams" {
+		writeError(w, http.StatusNotFound, g.Error("route not found"))
+		return
+	}
+
+	ef := env.LoadSlingEnvFile()
+	ec := connection.EnvConns{EnvFile: &ef}
+	name := parts[0]
+	if _, ok := ec.GetConnEntry(name); !ok {
+		writeError(w, http.StatusNotFound, g.Error("did not find connection %s", name))
+		return
+	}
+
+	query := r.URL.Query()
+	opt := &connection.DiscoverOptions{
+		Pattern:     query.Get("pattern"),
+		ColumnLevel: cast.ToBool(query.Get("columns")),
+		Recursive:   cast.ToBool(query.Get("recursive")),
+	}
+
+	files, schemata, err := ec.Discover(name, opt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, g.Error(err, "could not discover %s", name))
+		return
+	}
+
+	switch {
+	case opt.ColumnLevel && len(schemata.Tables()) > 0:
+		writeJSON(w, http.StatusOK, g.M("columns", iop.Columns(lo.Values(schemata.Columns()))))
+	case opt.ColumnLevel:
+		writeJSON(w, http.StatusOK, g.M("columns", iop.Columns(lo.Values(files.Columns()))))
+	case len(schemata.Tables()) > 0:
+		tables := lo.Map(lo.Values(schemata.Tables()), func(table database.Table, i int) map[string]any {
+			return g.M(
+				"schema", table.Schema,
+				"name", table.Name,
+				"type", lo.Ternary(table.IsView, "view", "table"),
+				"columns", len(table.Columns),
+			)
+		})
+		writeJSON(w, http.StatusOK, g.M("tables", tables))
+	default:
+		files.Sort()
+		writeJSON(w, http.StatusOK, g.M("files", files))
+	}
+}
+
+// work executes the queued jobs, one at a time
+func (s *slingServer) work() {
+	for {
+		job, err := store.NextJob()
+		if err != nil {
+			g.Warn(err.Error())
+		} else if job != nil {
+			s.runJob(job)
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// runJob executes the job, capturing its output
+func (s *slingServer) runJob(job *store.Job) {
+	// secrets are resolved again for each run
+	jobCtx := g.NewContext(context.Background())
+	state := &runState{execID: job.ExecID, ctx: &jobCtx, secrets: connection.NewSecretCache()}
+
+	s.mux.Lock()
+	s.running, s.cancel, s.output = job, jobCtx.Cancel, nil
+	s.mux.Unlock()
+
+	env.SetLogSink(s.appendOutput)
+	env.SetLogFields(state.logFields)
+
+	g.Info("starting run %s (%s)", job.ExecID, job.Type)
+	err := s.execute(job, state)
+	if err != nil {
+		g.Info(env.RedString(err.Error()))
+	}
+
+	time.Sleep(100 * time.Millisecond) // so logger can flush
+	env.SetLogFields(nil)
+	env.SetLogSink(nil)
+
+	s.mux.Lock()
+	now := time.Now()
+	job.EndTime = &now
+	switch {
+	case jobCtx.Ctx.Err() != nil:
+		job.Status = sling.ExecStatusTerminated
+	case err != nil:
+		job.Status = sling.ExecStatusError
+	default:
+		job.Status = sling.ExecStatusSuccess
+	}
+	if err != nil {
+		job.Err = g.String(g.ErrMsgSimple(err))
+	}
+	job.Output = string(s.output)
+	s.running, s.cancel, s.output = nil, nil, nil
+	s.mux.Unlock()
+	jobCtx.Cancel()
+
+	if err = store.UpdateJob(job); err != nil {
+		g.Warn(err.Error())
+	}
+}
+
+// appendOutput adds the log output to the running job. Once the output
+// reaches maxJobOutput, the rest is dropped.
+func (s *slingServer) appendOutput(text string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.running == nil || len(s.output) >= maxJobOutput {
+		return
+	}
+
+	const truncated = "\n... output truncated\n"
+	if len(s.output)+len(text) > maxJobOutput-len(truncated) {
+		text = text[:max(0, maxJobOutput-len(truncated)-len(s.output))] + truncated
+	}
+	s.output = append(s.output, text...)
+}
+
+// execute runs the task or replication of the job
+func (s *slingServer) execute(job *store.Job, state *runState) (err error) {
+	runReplicationConfig := func(content string) error {
+		cfgPath := path.Join(dbioEnv.GetTempFolder(), job.ExecID+".replication.yaml")
+		if err := os.WriteFile(cfgPath, []byte(content), 0600); err != nil {
+			return g.Error(err, "could not write temp replication: %s", cfgPath)
+		}
+		defer os.Remove(cfgPath)
+		return runReplication(cfgPath, nil, state, job.Streams...)
+	}
+
+	switch job.Type {
+	case store.JobTypeReplication:
+		return runReplicationConfig(job.Config)
+	case store.JobTypeTask:
+		cfg := &sling.Config{}
+		if err = cfg.UnmarshalInline(job.Config); err != nil {
+			return g.Error(err, "could not parse task configuration")
+		}
+
+		// run as replication if stream is wildcard
+		if cfg.HasWildcard() {
+			return runReplicationConfig(g.Marshal(cfg.AsReplication()))
+		}
+		return runTask(cfg, nil, state)
+	}
+
+	return g.Error("invalid job type: %s", job.Type)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+func processValidate(c *g.CliSC) (ok bool, err error) {
+	ok = true
+	asJSON := os.Getenv("SLING_OUTPUT") == "json"
+
+	if cast.ToBool(c.Vals["json-schema"]) {
+		fmt.Println(g.Pretty(sling.ReplicationJSONSchema()))
+		return ok, nil
+	}
+
+	cfgPath := cast.ToString(c.Vals["replication"])
+	if cfgPath == "" {
+		flaggy.ShowHelp("")
+		return ok, nil
+	}
+
+	env.SetTelVal("task_start_time", time.Now())
+	defer func() {
+		env.SetTelVal("task_status", lo.Ternary(err != nil, "error", "success"))
+		env.SetTelVal("task_end_time", time.Now())
+	}()
+
+	cfgBytes, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return ok, g.Error(err, "could not read replication config: %s", cfgPath)
+	}
+
+	issues, err := sling.ValidateReplication(string(cfgBytes))
+	if err != nil {
+		return ok, g.Error(err, "could not validate replication config: %s", cfgPath)
+	}
+
+	if asJSON {
+		fmt.Println(g.Marshal(g.M("valid", len(issues) == 0, "issues", issues)))
+	} else if len(issues) > 0 {
+		rows := lo.Map(issues, func(vi sling.ValidationIssue, i int) []any {
+			return []any{vi.Stream, vi.Key, vi.Message}
+		})
+		fmt.Println(g.PrettyTable([]string{"Stream", "Key", "Issue"}, rows))
+	}
+
+	if len(issues) > 0 {
+		return ok, g.Error("replication config %s has %d issue(s)", cfgPath, len(issues))
+	}
+
+	g.Info("replication config %s is valid", cfgPath)
+	return ok, nil
+}
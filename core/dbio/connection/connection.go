@@ -17,6 +17,7 @@ import (
 	"github.com/flarco/g"
 	"github.com/flarco/g/net"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/env"
 	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
 	"github.com/spf13/cast"
 )
@@ -50,6 +51,9 @@ type Connection struct {
 	Type    dbio.Type              `json:"type,omitempty"`
 	Data    map[string]interface{} `json:"data,omitempty"`
 	context *g.Context             `json:"-"`
+
+	// unresolved is true while the data has secret references (see Resolve)
+	unresolved bool
 }
 
 // NewConnection creates a new connection
@@ -91,7 +95,7 @@ func NewConnectionFromMap(m map[string]interface{}) (c Connection, err error) {
 	c, err = NewConnection(
 		name,
 		dbio.Type(Type),
-		g.AsMap(m["data"]),
+		data,
 	)
 
 	if c.Type == "" {
@@ -239,7 +243,41 @@ func (c *Connection) URL() string {
 	return url
 }
 
+// Resolve replaces the secret references of the data, such as
+// ${secret:vault:kv/data/pg#password}, with their values. It is done
+// when the connection is used, so that the secrets of unrelated
+// connections are not fetched. The values are cached in the process cache
+func (c *Connection) Resolve() (err error) {
+	return c.ResolveWith(nil)
+}
+
+// ResolveWith resolves the secret references with the cache, such as
+// a cache for the duration of a run (the process cache if nil)
+func (c *Connection) ResolveWith(cache *SecretCache) (err error) {
+	if env.HasEncrypted(c.Data) {
+		return g.Error("the values of connection %s could not be decrypted (check SLING_ENV_KEY or the key file)", c.Name)
+	} else if !c.unresolved {
+		return nil
+	} else if cache == nil {
+		cache = secretCache
+	}
+
+	data, err := cache.resolveSecrets(c.Data)
+	if err != nil {
+		return g.Error(err, "could not resolve secrets for connection %s", c.Name)
+	}
+	for k, v := range data {
+		c.Data[k] = v
+	}
+	c.unresolved = false
+
+	return c.setURL()
+}
+
 func (c *Connection) AsDatabase() (database.Connection, error) {
+	if err := c.Resolve(); err != nil {
+		return nil, err
+	}
 	if !c.Type.IsDb() {
 		return nil, g.Error("not a database type: %s", c.Type)
 	}
@@ -249,6 +287,9 @@ func (c *Connection) AsDatabase() (database.Connection, error) {
 }
 
 func (c *Connection) AsFile() (filesys.FileSysClient, error) {
+	if err := c.Resolve(); err != nil {
+		return nil, err
+	}
 	if !c.Type.IsFile() {
 		return nil, g.Error("not a file system type: %s", c.Type)
 	}
@@ -298,6 +339,18 @@ func (c *Connection) ConnSetDatabase(dbName string) *Connection {
 func (c *Connection) setURL() (err error) {
 	c.setFromEnv()
 
+	// the url is set once the secrets are resolved
+	if hasSecretRefs(c.Data) {
+		c.unresolved = true
+		if c.Type == "" {
+			c.Type = dbio.Type(cast.ToString(c.Data["type"]))
+		}
+		if c.Type == "" {
+			c.Type = SchemeType(c.URL())
+		}
+		return nil
+	}
+
 	// setIfMissing sets a default value if key is not present
 	setIfMissing := func(key string, val interface{}) {
 		if v, ok := c.Data[key]; !ok || v == "" {
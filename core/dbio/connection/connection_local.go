@@ -252,6 +252,24 @@ func (ec *EnvConns) Unset(name string) (err error) {
 	return
 }
 
+// Encrypt encrypts the connection values of the env file
+// (with SLING_ENV_KEY, or the key file, see env.GetEnvKeyPath)
+func (ec *EnvConns) Encrypt() (err error) {
+	ef := ec.EnvFile
+	if ef.Encrypted {
+		return g.Error("env file %s is already encrypted", ef.Path)
+	}
+
+	ef.Encrypted = true
+	err = ef.WriteEnvFile()
+	if err != nil {
+		ef.Encrypted = false
+		return g.Error(err, "could not write env file")
+	}
+
+	return
+}
+
 func (ec *EnvConns) List() (fields []string, rows [][]any) {
 	conns := GetLocalConns(true)
 	fields = []string{"Conn Name", "Conn Type", "Source"}
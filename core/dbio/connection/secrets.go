@@ -0,0 +1,449 @@
+package connection
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/flarco/g"
+	slingEnv "github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+	"golang.org/x/oauth2/google"
+	"gopkg.in/yaml.v2"
+)
+
+// SecretProvider resolves the reference of a secret, such as `kv/data/pg#password`
+// for `${secret:vault:kv/data/pg#password}`
+type SecretProvider func(ref string) (value string, err error)
+
+var (
+	secretProviders = map[string]SecretProvider{
+		"file":  fileSecret,
+		"cmd":   cmdSecret,
+		"vault": vaultSecret,
+		"aws":   awsSecret,
+		"gcp":   gcpSecret,
+		"op":    onePasswordSecret,
+	}
+	// the providers reading files or running commands on the machine,
+	// only enabled with SLING_ALLOW_LOCAL_SECRETS=true
+	localSecretProviders = map[string]bool{"file": true, "cmd": true}
+
+	secretCache = NewSecretCache()
+	secretMux   sync.Mutex
+
+	// such as ${secret:vault:kv/data/pg#password}
+	secretRefRegex = regexp.MustCompile(`\$\{secret:([a-zA-Z0-9_\-]+):([^}]+)\}`)
+)
+
+// RegisterSecretProvider adds (or replaces) a secret provider,
+// referred to as `${secret:<name>:<ref>}`
+func RegisterSecretProvider(name string, provider SecretProvider) {
+	secretMux.Lock()
+	defer secretMux.Unlock()
+	secretProviders[name] = provider
+}
+
+// SecretCache holds the resolved secrets, such as for the duration of a run
+type SecretCache struct {
+	values map[string]string
+	mux    sync.Mutex
+}
+
+// NewSecretCache returns an empty secret cache
+func NewSecretCache() *SecretCache {
+	return &SecretCache{values: map[string]string{}}
+}
+
+// ResetSecretCache clears the resolved secrets of the process cache,
+// so that the next run resolves them again
+func ResetSecretCache() {
+	secretCache.mux.Lock()
+	defer secretCache.mux.Unlock()
+	secretCache.values = map[string]string{}
+}
+
+// ResolveSecrets replaces the secret references in the text with their values.
+// The values are cached in the process cache, and redacted from the logs
+func ResolveSecrets(text string) (string, error) {
+	return secretCache.resolve(text)
+}
+
+// resolve replaces the secret references in the text with their values
+func (cache *SecretCache) resolve(text string) (string, error) {
+	if !strings.Contains(text, "${secret:") {
+		return text, nil
+	}
+
+	eG := g.ErrorGroup{}
+	text = secretRefRegex.ReplaceAllStringFunc(text, func(match string) string {
+		parts := secretRefRegex.FindStringSubmatch(match)
+		value, err := cache.resolveSecret(parts[1], strings.TrimSpace(parts[2]))
+		if err != nil {
+			eG.Capture(g.Error(err, "could not resolve secret %s", match))
+			return match
+		}
+		return value
+	})
+
+	return text, eG.Err()
+}
+
+// resolveSecrets returns a copy of the map, with the secret references
+// of the string values resolved
+func (cache *SecretCache) resolveSecrets(m map[string]any) (resolved map[string]any, err error) {
+	resolved = make(map[string]any, len(m))
+	for k, v := range m {
+		switch val := v.(type) {
+		case string:
+			resolve := cache.resolve
+			if k == "url" {
+				resolve = cache.resolveURLSecrets
+			}
+			if resolved[k], err = resolve(val); err != nil {
+				return nil, g.Error(err, "could not resolve secret for %s", k)
+			}
+		case map[string]any:
+			if resolved[k], err = cache.resolveSecrets(val); err != nil {
+				return nil, err
+			}
+		default:
+			resolved[k] = v
+		}
+	}
+	return resolved, nil
+}
+
+// resolveURLSecrets replaces the secret references of the url with their values,
+// escaped for their position in the url (user info, path or query)
+func (cache *SecretCache) resolveURLSecrets(text string) (string, error) {
+	if !strings.Contains(text, "${secret:") {
+		return text, nil
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, idx := range secretRefRegex.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(text[last:idx[0]])
+		value, err := cache.resolveSecret(text[idx[2]:idx[3]], strings.TrimSpace(text[idx[4]:idx[5]]))
+		if err != nil {
+			return text, g.Error(err, "could not resolve secret %s", text[idx[0]:idx[1]])
+		}
+		sb.WriteString(escapeURLValue(sb.String(), text[idx[1]:], value))
+		last = idx[1]
+	}
+	sb.WriteString(text[last:])
+
+	return sb.String(), nil
+}
+
+// escapeURLValue escapes the value for its position in the url,
+// given the text before and after it
+func escapeURLValue(before, after, value string) string {
+	i := strings.Index(before, "://")
+	if i == -1 {
+		return value // such as the whole url as a secret
+	} else if strings.Contains(before, "?") {
+		return url.QueryEscape(value)
+	}
+
+	if authority := before[i+3:]; !strings.ContainsAny(authority, "/@") && strings.Contains(after, "@") {
+		// user or password
+		return strings.TrimPrefix(url.UserPassword("", value).String(), ":")
+	}
+	return url.PathEscape(value)
+}
+
+// LocalSecretRefs returns the secret references of the text using the
+// providers reading the local machine (file, cmd), such as to reject them
+// in a config submitted to sling serve
+func LocalSecretRefs(text string) (refs []string) {
+	for _, parts := range secretRefRegex.FindAllStringSubmatch(text, -1) {
+		if localSecretProviders[parts[1]] {
+			refs = append(refs, parts[0])
+		}
+	}
+	return refs
+}
+
+// hasSecretRefs returns true if a string value of the map
+// has a secret reference
+func hasSecretRefs(m map[string]any) bool {
+	for _, v := range m {
+		switch val := v.(type) {
+		case string:
+			if secretRefRegex.MatchString(val) {
+				return true
+			}
+		case map[string]any:
+			if hasSecretRefs(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cache *SecretCache) resolveSecret(providerName, ref string) (value string, err error) {
+	key := providerName + ":" + ref
+
+	cache.mux.Lock()
+	value, cached := cache.values[key]
+	cache.mux.Unlock()
+
+	secretMux.Lock()
+	provider, ok := secretProviders[providerName]
+	secretMux.Unlock()
+
+	if cached {
+		return value, nil
+	} else if !ok {
+		return "", g.Error("unknown secret provider: %s", providerName)
+	} else if localSecretProviders[providerName] && !cast.ToBool(os.Getenv("SLING_ALLOW_LOCAL_SECRETS")) {
+		return "", g.Error("the %s secret provider is disabled, set SLING_ALLOW_LOCAL_SECRETS=true to enable it", providerName)
+	}
+
+	value, err = provider(ref)
+	if err != nil {
+		return "", g.Error(err, "could not get secret from %s", providerName)
+	}
+
+	cache.mux.Lock()
+	cache.values[key] = value
+	cache.mux.Unlock()
+
+	slingEnv.AddRedactValue(value)
+
+	return value, nil
+}
+
+// splitSecretKey splits the reference from the key, such as `kv/data/pg#password`
+func splitSecretKey(ref string) (name, key string) {
+	if i := strings.LastIndex(ref, "#"); i > -1 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// secretField returns the value of the key if provided,
+// from the secret payload parsed as JSON or YAML
+func secretField(payload, key string) (string, error) {
+	if key == "" {
+		return strings.TrimSpace(payload), nil
+	}
+
+	m := map[string]any{}
+	if err := yaml.Unmarshal([]byte(payload), &m); err != nil {
+		return "", g.Error(err, "could not parse secret to get key %s", key)
+	}
+
+	val, ok := m[key]
+	if !ok {
+		return "", g.Error("key %s not found in secret", key)
+	}
+	return cast.ToString(val), nil
+}
+
+// fileSecret reads the file, such as `/run/secrets/pg_password`
+func fileSecret(ref string) (string, error) {
+	filePath, key := splitSecretKey(ref)
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", g.Error(err, "could not read secret file")
+	}
+	return secretField(string(bytes), key)
+}
+
+// cmdSecret runs the command with the shell, and returns the output
+func cmdSecret(ref string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	var stderr strings.Builder
+	proc := exec.Command(shell, flag, ref)
+	proc.Stderr = &stderr
+	output, err := proc.Output()
+	if err != nil {
+		return "", g.Error(err, "could not run secret command: %s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// onePasswordSecret reads the secret with the 1Password CLI (`op read`),
+// such as `op://vault/item/field`
+func onePasswordSecret(ref string) (string, error) {
+	if !strings.HasPrefix(ref, "op://") {
+		ref = "op://" + ref
+	}
+
+	var stderr strings.Builder
+	proc := exec.Command("op", "read", "--no-newline", ref)
+	proc.Stderr = &stderr
+	output, err := proc.Output()
+	if err != nil {
+		return "", g.Error(err, "could not read from 1Password: %s", strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// vaultSecret reads the secret from HashiCorp Vault, such as
+// `kv/data/pg#password` for a KV v2 engine mounted at `kv`. Uses the
+// VAULT_ADDR, VAULT_TOKEN (or ~/.vault-token) and VAULT_NAMESPACE variables
+func vaultSecret(ref string) (string, error) {
+	secretPath, key := splitSecretKey(ref)
+
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		addr = "http://127.0.0.1:8200"
+	}
+
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		bytes, _ := os.ReadFile(path.Join(home, ".vault-token"))
+		token = strings.TrimSpace(string(bytes))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+strings.TrimPrefix(secretPath, "/"), nil)
+	if err != nil {
+		return "", g.Error(err, "could not create vault request")
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", g.Error(err, "could not request vault")
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", g.Error("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	payload := struct {
+		Data map[string]any `json:"data"`
+	}{}
+	if err = g.Unmarshal(string(body), &payload); err != nil {
+		return "", g.Error(err, "could not parse vault response")
+	}
+
+	// KV v2 has the secret nested, with the metadata
+	data := payload.Data
+	if nested, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = nested
+	}
+
+	return secretMapField(data, key)
+}
+
+// awsSecret reads the secret from AWS Secrets Manager, by name or ARN,
+// such as `prod/pg#password`. Uses the default credentials chain
+func awsSecret(ref string) (string, error) {
+	secretID, key := splitSecretKey(ref)
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return "", g.Error(err, "could not create AWS session")
+	}
+
+	output, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", g.Error(err, "could not get secret value")
+	}
+
+	payload := aws.StringValue(output.SecretString)
+	if output.SecretString == nil {
+		payload = string(output.SecretBinary)
+	}
+	return secretField(payload, key)
+}
+
+// gcpSecret reads the secret from GCP Secret Manager, such as
+// `projects/my-project/secrets/pg/versions/latest#password` or `my-project/pg`.
+// Uses the application default credentials
+func gcpSecret(ref string) (string, error) {
+	name, key := splitSecretKey(ref)
+	if parts := strings.Split(name, "/"); len(parts) == 2 {
+		name = g.F("projects/%s/secrets/%s/versions/latest", parts[0], parts[1])
+	} else if len(parts) == 4 {
+		name = name + "/versions/latest"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", g.Error(err, "could not get GCP credentials")
+	}
+
+	resp, err := client.Get("https://secretmanager.googleapis.com/v1/" + name + ":access")
+	if err != nil {
+		return "", g.Error(err, "could not request secret manager")
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", g.Error("secret manager returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	payload := struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}{}
+	if err = g.Unmarshal(string(body), &payload); err != nil {
+		return "", g.Error(err, "could not parse secret manager response")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload.Payload.Data)
+	if err != nil {
+		return "", g.Error(err, "could not decode secret payload")
+	}
+	return secretField(string(data), key)
+}
+
+// secretMapField returns the value of the key, or the single value
+func secretMapField(data map[string]any, key string) (string, error) {
+	if key == "" {
+		if len(data) != 1 {
+			return "", g.Error("secret has %d keys, specify one with #<key>", len(data))
+		}
+		for _, val := range data {
+			return cast.ToString(val), nil
+		}
+	}
+
+	val, ok := data[key]
+	if !ok {
+		return "", g.Error("key %s not found in secret", key)
+	}
+	return cast.ToString(val), nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/decimal128"
+	"github.com/apache/arrow/go/v16/arrow/ipc"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBigQueryStorageMessage(t *testing.T) {
+	columns := iop.Columns{
+		{Name: "id", DbType: "INT64"},
+		{Name: "created_at", DbType: "TIMESTAMP"},
+		{Name: "created_date", DbType: "DATE"},
+		{Name: "amount", DbType: "NUMERIC(10, 2)"},
+		{Name: "payload", DbType: "JSON"},
+		{Name: "comment", DbType: "STRING(100)"},
+	}
+
+	msgDesc, descProto, err := bqStorageDescriptor(columns)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, descProto.Field, len(columns))
+
+	createdAt := time.Date(2024, 3, 1, 10, 30, 0, 123456000, time.UTC)
+	values := []any{int64(7), createdAt, "1970-01-11", "-121.30", map[string]any{"a": 1}, nil}
+	data, err := bqStorageMessage(msgDesc, columns, values)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := dynamicpb.NewMessage(msgDesc)
+	if !assert.NoError(t, proto.Unmarshal(data, msg)) {
+		return
+	}
+
+	fields := msgDesc.Fields()
+	assert.Equal(t, int64(7), msg.Get(fields.ByName("id")).Int())
+	assert.Equal(t, createdAt.UnixMicro(), msg.Get(fields.ByName("created_at")).Int())
+	assert.Equal(t, int64(10), msg.Get(fields.ByName("created_date")).Int())
+	assert.Equal(t, "-121.30", msg.Get(fields.ByName("amount")).String())
+	assert.Equal(t, `{"a":1}`, msg.Get(fields.ByName("payload")).String())
+	assert.False(t, msg.Has(fields.ByName("comment")))
+
+	_, err = bqStorageMessage(msgDesc, columns, []any{"abc", nil, nil, nil, nil, nil})
+	assert.ErrorContains(t, err, "could not convert value of column id")
+
+	_, _, err = bqStorageDescriptor(iop.Columns{{Name: "loc", DbType: "RECORD"}})
+	assert.ErrorContains(t, err, "not supported with the Storage Write API")
+}
+
+func TestBigQueryArrowRows(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 38, Scale: 9}, Nullable: true},
+		{Name: "created_at", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, Nullable: true},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	createdAt := time.Date(2024, 3, 1, 10, 30, 0, 123456000, time.UTC)
+	builder.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	builder.Field(1).(*array.StringBuilder).AppendValues([]string{"a", ""}, []bool{true, false})
+	builder.Field(2).(*array.Decimal128Builder).AppendValues(
+		[]decimal128.Num{decimal128.FromI64(-121300000000), {}}, []bool{true, false},
+	)
+	builder.Field(3).(*array.TimestampBuilder).AppendValues(
+		[]arrow.Timestamp{arrow.Timestamp(createdAt.UnixMicro()), 0}, []bool{true, false},
+	)
+
+	record := builder.NewRecord()
+	defer record.Release()
+
+	// the read sessions return the schema and the batches separately,
+	// here the whole stream is passed as the schema
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	assert.NoError(t, writer.Write(record))
+	assert.NoError(t, writer.Close())
+
+	rows, err := bqArrowRows(buf.Bytes(), nil)
+	if !assert.NoError(t, err) || !assert.Len(t, rows, 2) {
+		return
+	}
+
+	assert.Equal(t, int64(1), rows[0][0])
+	assert.Equal(t, "a", rows[0][1])
+	assert.Equal(t, "-121.300000000", rows[0][2])
+	assert.True(t, createdAt.Equal(rows[0][3].(time.Time)))
+	assert.Equal(t, []any{int64(2), nil, nil, nil}, rows[1])
+}
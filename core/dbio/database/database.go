@@ -165,7 +165,8 @@ type BaseConn struct {
 	template    dbio.Template
 	schemata    Schemata
 	properties  map[string]string
-	sshClient   *iop.SSHClient
+	sshTunnel   *iop.SSHTunnel
+	connURL     string // the URL connected to, after SSH forwarding
 	Log         []string
 }
 
@@ -433,6 +434,12 @@ func (conn *BaseConn) Self() Connection {
 	return *conn.instance
 }
 
+// SetInstance sets the connection returned by Self, such as a
+// wrapper overriding some methods of the connection
+func (conn *BaseConn) SetInstance(instance Connection) {
+	conn.instance = &instance
+}
+
 // Db returns the sqlx db object
 func (conn *BaseConn) Db() *sqlx.DB {
 	return conn.db
@@ -535,24 +542,11 @@ func (conn *BaseConn) Connect(timeOut ...int) (err error) {
 
 	// start SSH Tunnel with SSH_TUNNEL prop
 	if sshURL := conn.GetProp("SSH_TUNNEL"); sshURL != "" {
-		sshU, err := url.Parse(sshURL)
-		if err != nil {
-			return g.Error(err, "could not parse SSH_TUNNEL URL")
-		}
-
 		connU, err := url.Parse(connURL)
 		if err != nil {
 			return g.Error(err, "could not parse connection URL for SSH forwarding")
 		}
 
-		sshHost := sshU.Hostname()
-		sshPort := cast.ToInt(sshU.Port())
-		if sshPort == 0 {
-			sshPort = 22
-		}
-		sshUser := sshU.User.Username()
-		sshPassword, _ := sshU.User.Password()
-
 		connHost := connU.Hostname()
 		connPort := cast.ToInt(connU.Port())
 		if connPort == 0 {
@@ -563,31 +557,31 @@ func (conn *BaseConn) Connect(timeOut ...int) (err error) {
 			)
 		}
 
-		conn.sshClient = &iop.SSHClient{
-			Host:       sshHost,
-			Port:       sshPort,
-			User:       sshUser,
-			Password:   sshPassword,
-			TgtHost:    connHost,
-			TgtPort:    connPort,
-			PrivateKey: conn.GetProp("SSH_PRIVATE_KEY"),
-			Passphrase: conn.GetProp("SSH_PASSPHRASE"),
-		}
+		if conn.sshTunnel == nil {
+			sshClient, err := iop.NewSSHTunnelClient(conn.Props())
+			if err != nil {
+				return g.Error(err, "could not create ssh client")
+			}
+			sshClient.TgtHost = connHost
+			sshClient.TgtPort = connPort
 
-		localPort, err := conn.sshClient.OpenPortForward()
-		if err != nil {
-			return g.Error(err, "could not connect to ssh server")
+			// the tunnel (and ssh session) is shared with the other connections
+			conn.sshTunnel, err = iop.OpenSSHTunnel(sshClient)
+			if err != nil {
+				return g.Error(err, "could not connect to ssh server")
+			}
 		}
 
 		connURL = strings.ReplaceAll(
 			connURL, g.F("@%s:%d", connHost, connPort),
-			g.F("@127.0.0.1:%d", localPort),
+			g.F("@127.0.0.1:%d", conn.sshTunnel.LocalPort),
 		)
 		g.Trace("new connection URL: " + conn.Self().GetURL(connURL))
 	}
 
 	if conn.db == nil {
 		connURL = conn.Self().GetURL(connURL)
+		conn.connURL = connURL
 		connPool.Mux.Lock()
 		db, poolOk := connPool.Dbs[connURL]
 		connPool.Mux.Unlock()
@@ -684,9 +678,9 @@ func (conn *BaseConn) Close() error {
 			g.Debug(`closed "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
 		}
 	}
-	if conn.sshClient != nil {
-		conn.sshClient.Close()
-		conn.sshClient = nil
+	if conn.sshTunnel != nil {
+		conn.sshTunnel.Close()
+		conn.sshTunnel = nil
 	}
 	conn.SetProp("connected", "false")
 	return err
@@ -694,7 +688,7 @@ func (conn *BaseConn) Close() error {
 
 // LogSQL logs a query for debugging
 func (conn *BaseConn) LogSQL(query string, args ...any) {
-	noColor := g.In(os.Getenv("SLING_LOGGING"), "NO_COLOR", "JSON")
+	noColor := g.In(strings.ToUpper(os.Getenv("SLING_LOGGING")), "NO_COLOR", "JSON")
 
 	query = strings.TrimSpace(query)
 	query = strings.TrimSuffix(query, ";")
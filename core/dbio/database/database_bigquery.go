@@ -90,14 +90,27 @@ func (conn *BigQueryConn) Init() error {
 }
 
 func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client, err error) {
-	var authOption option.ClientOption
-	var credJsonBody string
-
 	to := 15
 	if len(timeOut) > 0 {
 		to = timeOut[0]
 	}
 
+	authOption, err := conn.getAuthOption()
+	if err != nil {
+		return client, err
+	}
+
+	ctx, cancel := context.WithTimeout(conn.BaseConn.Context().Ctx, time.Duration(to)*time.Second)
+	defer cancel()
+
+	return bigquery.NewClient(ctx, conn.ProjectID, authOption)
+}
+
+// getAuthOption returns the credentials option of the google clients,
+// and sets the project from the credentials if needed
+func (conn *BigQueryConn) getAuthOption() (authOption option.ClientOption, err error) {
+	var credJsonBody string
+
 	if val := conn.GetProp("GC_KEY_BODY"); val != "" {
 		credJsonBody = val
 		authOption = option.WithCredentialsJSON([]byte(val))
@@ -105,7 +118,7 @@ func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client,
 		authOption = option.WithCredentialsFile(val)
 		b, err := os.ReadFile(val)
 		if err != nil {
-			return client, g.Error(err, "could not read google cloud key file")
+			return nil, g.Error(err, "could not read google cloud key file")
 		}
 		credJsonBody = string(b)
 	} else if val := conn.GetProp("GC_CRED_API_KEY"); val != "" {
@@ -114,13 +127,13 @@ func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client,
 		authOption = option.WithCredentialsFile(val)
 		b, err := os.ReadFile(val)
 		if err != nil {
-			return client, g.Error(err, "could not read google cloud key file")
+			return nil, g.Error(err, "could not read google cloud key file")
 		}
 		credJsonBody = string(b)
 	} else {
 		creds, err := google.FindDefaultCredentials(conn.BaseConn.Context().Ctx)
 		if err != nil {
-			return client, g.Error(err, "No Google credentials provided or could not find Application Default Credentials.")
+			return nil, g.Error(err, "No Google credentials provided or could not find Application Default Credentials.")
 		}
 		authOption = option.WithCredentials(creds)
 	}
@@ -131,10 +144,7 @@ func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client,
 		conn.ProjectID = cast.ToString(m["project_id"])
 	}
 
-	ctx, cancel := context.WithTimeout(conn.BaseConn.Context().Ctx, time.Duration(to)*time.Second)
-	defer cancel()
-
-	return bigquery.NewClient(ctx, conn.ProjectID, authOption)
+	return authOption, nil
 }
 
 // Connect connects to the database
@@ -534,7 +544,9 @@ func (conn *BigQueryConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (c
 		}
 	}
 
-	if gcBucket := conn.GetProp("GC_BUCKET"); gcBucket == "" {
+	if conn.useStorageAPI() {
+		return conn.importViaStorageWrite(tableFName, df)
+	} else if gcBucket := conn.GetProp("GC_BUCKET"); gcBucket == "" {
 		return conn.importViaLocalStorage(tableFName, df)
 	}
 
@@ -794,7 +806,9 @@ func (conn *BigQueryConn) CopyFromGCS(gcsURI string, table Table, dsColumns []io
 
 // BulkExportFlow reads in bulk
 func (conn *BigQueryConn) BulkExportFlow(tables ...Table) (df *iop.Dataflow, err error) {
-	if conn.GetProp("GC_BUCKET") == "" {
+	if conn.useStorageAPI() {
+		return conn.StorageReadFlow(tables...)
+	} else if conn.GetProp("GC_BUCKET") == "" {
 		g.Warn("No GCS Bucket was provided, pulling from cursor (which may be slower for big datasets). ")
 		return conn.BaseConn.BulkExportFlow(tables...)
 	} else if len(tables) == 0 {
@@ -0,0 +1,661 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	bqStorage "cloud.google.com/go/bigquery/storage/apiv1"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/ipc"
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// useStorageAPI returns true if the reads and writes should use the
+// BigQuery Storage Read and Write APIs (`use_storage_api` property),
+// instead of the row iterator and the load jobs
+func (conn *BigQueryConn) useStorageAPI() bool {
+	return cast.ToBool(conn.GetProp("use_storage_api"))
+}
+
+// bqReadOptions are the options of a Storage Read API session
+type bqReadOptions struct {
+	Fields         []string // the columns to read, all if empty
+	RowRestriction string   // a SQL filter, such as `amount > 10`
+	MaxStreams     int      // the maximum number of parallel streams
+}
+
+// StorageReadFlow reads the tables with the Storage Read API, in Arrow record
+// batches with parallel streams. The views and queries are run first, and
+// their results read from the destination table.
+func (conn *BigQueryConn) StorageReadFlow(tables ...Table) (df *iop.Dataflow, err error) {
+	if len(tables) == 0 {
+		return df, g.Error("no table/query provided")
+	}
+
+	authOption, err := conn.getAuthOption()
+	if err != nil {
+		return df, err
+	}
+
+	client, err := bqStorage.NewBigQueryReadClient(conn.Context().Ctx, authOption)
+	if err != nil {
+		return df, g.Error(err, "could not create BigQuery Storage Read client")
+	}
+
+	opts := bqReadOptions{
+		RowRestriction: conn.GetProp("storage_row_restriction"),
+		MaxStreams:     cast.ToInt(conn.GetProp("storage_read_streams")),
+	}
+	if opts.MaxStreams == 0 {
+		opts.MaxStreams = conn.Context().Wg.Limit
+	}
+
+	df = iop.NewDataflowContext(conn.Context().Ctx)
+	df.Defer(func() { client.Close() })
+
+	dsCh := make(chan *iop.Datastream)
+
+	go func() {
+		defer close(dsCh)
+		dss := []*iop.Datastream{}
+
+		for _, table := range tables {
+			tableOpts := opts
+			if table.IsQuery() {
+				tableOpts.RowRestriction = "" // the where clause is in the query
+			} else {
+				tableOpts.Fields = table.Columns.Names()
+			}
+
+			tableDss, err := conn.storageReadTable(client, table, tableOpts)
+			if err != nil {
+				df.Context.CaptureErr(g.Error(err, "could not read %s with the Storage Read API", table.FullName()))
+				return
+			}
+			dss = append(dss, tableDss...)
+		}
+
+		for _, ds := range dss {
+			dsCh <- ds
+		}
+	}()
+
+	go df.PushStreamChan(dsCh)
+
+	// wait for first ds to start streaming.
+	// columns need to be populated
+	err = df.WaitReady()
+	if err != nil {
+		return df, g.Error(err)
+	}
+
+	return df, nil
+}
+
+// storageReadTable creates a read session of the table, with a datastream per stream
+func (conn *BigQueryConn) storageReadTable(client *bqStorage.BigQueryReadClient, table Table, opts bqReadOptions) (dss []*iop.Datastream, err error) {
+	ctx := conn.Context().Ctx
+
+	projectID := lo.Ternary(table.Database != "", table.Database, conn.ProjectID)
+	bqTable := conn.Client.DatasetInProject(projectID, table.Schema).Table(table.Name)
+
+	if !table.IsQuery() {
+		md, err := bqTable.Metadata(ctx)
+		if err != nil {
+			return nil, g.Error(err, "could not get table metadata")
+		} else if md.Type != bigquery.RegularTable {
+			table.SQL = table.Select(0, opts.Fields...) // views cannot be read directly
+		}
+	}
+
+	// run the query, the results are in the (temporary) destination table
+	if table.IsQuery() {
+		sql := table.Select(0)
+		conn.LogSQL(sql)
+
+		q := conn.Client.Query(sql)
+		q.QueryConfig = bigquery.QueryConfig{Q: sql, DefaultDatasetID: conn.GetProp("schema")}
+		job, err := q.Run(ctx)
+		if err != nil {
+			return nil, g.Error(err, "could not run query")
+		}
+		if status, err := job.Wait(ctx); err != nil {
+			return nil, g.Error(err, "could not wait for query")
+		} else if err = status.Err(); err != nil {
+			return nil, g.Error(err, "SQL Error for:\n"+sql)
+		}
+
+		config, err := job.Config()
+		if err != nil {
+			return nil, g.Error(err, "could not get query config")
+		}
+		bqTable = config.(*bigquery.QueryConfig).Dst
+		opts.Fields = nil
+	}
+
+	md, err := bqTable.Metadata(ctx)
+	if err != nil {
+		return nil, g.Error(err, "could not get table metadata")
+	}
+
+	session, err := client.CreateReadSession(ctx, &storagepb.CreateReadSessionRequest{
+		Parent: "projects/" + conn.ProjectID,
+		ReadSession: &storagepb.ReadSession{
+			Table: g.F(
+				"projects/%s/datasets/%s/tables/%s",
+				bqTable.ProjectID, bqTable.DatasetID, bqTable.TableID,
+			),
+			DataFormat: storagepb.DataFormat_ARROW,
+			ReadOptions: &storagepb.ReadSession_TableReadOptions{
+				SelectedFields: opts.Fields,
+				RowRestriction: opts.RowRestriction,
+			},
+		},
+		MaxStreamCount: int32(opts.MaxStreams),
+	})
+	if err != nil {
+		return nil, g.Error(err, "could not create read session")
+	}
+
+	// the columns are in the order of the arrow schema
+	schemaBytes := session.GetArrowSchema().GetSerializedSchema()
+	columns, err := conn.storageReadColumns(md.Schema, schemaBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Debug("reading %s with %d streams (Storage Read API)", bqTable.FullyQualifiedName(), len(session.GetStreams()))
+
+	for _, stream := range session.GetStreams() {
+		reader := &bqStreamReader{
+			client:      client,
+			stream:      stream.GetName(),
+			schemaBytes: schemaBytes,
+		}
+
+		ds := iop.NewDatastreamIt(ctx, columns, reader.nextFunc)
+		ds.Inferred = !InferDBStream && ds.Columns.Sourced()
+		ds.SetMetadata(conn.GetProp("METADATA"))
+		ds.SetConfig(conn.Props())
+
+		if err = ds.Start(); err != nil {
+			return nil, g.Error(err, "could start datastream")
+		}
+		dss = append(dss, ds)
+	}
+
+	if len(dss) == 0 {
+		// no rows, no streams
+		ds := iop.NewDatastreamContext(ctx, columns)
+		ds.SetReady()
+		ds.Close()
+		dss = append(dss, ds)
+	}
+
+	return dss, nil
+}
+
+// storageReadColumns returns the columns of the arrow schema, with the
+// types of the table schema
+func (conn *BigQueryConn) storageReadColumns(schema bigquery.Schema, schemaBytes []byte) (columns iop.Columns, err error) {
+	reader, err := ipc.NewReader(bytes.NewReader(schemaBytes))
+	if err != nil {
+		return nil, g.Error(err, "could not read arrow schema")
+	}
+	defer reader.Release()
+
+	tableCols, _ := conn.getItColumns(schema)
+	tableColMap := tableCols.FieldMap(true)
+
+	for i, field := range reader.Schema().Fields() {
+		index, ok := tableColMap[strings.ToLower(field.Name)]
+		if !ok {
+			return nil, g.Error("column %s not found in table schema", field.Name)
+		}
+		col := tableCols[index]
+		col.Position = i + 1
+		columns = append(columns, col)
+	}
+
+	return columns, nil
+}
+
+// bqStreamReader reads the rows of a Storage Read API stream
+type bqStreamReader struct {
+	client      *bqStorage.BigQueryReadClient
+	stream      string
+	schemaBytes []byte
+	rows        storagepb.BigQueryRead_ReadRowsClient
+	buffer      [][]any
+	offset      int64
+}
+
+func (r *bqStreamReader) nextFunc(it *iop.Iterator) bool {
+	for len(r.buffer) == 0 {
+		if r.rows == nil {
+			rows, err := r.client.ReadRows(it.Context.Ctx, &storagepb.ReadRowsRequest{
+				ReadStream: r.stream,
+				Offset:     r.offset,
+			})
+			if err != nil {
+				it.Context.CaptureErr(g.Error(err, "could not read stream %s", r.stream))
+				return false
+			}
+			r.rows = rows
+		}
+
+		resp, err := r.rows.Recv()
+		if err == io.EOF {
+			return false
+		} else if err != nil {
+			it.Context.CaptureErr(g.Error(err, "could not receive rows from stream %s", r.stream))
+			return false
+		}
+
+		r.buffer, err = bqArrowRows(r.schemaBytes, resp.GetArrowRecordBatch().GetSerializedRecordBatch())
+		if err != nil {
+			it.Context.CaptureErr(err)
+			return false
+		}
+		r.offset += int64(len(r.buffer))
+	}
+
+	it.Row = r.buffer[0]
+	r.buffer = r.buffer[1:]
+	return true
+}
+
+// bqArrowRows decodes the rows of a serialized arrow record batch
+func bqArrowRows(schemaBytes, batchBytes []byte) (rows [][]any, err error) {
+	reader, err := ipc.NewReader(io.MultiReader(bytes.NewReader(schemaBytes), bytes.NewReader(batchBytes)))
+	if err != nil {
+		return nil, g.Error(err, "could not read arrow record batch")
+	}
+	defer reader.Release()
+
+	for reader.Next() {
+		record := reader.Record()
+		for i := 0; i < int(record.NumRows()); i++ {
+			row := make([]any, record.NumCols())
+			for j, arr := range record.Columns() {
+				row[j] = bqArrowValue(arr, i)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if err = reader.Err(); err != nil {
+		return nil, g.Error(err, "could not read arrow record batch")
+	}
+
+	return rows, nil
+}
+
+// bqArrowValue returns the value of an arrow array at the index
+func bqArrowValue(arr arrow.Array, i int) any {
+	if arr.IsNull(i) {
+		return nil
+	}
+
+	switch a := arr.(type) {
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Float64:
+		return a.Value(i)
+	case *array.Boolean:
+		return a.Value(i)
+	case *array.String:
+		return a.Value(i)
+	case *array.Binary:
+		return a.Value(i)
+	case *array.Decimal128:
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.Date32:
+		return a.Value(i).ToTime()
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit)
+	case *array.Time64:
+		return a.Value(i).FormattedString(a.DataType().(*arrow.Time64Type).Unit)
+	default:
+		// records and arrays
+		return g.Marshal(arr.GetOneForMarshal(i))
+	}
+}
+
+// importViaStorageWrite writes the streams with the Storage Write API. With the
+// `storage_write_mode` property as `pending` (default), the rows are committed
+// at once when all streams are written. With `committed`, the rows are visible
+// as soon as they are written.
+func (conn *BigQueryConn) importViaStorageWrite(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	ctx := conn.Context().Ctx
+
+	streamType := managedwriter.PendingStream
+	switch mode := strings.ToLower(conn.GetProp("storage_write_mode")); mode {
+	case "", "pending":
+	case "committed":
+		streamType = managedwriter.CommittedStream
+	default:
+		return 0, g.Error("invalid storage_write_mode '%s', expecting pending or committed", mode)
+	}
+
+	table, err := ParseTableName(tableFName, conn.Type)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	table.Columns, err = conn.GetSQLColumns(table)
+	if err != nil {
+		return 0, g.Error(err, "could not get table columns: "+tableFName)
+	}
+
+	msgDesc, descProto, err := bqStorageDescriptor(table.Columns)
+	if err != nil {
+		return 0, g.Error(err, "could not make Storage Write API schema")
+	}
+
+	authOption, err := conn.getAuthOption()
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := managedwriter.NewClient(ctx, conn.ProjectID, authOption)
+	if err != nil {
+		return 0, g.Error(err, "could not create BigQuery Storage Write client")
+	}
+	defer client.Close()
+
+	projectID := lo.Ternary(table.Database != "", table.Database, conn.ProjectID)
+	parent := managedwriter.TableParentFromParts(projectID, table.Schema, table.Name)
+
+	g.Info("importing into bigquery via Storage Write API (%s streams)", lo.Ternary(streamType == managedwriter.PendingStream, "pending", "committed"))
+
+	streamNames := []string{}
+	writeStream := func(ds *iop.Datastream) {
+		defer conn.Context().Wg.Write.Done()
+
+		stream, err := client.NewManagedStream(
+			ctx,
+			managedwriter.WithDestinationTable(parent),
+			managedwriter.WithType(streamType),
+			managedwriter.WithSchemaDescriptor(descProto),
+		)
+		if err != nil {
+			df.Context.CaptureErr(g.Error(err, "could not create write stream"))
+			return
+		}
+		defer stream.Close()
+
+		err = bqStorageWrite(ctx, stream, ds, table.Columns, msgDesc)
+		if err != nil {
+			df.Context.CaptureErr(g.Error(err, "could not write into %s", tableFName))
+			return
+		}
+
+		if streamType == managedwriter.PendingStream {
+			if _, err = stream.Finalize(ctx); err != nil {
+				df.Context.CaptureErr(g.Error(err, "could not finalize write stream"))
+				return
+			}
+			conn.Mux.Lock()
+			streamNames = append(streamNames, stream.StreamName())
+			conn.Mux.Unlock()
+		}
+	}
+
+	for ds := range df.StreamCh {
+		if df.Err() != nil {
+			break
+		}
+		conn.Context().Wg.Write.Add()
+		go writeStream(ds)
+	}
+
+	conn.Context().Wg.Write.Wait()
+	if df.Err() != nil {
+		return df.Count(), g.Error(df.Err(), "Error importing to BigQuery")
+	}
+
+	if len(streamNames) > 0 {
+		resp, err := client.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+			Parent:       parent,
+			WriteStreams: streamNames,
+		})
+		if err != nil {
+			return 0, g.Error(err, "could not commit write streams")
+		}
+		for _, streamErr := range resp.GetStreamErrors() {
+			return 0, g.Error("could not commit write stream %s: %s", streamErr.GetEntity(), streamErr.GetErrorMessage())
+		}
+	}
+
+	return df.Count(), nil
+}
+
+// bqStorageWrite appends the rows of the datastream, in requests of about 5MB
+func bqStorageWrite(ctx context.Context, stream *managedwriter.ManagedStream, ds *iop.Datastream, columns iop.Columns, msgDesc protoreflect.MessageDescriptor) (err error) {
+	results := []*managedwriter.AppendResult{}
+	rows := [][]byte{}
+	size := 0
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		result, err := stream.AppendRows(ctx, rows)
+		if err != nil {
+			return g.Error(err, "could not append rows")
+		}
+		results = append(results, result)
+		rows, size = [][]byte{}, 0
+		return nil
+	}
+
+	for batch := range ds.BatchChan {
+		// the index of the batch columns in the table columns
+		colMap := columns.FieldMap(true)
+		indexes := make([]int, len(batch.Columns))
+		for i, col := range batch.Columns {
+			index, ok := colMap[strings.ToLower(col.Name)]
+			if !ok {
+				return g.Error("column %s not found in table", col.Name)
+			}
+			indexes[i] = index
+		}
+
+		for row := range batch.Rows {
+			values := make([]any, len(columns))
+			for i, val := range row {
+				if i < len(indexes) {
+					values[indexes[i]] = val
+				}
+			}
+
+			data, err := bqStorageMessage(msgDesc, columns, values)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, data)
+			size += len(data)
+
+			if size >= 5*1024*1024 {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return err
+	} else if err = ds.Err(); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if _, err = result.GetResult(ctx); err != nil {
+			return g.Error(err, "could not append rows")
+		}
+	}
+
+	return nil
+}
+
+// bqBaseType returns the BigQuery type of the column without
+// its parameters, such as `NUMERIC` for `NUMERIC(10, 2)`
+func bqBaseType(col iop.Column) string {
+	baseType, _, _ := strings.Cut(col.DbType, "(")
+	return strings.ToUpper(strings.TrimSpace(baseType))
+}
+
+// bqStorageFieldType returns the proto type of the column, as accepted
+// by the Storage Write API for the BigQuery type
+func bqStorageFieldType(col iop.Column) (fieldType descriptorpb.FieldDescriptorProto_Type, err error) {
+	switch bqBaseType(col) {
+	case "INTEGER", "INT64":
+		return descriptorpb.FieldDescriptorProto_TYPE_INT64, nil
+	case "FLOAT", "FLOAT64":
+		return descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, nil
+	case "BOOLEAN", "BOOL":
+		return descriptorpb.FieldDescriptorProto_TYPE_BOOL, nil
+	case "BYTES":
+		return descriptorpb.FieldDescriptorProto_TYPE_BYTES, nil
+	case "TIMESTAMP":
+		return descriptorpb.FieldDescriptorProto_TYPE_INT64, nil // micro-seconds since epoch
+	case "DATE":
+		return descriptorpb.FieldDescriptorProto_TYPE_INT32, nil // days since epoch
+	case "STRING", "NUMERIC", "BIGNUMERIC", "DATETIME", "TIME", "JSON", "GEOGRAPHY":
+		return descriptorpb.FieldDescriptorProto_TYPE_STRING, nil
+	}
+	return fieldType, g.Error("type %s of column %s is not supported with the Storage Write API", col.DbType, col.Name)
+}
+
+// bqStorageDescriptor returns the proto descriptor of the rows, from the table columns
+func bqStorageDescriptor(columns iop.Columns) (msgDesc protoreflect.MessageDescriptor, descProto *descriptorpb.DescriptorProto, err error) {
+	descProto = &descriptorpb.DescriptorProto{Name: proto.String("row")}
+	for i, col := range columns {
+		fieldType, err := bqStorageFieldType(col)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		descProto.Field = append(descProto.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(col.Name),
+			Number: proto.Int32(int32(i + 1)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   fieldType.Enum(),
+		})
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("sling_row.proto"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{descProto},
+	}, nil)
+	if err != nil {
+		return nil, nil, g.Error(err, "invalid column names for the Storage Write API")
+	}
+
+	return file.Messages().Get(0), descProto, nil
+}
+
+// bqStorageMessage encodes the values of a row, in the order of the table columns
+func bqStorageMessage(msgDesc protoreflect.MessageDescriptor, columns iop.Columns, values []any) (data []byte, err error) {
+	msg := dynamicpb.NewMessage(msgDesc)
+	fields := msgDesc.Fields()
+
+	for i, val := range values {
+		if val == nil {
+			continue
+		}
+
+		col := columns[i]
+		field := fields.Get(i)
+
+		var value protoreflect.Value
+		switch field.Kind() {
+		case protoreflect.Int64Kind:
+			if bqBaseType(col) == "TIMESTAMP" {
+				t, err := cast.ToTimeE(val)
+				if err != nil {
+					return nil, g.Error(err, "could not convert value of column %s", col.Name)
+				}
+				value = protoreflect.ValueOfInt64(t.UnixMicro())
+			} else {
+				v, err := cast.ToInt64E(val)
+				if err != nil {
+					return nil, g.Error(err, "could not convert value of column %s", col.Name)
+				}
+				value = protoreflect.ValueOfInt64(v)
+			}
+		case protoreflect.Int32Kind:
+			t, err := cast.ToTimeE(val)
+			if err != nil {
+				return nil, g.Error(err, "could not convert value of column %s", col.Name)
+			}
+			date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			value = protoreflect.ValueOfInt32(int32(date.Unix() / 86400))
+		case protoreflect.DoubleKind:
+			v, err := cast.ToFloat64E(val)
+			if err != nil {
+				return nil, g.Error(err, "could not convert value of column %s", col.Name)
+			}
+			value = protoreflect.ValueOfFloat64(v)
+		case protoreflect.BoolKind:
+			v, err := cast.ToBoolE(val)
+			if err != nil {
+				return nil, g.Error(err, "could not convert value of column %s", col.Name)
+			}
+			value = protoreflect.ValueOfBool(v)
+		case protoreflect.BytesKind:
+			if v, ok := val.([]byte); ok {
+				value = protoreflect.ValueOfBytes(v)
+			} else {
+				value = protoreflect.ValueOfBytes([]byte(cast.ToString(val)))
+			}
+		default:
+			value = protoreflect.ValueOfString(bqStorageString(col, val))
+		}
+
+		msg.Set(field, value)
+	}
+
+	data, err = proto.Marshal(msg)
+	if err != nil {
+		return nil, g.Error(err, "could not encode row")
+	}
+	return data, nil
+}
+
+// bqStorageString formats the values of the types written as strings
+func bqStorageString(col iop.Column, val any) string {
+	switch v := val.(type) {
+	case time.Time:
+		switch bqBaseType(col) {
+		case "DATETIME":
+			return v.Format("2006-01-02 15:04:05.999999")
+		case "TIME":
+			return v.Format("15:04:05.999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	case map[string]any, []any:
+		return g.Marshal(v)
+	}
+	return cast.ToString(val)
+}
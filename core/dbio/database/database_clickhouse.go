@@ -7,7 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/fatih/color"
+	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
@@ -94,9 +97,115 @@ func (conn *ClickhouseConn) GenerateDDL(table Table, data iop.Dataset, temporary
 	}
 	sql = strings.ReplaceAll(sql, "{partition_by}", partitionBy)
 
+	engine, orderBy, keyCols, err := conn.tableEngine(data.Columns)
+	if err != nil {
+		return sql, g.Error(err, "could not determine table engine")
+	}
+	sql = strings.ReplaceAll(sql, "{engine}", engine)
+	sql = strings.ReplaceAll(sql, "{order_by}", orderBy)
+
+	// the sorting and version columns cannot be nullable
+	for _, col := range keyCols {
+		nativeType, err := conn.GetNativeType(col)
+		if err != nil {
+			return sql, g.Error(err, "no native mapping")
+		}
+		notNullType := strings.TrimSuffix(strings.TrimPrefix(nativeType, "Nullable("), ")")
+		name := conn.Self().Quote(col.Name)
+		sql = strings.Replace(sql, name+" "+nativeType, name+" "+notNullType, 1)
+	}
+
 	return strings.TrimSpace(sql), nil
 }
 
+// tableEngine returns the engine and sorting key of a new table, from the
+// `table_engine` property (MergeTree by default) and the table keys. The
+// sorting key is the sort key, else the primary key with the replacing
+// engines, where the version is the update key. With the replacing engines,
+// the sort key must be the primary key. The key columns are the columns of
+// the sorting key and the version.
+func (conn *ClickhouseConn) tableEngine(columns iop.Columns) (engine, orderBy string, keyCols iop.Columns, err error) {
+	engine = "MergeTree"
+	if val := conn.GetProp("table_engine"); val != "" {
+		engine = ""
+		for _, name := range []string{"MergeTree", "ReplicatedMergeTree", "ReplacingMergeTree", "ReplicatedReplacingMergeTree"} {
+			if strings.EqualFold(val, name) {
+				engine = name
+			}
+		}
+		if engine == "" {
+			return "", "", nil, g.Error("invalid table_engine '%s', expecting MergeTree, ReplicatedMergeTree, ReplacingMergeTree or ReplicatedReplacingMergeTree", val)
+		}
+	}
+
+	replacing := strings.Contains(engine, "Replacing")
+
+	keyCols = columns.GetKeys(iop.SortKey)
+	if len(keyCols) == 0 && replacing {
+		keyCols = columns.GetKeys(iop.PrimaryKey)
+	}
+
+	// the rows are replaced on the sorting key, which must be the primary key
+	if pkCols := columns.GetKeys(iop.PrimaryKey); replacing && len(pkCols) > 0 && !sameKeys(keyCols.Names(), pkCols.Names()) {
+		return "", "", nil, g.Error("the sort key (%s) must be the primary key (%s) for the %s engine", strings.Join(keyCols.Names(), ", "), strings.Join(pkCols.Names(), ", "), engine)
+	}
+
+	orderBy = "tuple()"
+	if len(keyCols) > 0 {
+		orderBy = g.F("(%s)", strings.Join(quoteColNames(conn, keyCols.Names()), ", "))
+	} else if replacing {
+		return "", "", nil, g.Error("primary key or sort key is required for the %s engine", engine)
+	}
+
+	version := ""
+	if updateCols := columns.GetKeys(iop.UpdateKey); replacing && len(updateCols) > 0 {
+		version = conn.Quote(updateCols[0].Name)
+		if keyCols.GetColumn(updateCols[0].Name).Name == "" {
+			keyCols = append(keyCols, updateCols[0])
+		}
+	}
+
+	return g.F("%s(%s)", engine, version), orderBy, keyCols, nil
+}
+
+// replacingTableKey returns the sorting key of the table if it uses a
+// replacing engine, where rows with the same sorting key are replaced on merge
+func (conn *ClickhouseConn) replacingTableKey(tableFName string) (sortingKey []string, replacing bool) {
+	table, err := ParseTableName(tableFName, conn.GetType())
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := conn.SumbitTemplate(
+		"single", conn.template.Metadata, "table_engine",
+		g.M("schema", table.Schema, "table", table.Name),
+	)
+	if err != nil || len(data.Rows) == 0 {
+		return nil, false
+	} else if !strings.Contains(cast.ToString(data.Rows[0][0]), "ReplacingMergeTree") {
+		return nil, false
+	}
+
+	for _, key := range strings.Split(cast.ToString(data.Rows[0][1]), ",") {
+		sortingKey = append(sortingKey, strings.Trim(strings.TrimSpace(key), "`\""))
+	}
+
+	return sortingKey, true
+}
+
+// sameKeys returns true if both keys have the same columns
+func sameKeys(keys1, keys2 []string) bool {
+	if len(keys1) != len(keys2) {
+		return false
+	}
+	for _, key := range keys1 {
+		if !lo.ContainsBy(keys2, func(k string) bool { return strings.EqualFold(k, key) }) {
+			return false
+		}
+	}
+	return true
+}
+
 // BulkImportStream inserts a stream into a table
 func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	var columns iop.Columns
@@ -131,6 +240,11 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 		}
 	}
 
+	// the native protocol batches are opt-in, and not available over HTTP
+	if conn.GetProp("http_url") == "" && cast.ToBool(conn.GetProp("use_native_batch")) {
+		return conn.NativeBatchStream(tableFName, ds)
+	}
+
 	for batch := range ds.BatchChan {
 		if batch.ColumnsChanged() || batch.IsFirst() {
 			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
@@ -218,6 +332,180 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 	return count, nil
 }
 
+// NativeBatchStream inserts a stream into a table with the batches
+// of the native protocol, sent every `bulk_insert_batch_size` rows
+func (conn *ClickhouseConn) NativeBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	var columns iop.Columns
+
+	connURL := lo.Ternary(conn.connURL != "", conn.connURL, conn.Self().ConnString())
+	options, err := clickhouse.ParseDSN(connURL)
+	if err != nil {
+		return count, g.Error(err, "could not parse clickhouse URL")
+	}
+
+	chConn, err := clickhouse.Open(options)
+	if err != nil {
+		return count, g.Error(err, "could not open native clickhouse connection")
+	}
+	defer chConn.Close()
+
+	batchSize := cast.ToInt(conn.GetProp("bulk_insert_batch_size"))
+	if batchSize <= 0 {
+		batchSize = 100000
+	}
+
+	ctx := ds.Context.Ctx
+	for batch := range ds.BatchChan {
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			if err != nil {
+				return count, g.Error(err, "could not get matching list of columns from table")
+			}
+
+			// match the target columns with the batch columns
+			tgtColumns := make(iop.Columns, len(batch.Columns))
+			for i, col := range batch.Columns {
+				tgtCol := columns.GetColumn(col.Name)
+				if tgtCol.Name == "" {
+					return count, g.Error("source field '%s' is missing in target table", col.Name)
+				}
+				tgtColumns[i] = tgtCol
+			}
+			columns = tgtColumns
+		}
+
+		err = func() error {
+			insertSQL := g.F(
+				"INSERT INTO %s (%s)", tableFName,
+				strings.Join(quoteColNames(conn, columns.Names()), ", "),
+			)
+
+			// batches are prepared as needed, and released once sent
+			var chBatch driver.Batch
+			defer func() {
+				if chBatch != nil {
+					chBatch.Abort()
+				}
+			}()
+
+			for row := range batch.Rows {
+				for i, col := range columns {
+					if i < len(row) {
+						if row[i], err = clickhouseNativeValue(col, row[i]); err != nil {
+							return err
+						}
+					}
+				}
+
+				if chBatch == nil {
+					chBatch, err = chConn.PrepareBatch(ctx, insertSQL)
+					if err != nil {
+						return g.Error(err, "could not prepare batch")
+					}
+				}
+
+				if err = chBatch.Append(row...); err != nil {
+					g.Trace("error for row: %#v", row)
+					return g.Error(err, "could not append row")
+				}
+				count++
+
+				if chBatch.Rows() >= batchSize {
+					if err = chBatch.Send(); err != nil {
+						return g.Error(err, "could not send batch")
+					}
+					chBatch = nil
+				}
+			}
+
+			if chBatch != nil {
+				if err = chBatch.Send(); err != nil {
+					return g.Error(err, "could not send batch")
+				}
+				chBatch = nil
+			}
+
+			return nil
+		}()
+
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not insert into table %s", tableFName))
+			ds.Context.Cancel()
+			return count, g.Error(err, "could not insert data")
+		}
+	}
+
+	ds.SetEmpty()
+
+	g.Debug("INSERT %d ROWS", count)
+	return count, nil
+}
+
+// clickhouseNativeValue converts a value to the type expected
+// by the native protocol for the column
+func clickhouseNativeValue(col iop.Column, val any) (newVal any, err error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	// Nullable(LowCardinality(String)) => String, DateTime64(6) => DateTime64
+	dbType := col.DbType
+	for _, wrapper := range []string{"Nullable(", "LowCardinality("} {
+		if strings.HasPrefix(dbType, wrapper) {
+			dbType = strings.TrimSuffix(strings.TrimPrefix(dbType, wrapper), ")")
+		}
+	}
+	dbType = strings.TrimSpace(strings.Split(dbType, "(")[0])
+
+	switch dbType {
+	case "Int8":
+		newVal, err = cast.ToInt8E(val)
+	case "Int16":
+		newVal, err = cast.ToInt16E(val)
+	case "Int32":
+		newVal, err = cast.ToInt32E(val)
+	case "Int64":
+		newVal, err = cast.ToInt64E(val)
+	case "UInt8":
+		newVal, err = cast.ToUint8E(val)
+	case "UInt16":
+		newVal, err = cast.ToUint16E(val)
+	case "UInt32":
+		newVal, err = cast.ToUint32E(val)
+	case "UInt64":
+		newVal, err = cast.ToUint64E(val)
+	case "Float32":
+		newVal, err = cast.ToFloat32E(val)
+	case "Float64":
+		newVal, err = cast.ToFloat64E(val)
+	case "Decimal":
+		newVal, err = decimal.NewFromString(cast.ToString(val))
+	case "Bool":
+		newVal, err = cast.ToBoolE(val)
+	case "Date", "Date32", "DateTime", "DateTime64":
+		newVal, err = cast.ToTimeE(val)
+	case "String", "FixedString":
+		switch v := val.(type) {
+		case string, []byte:
+			newVal = v
+		case time.Time:
+			newVal = v.Format("2006-01-02 15:04:05.000000")
+		case map[string]any, map[any]any, []any:
+			newVal = g.Marshal(v)
+		default:
+			newVal = cast.ToString(v)
+		}
+	default:
+		newVal = val
+	}
+
+	if err != nil {
+		return nil, g.Error(err, "could not convert value of column %s (%s)", col.Name, col.DbType)
+	}
+
+	return newVal, nil
+}
+
 // GenerateInsertStatement returns the proper INSERT statement
 func (conn *ClickhouseConn) GenerateInsertStatement(tableName string, fields []string, numRows int) string {
 
@@ -271,6 +559,20 @@ func (conn *ClickhouseConn) GenerateUpsertSQL(srcTable string, tgtTable string,
 	SELECT {src_fields}
 	FROM {src_table} src
 	`
+
+	// the rows are replaced by the engine on merge, no need to delete
+	if sortingKey, replacing := conn.replacingTableKey(tgtTable); replacing {
+		if !sameKeys(sortingKey, pkFields) {
+			return "", g.Error("the sorting key of %s (%s) must be the primary key (%s) to upsert into a replacing table", tgtTable, strings.Join(sortingKey, ", "), strings.Join(pkFields, ", "))
+		}
+
+		sqlTempl = `
+		INSERT INTO {tgt_table}
+			({insert_fields})
+		SELECT {src_fields}
+		FROM {src_table} src
+		`
+	}
 	sql = g.R(
 		sqlTempl,
 		"src_table", srcTable,
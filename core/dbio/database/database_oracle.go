@@ -10,8 +10,10 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/samber/lo"
 	go_ora "github.com/sijms/go-ora/v2"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/spf13/cast"
@@ -199,16 +201,18 @@ func (conn *OracleConn) SumbitTemplate(level string, templateMap map[string]stri
 
 // BulkImportStream bulk import stream
 func (conn *OracleConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
-	_, err = exec.LookPath("sqlldr")
-	if err != nil {
-		g.Trace("sqlldr not found in path. Using cursor...")
-		return conn.BaseConn.InsertBatchStream(tableFName, ds)
-	} else if runtime.GOOS == "windows" {
-		return conn.BaseConn.InsertBatchStream(tableFName, ds)
-	} else if conn.GetProp("allow_bulk_import") != "true" {
+	if conn.GetProp("allow_bulk_import") != "true" {
 		return conn.BaseConn.InsertBatchStream(tableFName, ds)
 	}
 
+	// sqlldr is opt-in, the array binding of the driver is used otherwise
+	if !cast.ToBool(conn.GetProp("use_sqlldr")) || runtime.GOOS == "windows" {
+		return conn.ArrayInsertStream(tableFName, ds)
+	} else if _, err = exec.LookPath("sqlldr"); err != nil {
+		g.Warn("sqlldr not found in path. Using array binding...")
+		return conn.ArrayInsertStream(tableFName, ds)
+	}
+
 	// needs to get columns to shape stream
 	columns, err := conn.GetColumns(tableFName)
 	if err != nil {
@@ -232,6 +236,279 @@ func (conn *OracleConn) BulkImportStream(tableFName string, ds *iop.Datastream)
 	return countTot, nil
 }
 
+// ArrayInsertStream inserts the stream with the array binding of the driver,
+// in batches of `bulk_insert_batch_size` rows (10000 by default) executed over
+// `bulk_insert_sessions` concurrent sessions (the number of CPUs by default)
+func (conn *OracleConn) ArrayInsertStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	return conn.arrayBindStream(tableFName, ds, func(columns iop.Columns) (string, error) {
+		return conn.arrayInsertSQL(tableFName, columns), nil
+	})
+}
+
+// Upsert merges the rows of the source table into the target table. With
+// `allow_bulk_import` (and without sqlldr), the rows are streamed into
+// MergeStream, otherwise a single MERGE statement is executed
+func (conn *OracleConn) Upsert(srcTable string, tgtTable string, primKeys []string) (rowAffCnt int64, err error) {
+	if conn.GetProp("allow_bulk_import") != "true" || cast.ToBool(conn.GetProp("use_sqlldr")) || conn.tx != nil {
+		return conn.BaseConn.Upsert(srcTable, tgtTable, primKeys)
+	}
+
+	ds, err := conn.StreamRows("select * from " + srcTable)
+	if err != nil {
+		return 0, g.Error(err, "could not read rows from %s", srcTable)
+	}
+
+	count, err := conn.MergeStream(tgtTable, ds, primKeys)
+	if err != nil {
+		return 0, g.Error(err, "could not merge into %s", tgtTable)
+	}
+	return cast.ToInt64(count), nil
+}
+
+// MergeStream upserts the stream into the table with a MERGE statement
+// and the array binding of the driver, matching the rows on the primary key
+func (conn *OracleConn) MergeStream(tableFName string, ds *iop.Datastream, pkFields []string) (count uint64, err error) {
+	return conn.arrayBindStream(tableFName, ds, func(columns iop.Columns) (string, error) {
+		return conn.arrayMergeSQL(tableFName, columns, pkFields)
+	})
+}
+
+// arrayBindStream executes the statement for the batches of rows of the stream
+func (conn *OracleConn) arrayBindStream(tableFName string, ds *iop.Datastream, makeSQL func(columns iop.Columns) (string, error)) (count uint64, err error) {
+	var columns iop.Columns
+	var sql string
+
+	batchSize := cast.ToInt(conn.GetProp("bulk_insert_batch_size"))
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+
+	sessions := cast.ToInt(conn.GetProp("bulk_insert_sessions"))
+	if sessions <= 0 {
+		sessions = runtime.NumCPU()
+	}
+	sessCtx := g.NewContext(ds.Context.Ctx, sessions)
+
+	doExec := func(sql string, columns iop.Columns, rows [][]any) {
+		defer sessCtx.Wg.Write.Done()
+
+		cnt, err := conn.arrayExec(sessCtx.Ctx, sql, columns, rows)
+		atomic.AddUint64(&count, cnt)
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not bulk insert into table %s", tableFName))
+			ds.Context.Cancel()
+		}
+	}
+
+	for batch := range ds.BatchChan {
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			ds.Context.Lock()
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			ds.Context.Unlock()
+			if err != nil {
+				return count, g.Error(err, "could not get matching list of columns from table")
+			}
+
+			err = batch.Shape(columns)
+			if err != nil {
+				return count, g.Error(err, "could not shape batch stream")
+			}
+
+			if sql, err = makeSQL(columns); err != nil {
+				return count, g.Error(err, "could not generate statement")
+			}
+		}
+
+		rows := make([][]any, 0, batchSize)
+		for row := range batch.Rows {
+			rows = append(rows, row)
+			if len(rows) == batchSize {
+				sessCtx.Wg.Write.Add()
+				go doExec(sql, columns, rows)
+				rows = make([][]any, 0, batchSize)
+			}
+		}
+
+		if len(rows) > 0 {
+			sessCtx.Wg.Write.Add()
+			go doExec(sql, columns, rows)
+		}
+	}
+
+	sessCtx.Wg.Write.Wait()
+
+	return count, ds.Err()
+}
+
+// arrayExec executes the statement once in a transaction,
+// with the values of each column bound as an array
+func (conn *OracleConn) arrayExec(ctx context.Context, sql string, columns iop.Columns, rows [][]any) (count uint64, err error) {
+	arrays := make([]any, len(columns))
+	for i, col := range columns {
+		values := make([]any, len(rows))
+		for j, row := range rows {
+			if i >= len(row) {
+				continue
+			}
+			if values[j], err = oracleBindValue(col, row[i]); err != nil {
+				return 0, err
+			}
+		}
+		arrays[i] = values
+	}
+
+	tx, err := conn.Db().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, g.Error(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sql, arrays...)
+	if err != nil {
+		return 0, g.Error(err, "could not execute statement with array binding")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, g.Error(err, "could not commit transaction")
+	}
+
+	affected, _ := result.RowsAffected()
+	return cast.ToUint64(affected), nil
+}
+
+// arrayInsertSQL returns the INSERT statement with the bind variables of the columns
+func (conn *OracleConn) arrayInsertSQL(tableFName string, columns iop.Columns) string {
+	values := make([]string, len(columns))
+	for i := range columns {
+		values[i] = g.F(":%d", i+1)
+	}
+
+	return g.F(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		tableFName,
+		strings.Join(quoteColNames(conn, columns.Names()), ", "),
+		strings.Join(values, ", "),
+	)
+}
+
+// arrayMergeSQL returns the MERGE statement with the bind variables of the columns
+func (conn *OracleConn) arrayMergeSQL(tableFName string, columns iop.Columns, pkFields []string) (sql string, err error) {
+	if len(pkFields) == 0 {
+		return "", g.Error("primary key is required to merge into %s", tableFName)
+	}
+
+	pkMap := map[string]bool{}
+	for _, pkField := range pkFields {
+		pkMap[strings.ToLower(pkField)] = true
+	}
+
+	nameValues, names, values, setFields, conditions := []string{}, []string{}, []string{}, []string{}, []string{}
+	for i, col := range columns {
+		name := conn.Quote(col.Name)
+		nameValues = append(nameValues, g.F(":%d AS %s", i+1, name))
+		names = append(names, name)
+		values = append(values, "src."+name)
+
+		expr := g.F("tgt.%s = src.%s", name, name)
+		if pkMap[strings.ToLower(col.Name)] {
+			conditions = append(conditions, expr)
+		} else {
+			setFields = append(setFields, expr)
+		}
+	}
+
+	if len(conditions) != len(pkMap) {
+		return "", g.Error("primary key (%s) not found in columns of %s", strings.Join(pkFields, ", "), tableFName)
+	}
+
+	template := conn.GetTemplateValue("core.replace")
+	if len(setFields) == 0 {
+		// all columns are in the primary key, nothing to update
+		template = strings.Join(lo.Filter(strings.Split(template, "\n"), func(line string, i int) bool {
+			return !strings.Contains(strings.ToUpper(line), "WHEN MATCHED") && !strings.Contains(line, "{set_fields}")
+		}), "\n")
+	}
+
+	sql = g.R(
+		template,
+		"table", tableFName,
+		"name_values", strings.Join(nameValues, ", "),
+		"src_tgt_condition", strings.Join(conditions, " AND "),
+		"set_fields", strings.Join(setFields, ", "),
+		"names", strings.Join(names, ", "),
+		"values", strings.Join(values, ", "),
+	)
+
+	return sql, nil
+}
+
+// oracleBindValue converts the value to the type to bind
+// for the column, from the database type
+func oracleBindValue(col iop.Column, val any) (value any, err error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	dbType := strings.ToUpper(col.DbType)
+	switch {
+	case g.In(dbType, "BINARY_FLOAT", "BINARY_DOUBLE", "FLOAT"):
+		value, err = cast.ToFloat64E(val)
+	case g.In(dbType, "NUMBER", "INTEGER"):
+		switch val.(type) {
+		case float32, float64:
+			value, err = cast.ToFloat64E(val)
+		default:
+			if col.IsInteger() {
+				value, err = cast.ToInt64E(val)
+			} else {
+				value, err = cast.ToStringE(val) // keeps the precision of decimals
+			}
+		}
+	case dbType == "DATE" || strings.HasPrefix(dbType, "TIMESTAMP"):
+		var t time.Time
+		if t, err = cast.ToTimeE(val); err == nil {
+			if strings.Contains(dbType, "TIME ZONE") {
+				value = go_ora.TimeStampTZ(t)
+			} else {
+				value = go_ora.TimeStamp(t)
+			}
+		}
+	case dbType == "CLOB":
+		value = go_ora.Clob{String: oracleString(val), Valid: true}
+	case dbType == "NCLOB":
+		value = go_ora.NClob{String: oracleString(val), Valid: true}
+	case g.In(dbType, "BLOB", "RAW", "LONG RAW"):
+		data, ok := val.([]byte)
+		if !ok {
+			data = []byte(oracleString(val))
+		}
+		value = data
+		if dbType == "BLOB" {
+			value = go_ora.Blob{Data: data}
+		}
+	default:
+		value = oracleString(val)
+	}
+
+	if err != nil {
+		return nil, g.Error(err, "could not convert value of column %s (%s)", col.Name, col.DbType)
+	}
+	return value, nil
+}
+
+// oracleString formats the values bound as strings
+func oracleString(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case map[string]any, []any:
+		return g.Marshal(v)
+	}
+	return cast.ToString(val)
+}
+
 // SQLLoad uses sqlldr to Bulk Import
 // cat test1.csv | sqlldr system/oracle@oracle.host:1521/xe control=sqlldr.ctl log=/dev/stdout bad=/dev/stderr
 // cannot import when newline in value. Need to scan for new lines.
@@ -1,18 +1,21 @@
 package database
 
 import (
-	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
-	"os/exec"
+	"reflect"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/spf13/cast"
 
 	"github.com/flarco/g"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
 	"github.com/lib/pq"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 )
@@ -30,10 +33,11 @@ func (conn *PostgresConn) Init() error {
 	conn.BaseConn.Type = dbio.TypeDbPostgres
 	conn.BaseConn.defaultPort = 5432
 
-	// Turn off Bulk export for now
-	// the CopyToStdout function frequently produces error `read |0: file already closed`
-	// also is slower than just select?
-	conn.BaseConn.SetProp("allow_bulk_export", "false")
+	// Bulk export (COPY TO STDOUT) is opt-in, since CSV
+	// does not distinguish nulls from empty strings
+	if conn.BaseConn.GetProp("allow_bulk_export") == "" {
+		conn.BaseConn.SetProp("allow_bulk_export", "false")
+	}
 
 	instance := Connection(conn)
 	conn.BaseConn.instance = &instance
@@ -41,33 +45,59 @@ func (conn *PostgresConn) Init() error {
 	return conn.BaseConn.Init()
 }
 
+// copyConnect opens a session with the driver's wire protocol, for COPY TO
+// STDOUT (not supported by lib/pq). The URL is parsed with the defaults of lib/pq
+func (conn *PostgresConn) copyConnect(ctx context.Context) (pgConn *pgconn.PgConn, err error) {
+	connURL := conn.connURL
+	if connURL == "" {
+		connURL = conn.Self().ConnString()
+	}
+
+	pgConn, err = pgconn.Connect(ctx, pgCopyURL(connURL))
+	if err != nil {
+		return nil, g.Error(err, "could not open connection for COPY")
+	}
+	return pgConn, nil
+}
+
+// pgCopyURL sets the SSL mode to require when missing, the default of lib/pq
+// (the default of pgconn is prefer, falling back to a plain connection)
+func pgCopyURL(connURL string) string {
+	if strings.Contains(connURL, "sslmode=") {
+		return connURL
+	}
+
+	if !strings.Contains(connURL, "://") {
+		return connURL + " sslmode=require" // key/value connection string
+	} else if strings.Contains(connURL, "?") {
+		return connURL + "&sslmode=require"
+	}
+	return connURL + "?sslmode=require"
+}
+
 // CopyToStdout Copy TO STDOUT
 func (conn *PostgresConn) CopyToStdout(ctx *g.Context, sql string) (stdOutReader io.Reader, err error) {
-	var stderr bytes.Buffer
-	copyQuery := fmt.Sprintf(`\copy ( %s ) TO STDOUT WITH CSV HEADER`, sql)
-	copyQuery = strings.ReplaceAll(copyQuery, "\n", " ")
+	pgConn, err := conn.copyConnect(ctx.Ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	proc := exec.Command("psql", conn.URL, "-X", "-c", copyQuery)
-	proc.Stderr = &stderr
-	stdOutReader, err = proc.StdoutPipe()
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	copyQuery := fmt.Sprintf(`COPY ( %s ) TO STDOUT WITH CSV HEADER`, sql)
 
+	pipeR, pipeW := io.Pipe()
 	go func() {
-		if err := proc.Run(); err != nil {
-			// bytes, _ := proc.CombinedOutput()
-			cmdStr := strings.ReplaceAll(strings.Join(proc.Args, " "), conn.URL, "$DBURL")
-			err = g.Error(
-				err,
-				fmt.Sprintf(
-					"COPY FROM Command -> %s\nCOPY FROM Error   -> %s",
-					cmdStr, stderr.String(),
-				),
-			)
+		defer pgConn.Close(context.Background())
+
+		_, err := pgConn.CopyTo(ctx.Ctx, pipeW, copyQuery)
+		if err != nil {
+			err = g.Error(err, "could not COPY TO STDOUT -> %s", CleanSQL(conn, sql))
 			ctx.CaptureErr(err)
-			g.LogError(err, "could not PG copy")
 		}
+		pipeW.CloseWithError(err)
 	}()
 
-	return stdOutReader, err
+	return pipeR, nil
 }
 
 // GenerateDDL generates a DDL based on a dataset
@@ -89,13 +119,7 @@ func (conn *PostgresConn) GenerateDDL(table Table, data iop.Dataset, temporary b
 
 // BulkExportStream uses the bulk dumping (COPY)
 func (conn *PostgresConn) BulkExportStream(table Table) (ds *iop.Datastream, err error) {
-	_, err = exec.LookPath("psql")
-	if err != nil {
-		g.Trace("psql not found in path. Using cursor...")
-		return conn.StreamRows(table.Select(0), g.M("columns", table.Columns))
-	}
-
-	if conn.BaseConn.GetProp("allow_bulk_export") != "true" {
+	if !cast.ToBool(conn.BaseConn.GetProp("allow_bulk_export")) {
 		return conn.StreamRows(table.Select(0), g.M("columns", table.Columns))
 	}
 
@@ -111,9 +135,14 @@ func (conn *PostgresConn) BulkExportStream(table Table) (ds *iop.Datastream, err
 	return ds, err
 }
 
-// BulkImportStream inserts a stream into a table
+// BulkImportStream inserts a stream into a table, with COPY FROM STDIN. With the
+// csv `copy_format`, the COPY runs in the transaction of the connection, so that
+// the rows are committed or rolled back with it (without a transaction, one is
+// opened for the stream). With the binary `copy_format`, the COPY runs in its own
+// session and transaction, committed at the end of the stream.
 func (conn *PostgresConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	var columns iop.Columns
+	var format pgCopyFormat
 
 	mux := ds.Context.Mux
 
@@ -123,25 +152,70 @@ func (conn *PostgresConn) BulkImportStream(tableFName string, ds *iop.Datastream
 		return
 	}
 
-	// set OnSchemaChange
-	if df := ds.Df(); df != nil && cast.ToBool(conn.GetProp("adjust_column_type")) {
-		oldOnColumnChanged := df.OnColumnChanged
-		df.OnColumnChanged = func(col iop.Column) error {
+	formatName, err := conn.copyFormatName()
+	if err != nil {
+		return
+	}
 
-			// sleep to allow transaction to close
-			time.Sleep(300 * time.Millisecond)
+	var pgConn *pgconn.PgConn
+	if formatName == "binary" {
+		// the session of pgconn, since lib/pq only supports the text format
+		pgConn, err = conn.copyConnect(ds.Context.Ctx)
+		if err != nil {
+			return
+		}
+		defer pgConn.Close(context.Background()) // rolls back without commit
 
-			mux.Lock()
-			defer mux.Unlock()
+		if _, err = pgConn.Exec(ds.Context.Ctx, "begin").ReadAll(); err != nil {
+			return count, g.Error(err, "could not begin transaction for COPY")
+		}
+		defer func() {
+			if err == nil {
+				if _, err = pgConn.Exec(ds.Context.Ctx, "commit").ReadAll(); err != nil {
+					err = g.Error(err, "could not commit COPY")
+				}
+			}
+		}()
+	} else if conn.Tx() == nil {
+		// COPY needs a transaction
+		err = conn.BeginContext(ds.Context.Ctx)
+		if err != nil {
+			return count, g.Error(err, "could not begin transaction for COPY")
+		}
+		defer conn.Rollback()
+		defer func() {
+			if err == nil {
+				err = conn.Commit()
+			}
+		}()
+	}
 
-			// use pre-defined function
-			err = oldOnColumnChanged(col)
-			if err != nil {
-				return g.Error(err, "could not process ColumnChange for Postgres")
+	// the session cannot run statements during a COPY, so schema
+	// changes wait for the COPY of the current batch to finish.
+	// With the binary format, the COPY session holds a lock on the
+	// table until the end of the stream, so schema changes would block.
+	copyMux := sync.Mutex{}
+	if df := ds.Df(); df != nil {
+		wrapHook := func(hook func(col iop.Column) error) func(col iop.Column) error {
+			if hook == nil {
+				return nil
 			}
+			return func(col iop.Column) error {
+				if formatName == "binary" {
+					return g.Error("column changes are not supported with copy_format binary (column %s), use csv", col.Name)
+				}
 
-			return nil
+				copyMux.Lock()
+				defer copyMux.Unlock()
+
+				if err := hook(col); err != nil {
+					return g.Error(err, "could not process column change for Postgres")
+				}
+				return nil
+			}
 		}
+		df.OnColumnChanged = wrapHook(df.OnColumnChanged)
+		df.OnColumnAdded = wrapHook(df.OnColumnAdded)
 	}
 
 	for batch := range ds.BatchChan {
@@ -157,62 +231,144 @@ func (conn *PostgresConn) BulkImportStream(tableFName string, ds *iop.Datastream
 			if err != nil {
 				return count, g.Error(err, "could not shape batch stream")
 			}
+
+			mux.Lock()
+			format, err = conn.copyFormat(formatName, table, columns, ds.Sp)
+			mux.Unlock()
+			if err != nil {
+				return count, g.Error(err, "could not prepare COPY format")
+			}
 		}
 
-		err = func() error {
+		var batchCount uint64
+		copyMux.Lock()
+		if pgConn != nil {
+			batchCount, err = conn.copyBinaryBatch(ds.Context.Ctx, pgConn, table, columns, batch, format)
+		} else {
+			batchCount, err = conn.copyFromBatch(table, columns, batch, format)
+		}
+		copyMux.Unlock()
+		count += batchCount
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not COPY into table %s", tableFName))
+			ds.Context.Cancel()
+			return count, g.Error(err, "could not copy data")
+		}
+	}
 
-			// COPY needs a transaction
-			if conn.Tx() == nil {
-				err = conn.Begin()
-				if err != nil {
-					return g.Error(err, "could not begin")
-				}
-				defer conn.Rollback()
-			}
+	ds.SetEmpty()
 
-			stmt, err := conn.Prepare(pq.CopyInSchema(table.Schema, table.Name, columns.Names()...))
-			if err != nil {
-				g.Trace("%s: %#v", table, columns.Names())
-				return g.Error(err, "could not prepare statement")
+	g.Trace("COPY %d ROWS", count)
+	return count, nil
+}
+
+// copyFromBatch copies the rows of the batch with a COPY statement
+func (conn *PostgresConn) copyFromBatch(table Table, columns iop.Columns, batch *iop.Batch, format pgCopyFormat) (count uint64, err error) {
+	stmt, err := conn.Prepare(pq.CopyInSchema(table.Schema, table.Name, columns.Names()...))
+	if err != nil {
+		g.Trace("%s: %#v", table, columns.Names())
+		return count, g.Error(err, "could not prepare COPY statement")
+	}
+	defer stmt.Close()
+
+	for row := range batch.Rows {
+		values, err := format.Values(row)
+		if err == nil {
+			_, err = stmt.Exec(values...)
+		}
+		if err != nil {
+			g.Trace("error for rec: %s", g.Pretty(batch.Columns.MakeRec(row)))
+			return count, g.Error(err, "could not copy row")
+		}
+		count++
+	}
+
+	// flush the rows and end the COPY
+	if _, err = stmt.Exec(); err != nil {
+		return count, g.Error(err, "could not execute COPY into %s", table.FullName())
+	}
+	return count, nil
+}
+
+// pgCopyBinaryHeader is the signature, flags and header extension
+// length of the binary format of COPY
+var pgCopyBinaryHeader = []byte("PGCOPY\n\377\r\n\000\000\000\000\000\000\000\000\000")
+
+// copyBinaryBatch copies the rows of the batch with a COPY statement in the binary
+// format, the tuples being written to the session by a goroutine
+func (conn *PostgresConn) copyBinaryBatch(ctx context.Context, pgConn *pgconn.PgConn, table Table, columns iop.Columns, batch *iop.Batch, format pgCopyFormat) (count uint64, err error) {
+	quotedNames := make([]string, len(columns))
+	for i, col := range columns {
+		quotedNames[i] = conn.Self().Quote(col.Name)
+	}
+	sql := g.F("COPY %s (%s) FROM STDIN (FORMAT binary)", table.FullName(), strings.Join(quotedNames, ", "))
+
+	var writeErr error
+	done := make(chan struct{})
+	pipeR, pipeW := io.Pipe()
+
+	go func() {
+		defer close(done)
+
+		buf := append([]byte{}, pgCopyBinaryHeader...)
+		for row := range batch.Rows {
+			buf, writeErr = format.Tuple(buf, row)
+			if writeErr != nil {
+				g.Trace("error for rec: %s", g.Pretty(batch.Columns.MakeRec(row)))
+				writeErr = g.Error(writeErr, "could not copy row")
+				pipeW.CloseWithError(writeErr)
+				return
 			}
+			count++
 
-			for row := range batch.Rows {
-				// g.PP(batch.Columns.MakeRec(row))
-				count++
-				// Do insert
-				mux.Lock()
-				_, err := stmt.Exec(row...)
-				mux.Unlock()
-				if err != nil {
-					ds.Context.CaptureErr(g.Error(err, "could not COPY into table %s", tableFName))
-					ds.Context.Cancel()
-					g.Trace("error for rec: %s", g.Pretty(batch.Columns.MakeRec(row)))
-					return g.Error(err, "could not execute statement")
+			if len(buf) > 65536 {
+				if _, writeErr = pipeW.Write(buf); writeErr != nil {
+					return
 				}
+				buf = buf[:0]
 			}
+		}
 
-			err = stmt.Close()
-			if err != nil {
-				return g.Error(err, "could not close statement")
-			}
+		buf = binary.BigEndian.AppendUint16(buf, 0xffff) // trailer (-1)
+		if _, writeErr = pipeW.Write(buf); writeErr != nil {
+			return
+		}
+		pipeW.Close()
+	}()
 
-			err = conn.Commit()
-			if err != nil {
-				return g.Error(err, "could not commit transaction")
-			}
+	_, err = pgConn.CopyFrom(ctx, pipeR, sql)
+	pipeR.CloseWithError(lo.Ternary(err != nil, err, io.ErrClosedPipe)) // unblocks the writer
+	<-done
 
-			return nil
-		}()
+	if writeErr != nil && err != nil {
+		return count, writeErr
+	} else if err != nil {
+		return count, g.Error(err, "could not execute COPY into %s", table.FullName())
+	}
+	return count, nil
+}
 
-		if err != nil {
-			return count, g.Error(err, "could not copy data")
+// pgCopyTextValues returns the values of the row for COPY in the text format.
+// Binary values are kept as bytes, others are cast as string.
+func pgCopyTextValues(sp *iop.StreamProcessor, columns iop.Columns, row []any) []any {
+	values := make([]any, len(row))
+	for i, val := range row {
+		if val == nil {
+			continue
 		}
-	}
 
-	ds.SetEmpty()
+		if b, ok := val.([]byte); ok && columns[i].Type.IsBinary() {
+			values[i] = b
+			continue
+		}
 
-	g.Trace("COPY %d ROWS", count)
-	return count, nil
+		str := sp.CastToString(i, val, columns[i].Type)
+		if str == "" && !columns[i].IsString() {
+			continue // such as a zero timestamp
+		}
+		values[i] = str
+	}
+	return values
 }
 
 // CastColumnForSelect casts to the correct target column type
@@ -323,3 +479,179 @@ func (conn *PostgresConn) GenerateUpsertSQL(srcTable string, tgtTable string, pk
 
 	return
 }
+
+// pgCopyConnInfo has the built-in types, for the typed COPY encoding
+var pgCopyConnInfo = pgtype.NewConnInfo()
+
+// pgTypeAliases maps the SQL type names to the internal type names
+var pgTypeAliases = map[string]string{
+	"smallint":                    "int2",
+	"integer":                     "int4",
+	"int":                         "int4",
+	"bigint":                      "int8",
+	"real":                        "float4",
+	"double precision":            "float8",
+	"decimal":                     "numeric",
+	"boolean":                     "bool",
+	"character varying":           "varchar",
+	"character":                   "bpchar",
+	"char":                        "bpchar",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+	"time without time zone":      "time",
+}
+
+// pgCopyFormat encodes the values of the rows for COPY FROM STDIN
+type pgCopyFormat struct {
+	Name   string                                      // csv or binary
+	Values func(row []any) ([]any, error)              // text values, for csv
+	Tuple  func(buf []byte, row []any) ([]byte, error) // appends the binary tuple, for binary
+}
+
+// copyFormatName returns the validated `copy_format` property
+func (conn *PostgresConn) copyFormatName() (name string, err error) {
+	switch name = strings.ToLower(conn.GetProp("copy_format")); name {
+	case "", "csv":
+		return "csv", nil
+	case "binary":
+		return name, nil
+	}
+	return name, g.Error("invalid copy_format '%s', expecting csv or binary", name)
+}
+
+// copyFormat returns the encoding of the values for the format. With `binary`,
+// the values are encoded in the binary format of the column types of the target
+// table (or the native types of the columns), which is lossless for bytea,
+// arrays, json and timestamps, but requires the values to match the types
+func (conn *PostgresConn) copyFormat(name string, table Table, columns iop.Columns, sp *iop.StreamProcessor) (format pgCopyFormat, err error) {
+	if name != "binary" {
+		format = pgCopyFormat{
+			Name: "csv",
+			Values: func(row []any) ([]any, error) {
+				return pgCopyTextValues(sp, columns, row), nil
+			},
+		}
+		return format, nil
+	}
+
+	// the type names of the table columns (udt_name has the array types)
+	sql := g.F(
+		"select column_name, udt_name from information_schema.columns where table_schema = '%s' and table_name = '%s'",
+		table.Schema, table.Name,
+	)
+	data, err := conn.Query(sql)
+	if err != nil {
+		return format, g.Error(err, "could not get column types of %s", table.FullName())
+	}
+
+	udtNames := map[string]string{}
+	for _, row := range data.Rows {
+		udtNames[strings.ToLower(cast.ToString(row[0]))] = cast.ToString(row[1])
+	}
+
+	values := make([]pgtype.Value, len(columns))
+	for i, col := range columns {
+		typeName := udtNames[strings.ToLower(col.Name)]
+		if typeName == "" {
+			nativeType, err := conn.GetNativeType(col)
+			if err != nil {
+				return format, g.Error(err, "could not get native type for %s", col.Name)
+			}
+			typeName = strings.ToLower(strings.TrimSpace(strings.Split(nativeType, "(")[0]))
+		}
+		if alias, ok := pgTypeAliases[typeName]; ok {
+			typeName = alias
+		}
+
+		dataType, ok := pgCopyConnInfo.DataTypeForName(typeName)
+		if !ok {
+			return format, g.Error("type %s of column %s is not supported with the binary copy_format, use csv", typeName, col.Name)
+		} else if _, ok := dataType.Value.(pgtype.BinaryEncoder); !ok {
+			return format, g.Error("type %s of column %s cannot be encoded, use copy_format csv", typeName, col.Name)
+		}
+		values[i] = pgtype.NewValue(dataType.Value)
+	}
+
+	format = pgCopyFormat{
+		Name: "binary",
+		Tuple: func(buf []byte, row []any) ([]byte, error) {
+			return pgCopyBinaryTuple(buf, sp, columns, values, row)
+		},
+	}
+
+	return format, nil
+}
+
+// pgCopyBinaryTuple appends the row to buf as a tuple of the binary format of
+// COPY: the number of fields, then the length (-1 for nulls) and bytes of each
+// value, encoded with the column types
+func pgCopyBinaryTuple(buf []byte, sp *iop.StreamProcessor, columns iop.Columns, values []pgtype.Value, row []any) ([]byte, error) {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(row)))
+	for i, val := range row {
+		start := len(buf)
+		buf = binary.BigEndian.AppendUint32(buf, 0xffffffff) // null (-1)
+		if val == nil {
+			continue
+		}
+
+		value := values[i]
+		if err := pgSetValue(value, val, sp, i, columns[i]); err != nil {
+			return nil, g.Error(err, "could not encode value for column %s: %#v", columns[i].Name, val)
+		}
+
+		valBuf, err := value.(pgtype.BinaryEncoder).EncodeBinary(pgCopyConnInfo, buf)
+		if err != nil {
+			return nil, g.Error(err, "could not encode value for column %s: %#v", columns[i].Name, val)
+		} else if valBuf != nil {
+			buf = valBuf
+			binary.BigEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+		}
+	}
+
+	return buf, nil
+}
+
+// pgSetValue sets the value, falling back on the time value,
+// or the text representation (such as for numeric values)
+func pgSetValue(value pgtype.Value, val any, sp *iop.StreamProcessor, i int, col iop.Column) (err error) {
+	// arrays from json arrays (such as [1,2,3]) or array literals (such as {1,2,3})
+	if str, ok := val.(string); ok && strings.HasSuffix(reflect.TypeOf(value).Elem().Name(), "Array") {
+		if strings.HasPrefix(str, "[") {
+			var arr []any
+			if err = g.Unmarshal(str, &arr); err != nil {
+				return g.Error(err, "could not parse json array")
+			}
+			return value.Set(arr)
+		} else if decoder, ok := value.(pgtype.TextDecoder); ok {
+			return decoder.DecodeText(pgCopyConnInfo, []byte(str))
+		}
+	}
+
+	if err = value.Set(val); err == nil {
+		return nil
+	}
+
+	if col.IsDatetime() || col.IsDate() {
+		if tVal, tErr := sp.CastToTime(val); tErr == nil && !tVal.IsZero() {
+			return value.Set(tVal)
+		}
+	}
+
+	str := sp.CastToString(i, val, col.Type)
+	switch value.(type) {
+	case *pgtype.Bytea:
+		return value.Set([]byte(str))
+	}
+
+	if value.Set(str) == nil {
+		return nil
+	}
+
+	if decoder, ok := value.(pgtype.TextDecoder); ok {
+		if decoder.DecodeText(pgCopyConnInfo, []byte(str)) == nil {
+			return nil
+		}
+	}
+
+	return err
+}
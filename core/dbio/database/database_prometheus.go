@@ -1,14 +1,20 @@
 package database
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"io"
+	"math"
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flarco/g"
+	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/config"
@@ -17,6 +23,7 @@ import (
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/spf13/cast"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 // PrometheusConn is a Prometheus connection
@@ -65,6 +72,12 @@ func (conn *PrometheusConn) getNewClient(timeOut ...int) (client v1.API, err err
 // Connect connects to the database
 func (conn *PrometheusConn) Connect(timeOut ...int) error {
 	var err error
+
+	// write only, such as Mimir or VictoriaMetrics remote-write endpoints
+	if conn.GetProp("http_url") == "" && conn.GetProp("remote_write_url") != "" {
+		return nil
+	}
+
 	conn.Client, err = conn.getNewClient(timeOut...)
 	if err != nil {
 		return g.Error(err, "Failed to get client")
@@ -154,273 +167,447 @@ func (conn *PrometheusConn) BulkExportFlow(tables ...Table) (df *iop.Dataflow, e
 
 func (conn *PrometheusConn) StreamRowsContext(ctx context.Context, query string, Opts ...map[string]interface{}) (ds *iop.Datastream, err error) {
 	opts := getQueryOptions(Opts)
-	Limit := int(0) // infinite
-	if val := cast.ToInt(opts["limit"]); val > 0 {
+	Limit := uint64(0) // infinite
+	if val := cast.ToUint64(opts["limit"]); val > 0 {
 		Limit = val
 	}
 
 	if strings.TrimSpace(query) == "" {
 		g.Warn("Empty query")
 		return ds, nil
+	} else if conn.Client == nil {
+		return nil, g.Error("cannot query, only remote_write_url is provided (need http_url)")
 	}
 
 	queryContext := g.NewContext(ctx)
 
-	start := time.Now().Add(-24 * 30 * time.Hour)
-	end := time.Now()
+	Range, err := promQueryRange(opts)
+	if err != nil {
+		return nil, g.Error(err, "could not parse query range")
+	}
+
+	chunks, err := promRangeChunks(Range, opts)
+	if err != nil {
+		return nil, g.Error(err, "could not split query range")
+	}
+	g.Debug("using range %s (%d chunks)", g.Marshal(Range), len(chunks))
+
+	concurrency := cast.ToInt(opts["concurrency"])
+	if concurrency <= 0 {
+		concurrency = cast.ToInt(conn.GetProp("concurrency"))
+	}
+	if concurrency <= 0 {
+		concurrency = 4
+	}
 
-	toHourDuration := func(duration string) string {
-		switch {
-		case strings.HasSuffix(duration, "d"):
-			num := cast.ToInt(strings.TrimSuffix(duration, "d"))
-			duration = g.F("%dh", num*24)
-		case strings.HasSuffix(duration, "w"):
-			num := cast.ToInt(strings.TrimSuffix(duration, "w"))
-			duration = g.F("%dh", num*24*7)
-		case strings.HasSuffix(duration, "M"):
-			num := cast.ToInt(strings.TrimSuffix(duration, "M"))
-			duration = g.F("%dh", num*24*31)
+	// the chunks are queried concurrently, and consumed in order.
+	// a slot is freed once a chunk is received, so at most
+	// `concurrency` chunks are held in memory
+	slots := make(chan struct{}, concurrency)
+	done := make(chan struct{})
+
+	// the chunk queries in flight are cancelled when the stream stops early
+	chunkCtx, cancelChunks := context.WithCancel(queryContext.Ctx)
+	results := make([]chan promChunkResult, len(chunks))
+	for i := range chunks {
+		results[i] = make(chan promChunkResult, 1)
+	}
+
+	go func() {
+		for i, chunk := range chunks {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			case <-chunkCtx.Done():
+				return
+			}
+
+			go func(i int, chunk v1.Range) {
+				data, err := conn.queryChunk(chunkCtx, query, chunk)
+				results[i] <- promChunkResult{data: data, err: err}
+			}(i, chunk)
+		}
+	}()
+
+	chunkI := -1
+	nextChunk := func() (data iop.Dataset, ok bool, err error) {
+		chunkI++
+		if chunkI >= len(results) {
+			return data, false, nil
+		}
+
+		select {
+		case result := <-results[chunkI]:
+			<-slots
+			return result.data, true, result.err
+		case <-queryContext.Ctx.Done():
+			return data, false, g.Error("query context was cancelled")
 		}
-		return duration
 	}
 
-	if startVal := cast.ToString(opts["start"]); strings.HasPrefix(startVal, "now-") {
-		duration := strings.TrimPrefix(startVal, "now-")
-		delta, err := time.ParseDuration(toHourDuration(duration))
+	// the columns are those of the first chunk with data, the labels
+	// of the following chunks are added as they appear
+	data := iop.NewDataset(iop.Columns{})
+	for len(data.Columns) == 0 {
+		chunkData, ok, err := nextChunk()
 		if err != nil {
-			return nil, g.Error(err, "could not parse duration from start: %s", startVal)
+			close(done)
+			cancelChunks()
+			return nil, g.Error(err, "Error querying Prometheus: %s", query)
+		} else if !ok {
+			break
 		}
-		start = time.Now().Add(-1 * delta)
-	} else if opts["start"] != nil && opts["start"] != "now" {
-		start, err = cast.ToTimeE(opts["start"])
-		if err != nil {
-			return nil, g.Error(err, "could not parse start value: %s", opts["start"])
+		data = chunkData
+	}
+
+	if chunkI >= len(results)-1 {
+		// single chunk
+		close(done)
+		cancelChunks()
+		if Limit > 0 && uint64(len(data.Rows)) > Limit {
+			data.Rows = data.Rows[:Limit]
 		}
+		ds = data.Stream(conn.Props())
+		return
 	}
 
-	if endVal := cast.ToString(opts["end"]); strings.HasPrefix(endVal, "now-") {
-		duration := strings.TrimPrefix(endVal, "now-")
-		delta, err := time.ParseDuration(toHourDuration(duration))
+	columns := data.Columns
+	current, rowI := data, 0
+	colMap := lo.Range(len(columns)) // current chunk column index -> column index
+	closeOnce := sync.Once{}
+
+	nextFunc := func(it *iop.Iterator) bool {
+		for {
+			if Limit > 0 && it.Counter >= Limit {
+				break
+			}
+
+			if rowI < len(current.Rows) {
+				row := current.Rows[rowI]
+				rowI++
+
+				it.Row = make([]any, len(columns))
+				for i, val := range row {
+					if j := colMap[i]; j >= 0 {
+						it.Row[j] = val
+					}
+				}
+				return true
+			}
+
+			chunkData, ok, err := nextChunk()
+			if err != nil {
+				it.Context.CaptureErr(g.Error(err, "Error querying Prometheus: %s", query))
+				break
+			} else if !ok {
+				break
+			}
+
+			// labels not in the previous chunks are added as columns
+			current, rowI = chunkData, 0
+			fieldMap := columns.FieldMap(true)
+			newCols := iop.Columns{}
+			for _, col := range current.Columns {
+				if _, ok := fieldMap[strings.ToLower(col.Name)]; !ok {
+					col.Position = len(columns) + len(newCols) + 1
+					newCols = append(newCols, col)
+				}
+			}
+			if len(newCols) > 0 {
+				// the schema change is only consumed by a dataflow, without one
+				// the columns are merged directly
+				ds := it.Ds()
+				if df := ds.Df(); df != nil {
+					df.Context.Lock()
+					ds.AddColumns(newCols, false)
+					df.Context.Unlock()
+				} else {
+					ds.Context.Lock()
+					ds.Columns, _, _ = ds.Columns.Merge(newCols, false)
+					ds.Context.Unlock()
+				}
+
+				columns = append(append(iop.Columns{}, columns...), newCols...)
+				fieldMap = columns.FieldMap(true)
+			}
+			colMap = lo.Map(current.Columns, func(col iop.Column, i int) int {
+				if j, ok := fieldMap[strings.ToLower(col.Name)]; ok {
+					return j
+				}
+				return -1
+			})
+		}
+
+		closeOnce.Do(func() { close(done); cancelChunks() })
+		return false
+	}
+
+	ds = iop.NewDatastreamIt(queryContext.Ctx, columns, nextFunc)
+	ds.SetConfig(conn.Props())
+	ds.Defer(cancelChunks)
+
+	err = ds.Start()
+	if err != nil {
+		queryContext.Cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+type promChunkResult struct {
+	data iop.Dataset
+	err  error
+}
+
+// promToHourDuration converts the day, week and month units
+// (not supported by time.ParseDuration) to hours
+func promToHourDuration(duration string) string {
+	switch {
+	case strings.HasSuffix(duration, "d"):
+		num := cast.ToInt(strings.TrimSuffix(duration, "d"))
+		duration = g.F("%dh", num*24)
+	case strings.HasSuffix(duration, "w"):
+		num := cast.ToInt(strings.TrimSuffix(duration, "w"))
+		duration = g.F("%dh", num*24*7)
+	case strings.HasSuffix(duration, "M"):
+		num := cast.ToInt(strings.TrimSuffix(duration, "M"))
+		duration = g.F("%dh", num*24*31)
+	}
+	return duration
+}
+
+// promQueryRange parses the `start`, `end` and `step` query options.
+// With the `after` option (the last loaded timestamp, for incremental mode),
+// the range starts at the following step
+func promQueryRange(opts map[string]any) (Range v1.Range, err error) {
+	parseTime := func(key string, defVal time.Time) (time.Time, error) {
+		val := cast.ToString(opts[key])
+		if strings.HasPrefix(val, "now-") {
+			duration := strings.TrimPrefix(val, "now-")
+			delta, err := time.ParseDuration(promToHourDuration(duration))
+			if err != nil {
+				return defVal, g.Error(err, "could not parse duration from %s: %s", key, val)
+			}
+			return time.Now().Add(-1 * delta), nil
+		} else if opts[key] != nil && val != "now" && val != "" {
+			t, err := cast.ToTimeE(opts[key])
+			if err != nil {
+				return defVal, g.Error(err, "could not parse %s value: %s", key, opts[key])
+			}
+			return t, nil
+		}
+		return defVal, nil
+	}
+
+	Range.Start, err = parseTime("start", time.Now().Add(-24*30*time.Hour))
+	if err != nil {
+		return
+	}
+
+	Range.End, err = parseTime("end", time.Now())
+	if err != nil {
+		return
+	}
+
+	Range.Step = time.Hour
+	if opts["step"] != nil {
+		Range.Step, err = time.ParseDuration(promToHourDuration(cast.ToString(opts["step"])))
 		if err != nil {
-			return nil, g.Error(err, "could not parse duration from end: %s", endVal)
+			return Range, g.Error(err, "could not parse step duration: %s", opts["step"])
+		} else if Range.Step <= 0 {
+			return Range, g.Error("step duration must be positive: %s", opts["step"])
 		}
-		end = time.Now().Add(-1 * delta)
-	} else if opts["end"] != nil && opts["end"] != "now" {
-		end, err = cast.ToTimeE(opts["end"])
+	}
+
+	if after := cast.ToString(opts["after"]); after != "" && after != "null" {
+		afterTime, err := cast.ToTimeE(after)
 		if err != nil {
-			return nil, g.Error(err, "could not parse end value: %s", opts["end"])
+			return Range, g.Error(err, "could not parse incremental value: %s", after)
+		}
+		if next := afterTime.Add(Range.Step); next.After(Range.Start) {
+			Range.Start = next
 		}
 	}
 
-	step := time.Hour
-	if opts["step"] != nil {
-		step, err = time.ParseDuration(toHourDuration(cast.ToString(opts["step"])))
+	return
+}
+
+// promRangeChunks splits the range in chunks, so that each series has at most
+// `max_points` points per query (11,000 is the Prometheus limit per series),
+// or in chunks of `chunk_size` if provided
+func promRangeChunks(Range v1.Range, opts map[string]any) (chunks []v1.Range, err error) {
+	if Range.End.Before(Range.Start) {
+		return []v1.Range{Range}, nil
+	}
+
+	maxPoints := cast.ToInt64(opts["max_points"])
+	if maxPoints <= 0 {
+		maxPoints = 11000
+	}
+	chunkSize := Range.Step * time.Duration(maxPoints)
+
+	if val := cast.ToString(opts["chunk_size"]); val != "" {
+		size, err := time.ParseDuration(promToHourDuration(val))
 		if err != nil {
-			return nil, g.Error(err, "could not parse step duration: %s", opts["step"])
+			return nil, g.Error(err, "could not parse chunk_size duration: %s", val)
+		} else if size < chunkSize {
+			chunkSize = size
 		}
 	}
 
-	Range := v1.Range{
-		Start: start,
-		End:   end,
-		Step:  step,
+	// keep chunk boundaries on the step grid, without overlapping points
+	chunkSize = (chunkSize / Range.Step) * Range.Step
+	if chunkSize <= 0 {
+		chunkSize = Range.Step
 	}
-	g.Debug("using range %s", g.Marshal(Range))
-	result, warnings, err := conn.Client.QueryRange(queryContext.Ctx, query, Range)
+
+	for start := Range.Start; !start.After(Range.End); start = start.Add(chunkSize) {
+		end := start.Add(chunkSize - Range.Step)
+		if end.After(Range.End) {
+			end = Range.End
+		}
+		chunks = append(chunks, v1.Range{Start: start, End: end, Step: Range.Step})
+	}
+
+	return
+}
+
+// queryChunk runs the range query for a chunk
+func (conn *PrometheusConn) queryChunk(ctx context.Context, query string, Range v1.Range) (data iop.Dataset, err error) {
+	result, warnings, err := conn.Client.QueryRange(ctx, query, Range)
 	if err != nil {
-		return nil, g.Error(err, "Error querying Prometheus: %s", query)
+		return data, g.Error(err, "could not query range %s", g.Marshal(Range))
 	}
 
 	for _, warning := range warnings {
 		g.Warn(warning)
 	}
 
-	data := iop.NewDataset(iop.Columns{})
-	fieldMap := data.Columns.FieldMap(true)
+	return promResultDataset(result)
+}
 
-	index := func(k string) int { return fieldMap[strings.ToLower(k)] }
+// promColumns returns the columns of the samples, with the labels
+func promColumns(labels []string, histogram bool) iop.Columns {
+	sort.Strings(labels)
+	columns := iop.NewColumnsFromFields(labels...)
+
+	addColumn := func(name string, colType iop.ColumnType) {
+		columns = append(columns, iop.Column{
+			Name:     name,
+			Type:     colType,
+			Position: len(columns) + 1,
+		})
+	}
 
-	if matrix, ok := result.(model.Matrix); ok {
-		for _, sample := range matrix {
+	addColumn("timestamp", iop.TimestampType)
+	if histogram {
+		addColumn("count", iop.DecimalType)
+		addColumn("sum", iop.DecimalType)
+		addColumn("bucket_boundaries", iop.IntegerType)
+		addColumn("bucket_count", iop.DecimalType)
+		addColumn("bucket_lower", iop.DecimalType)
+		addColumn("bucket_upper", iop.DecimalType)
+	} else {
+		addColumn("value", iop.DecimalType)
+	}
 
-			metricMap := map[string]string{}
-			g.Unmarshal(g.Marshal(sample.Metric), &metricMap)
-
-			if len(data.Columns) == 0 {
-				labels := lo.Keys(metricMap)
-				sort.Strings(labels)
-
-				columns := iop.NewColumnsFromFields(labels...)
-
-				if len(sample.Histograms) > 0 {
-					columns = append(columns, iop.Column{
-						Name:     "timestamp",
-						Type:     iop.TimestampType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "count",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "sum",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_boundaries",
-						Type:     iop.IntegerType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_count",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_lower",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_upper",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-				} else {
-					columns = append(columns, iop.Column{
-						Name:     "timestamp",
-						Type:     iop.TimestampType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "value",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-				}
+	return columns
+}
 
-				data = iop.NewDataset(columns)
-				fieldMap = data.Columns.FieldMap(true)
-			}
+// promResultDataset converts a query result to a dataset,
+// with a row per series point
+func promResultDataset(result model.Value) (data iop.Dataset, err error) {
+	data = iop.NewDataset(iop.Columns{})
 
-			row := make([]any, len(data.Columns))
-			for k, v := range metricMap {
-				row[index(k)] = v
+	metricMaps := func(metrics []model.Metric) (maps []map[string]string, labels []string) {
+		labelMap := map[string]bool{}
+		for _, metric := range metrics {
+			metricMap := map[string]string{}
+			g.Unmarshal(g.Marshal(metric), &metricMap)
+			for k := range metricMap {
+				labelMap[k] = true
 			}
+			maps = append(maps, metricMap)
+		}
+		return maps, lo.Keys(labelMap)
+	}
 
+	fieldMap := map[string]int{}
+	index := func(k string) int { return fieldMap[strings.ToLower(k)] }
+	newRow := func(metricMap map[string]string) []any {
+		row := make([]any, len(data.Columns))
+		for k, v := range metricMap {
+			row[index(k)] = v
+		}
+		return row
+	}
+
+	if matrix, ok := result.(model.Matrix); ok {
+		if len(matrix) == 0 {
+			return
+		}
+
+		maps, labels := metricMaps(lo.Map(matrix, func(s *model.SampleStream, i int) model.Metric { return s.Metric }))
+		histogram := lo.ContainsBy(matrix, func(s *model.SampleStream) bool { return len(s.Histograms) > 0 })
+		data = iop.NewDataset(promColumns(labels, histogram))
+		fieldMap = data.Columns.FieldMap(true)
+
+		for i, sample := range matrix {
 			for _, value := range sample.Values {
+				row := newRow(maps[i])
 				row[index("timestamp")] = value.Timestamp.Time()
-				row[index("value")] = cast.ToFloat64(value.Value)
+				if !histogram {
+					row[index("value")] = float64(value.Value)
+				}
+				data.Append(row)
 			}
 
 			for _, value := range sample.Histograms {
+				row := newRow(maps[i])
 				row[index("timestamp")] = value.Timestamp.Time()
-				row[index("count")] = cast.ToFloat64(value.Histogram.Count)
-				row[index("sum")] = cast.ToFloat64(value.Histogram.Sum)
+				row[index("count")] = float64(value.Histogram.Count)
+				row[index("sum")] = float64(value.Histogram.Sum)
 
 				for _, bucket := range value.Histogram.Buckets {
-					row[index("bucket_boundaries")] = cast.ToInt(bucket.Boundaries)
-					row[index("bucket_count")] = cast.ToFloat64(bucket.Count)
-					row[index("bucket_lower")] = cast.ToFloat64(bucket.Lower)
-					row[index("bucket_upper")] = cast.ToFloat64(bucket.Upper)
+					row[index("bucket_boundaries")] = int(bucket.Boundaries)
+					row[index("bucket_count")] = float64(bucket.Count)
+					row[index("bucket_lower")] = float64(bucket.Lower)
+					row[index("bucket_upper")] = float64(bucket.Upper)
 				}
-			}
-
-			data.Append(row)
-			if Limit > 0 && len(data.Rows) >= Limit {
-				break
+				data.Append(row)
 			}
 		}
 	} else if vector, ok := result.(model.Vector); ok {
-		for _, sample := range vector {
-			metricMap := map[string]string{}
-			g.Unmarshal(g.Marshal(sample.Metric), &metricMap)
-
-			if len(data.Columns) == 0 {
-				labels := lo.Keys(metricMap)
-				sort.Strings(labels)
-
-				columns := iop.NewColumnsFromFields(labels...)
-				if sample.Histogram != nil {
-					columns = append(columns, iop.Column{
-						Name:     "timestamp",
-						Type:     iop.TimestampType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "count",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "sum",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_boundaries",
-						Type:     iop.IntegerType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_count",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_lower",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "bucket_upper",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-				} else {
-					columns = append(columns, iop.Column{
-						Name:     "timestamp",
-						Type:     iop.TimestampType,
-						Position: len(columns) + 1,
-					})
-					columns = append(columns, iop.Column{
-						Name:     "value",
-						Type:     iop.DecimalType,
-						Position: len(columns) + 1,
-					})
-				}
+		if len(vector) == 0 {
+			return
+		}
 
-				data = iop.NewDataset(columns)
-				fieldMap = data.Columns.FieldMap(true)
-			}
+		maps, labels := metricMaps(lo.Map(vector, func(s *model.Sample, i int) model.Metric { return s.Metric }))
+		histogram := lo.ContainsBy(vector, func(s *model.Sample) bool { return s.Histogram != nil })
+		data = iop.NewDataset(promColumns(labels, histogram))
+		fieldMap = data.Columns.FieldMap(true)
 
-			row := make([]any, len(data.Columns))
-			for k, v := range metricMap {
-				row[index(k)] = v
-			}
+		for i, sample := range vector {
+			row := newRow(maps[i])
+			row[index("timestamp")] = sample.Timestamp.Time()
 
 			if sample.Histogram != nil {
-				row[index("timestamp")] = sample.Timestamp.Time()
-				row[index("count")] = cast.ToFloat64(sample.Histogram.Count)
-				row[index("sum")] = cast.ToFloat64(sample.Histogram.Sum)
+				row[index("count")] = float64(sample.Histogram.Count)
+				row[index("sum")] = float64(sample.Histogram.Sum)
 
 				for _, bucket := range sample.Histogram.Buckets {
-					row[index("bucket_boundaries")] = cast.ToInt(bucket.Boundaries)
-					row[index("bucket_count")] = cast.ToFloat64(bucket.Count)
-					row[index("bucket_lower")] = cast.ToFloat64(bucket.Lower)
-					row[index("bucket_upper")] = cast.ToFloat64(bucket.Upper)
+					row[index("bucket_boundaries")] = int(bucket.Boundaries)
+					row[index("bucket_count")] = float64(bucket.Count)
+					row[index("bucket_lower")] = float64(bucket.Lower)
+					row[index("bucket_upper")] = float64(bucket.Upper)
 				}
-			} else {
-				row[index("timestamp")] = sample.Timestamp.Time()
-				row[index("value")] = cast.ToFloat64(sample.Value)
+			} else if !histogram {
+				row[index("value")] = float64(sample.Value)
 			}
 
 			data.Append(row)
-			if Limit > 0 && len(data.Rows) >= Limit {
-				break
-			}
 		}
 	} else if scalar, ok := result.(*model.Scalar); ok {
 		data.Columns = iop.Columns{
@@ -435,7 +622,7 @@ func (conn *PrometheusConn) StreamRowsContext(ctx context.Context, query string,
 				Position: 2,
 			},
 		}
-		data.Append([]any{scalar.Timestamp, cast.ToFloat64(scalar.Value)})
+		data.Append([]any{scalar.Timestamp, float64(scalar.Value)})
 	} else if str, ok := result.(*model.String); ok {
 		data.Columns = iop.Columns{
 			{
@@ -451,11 +638,9 @@ func (conn *PrometheusConn) StreamRowsContext(ctx context.Context, query string,
 		}
 		data.Append([]any{str.Timestamp, cast.ToFloat64(str.Value)})
 	} else {
-		return nil, g.Error("invalid result: %#v", result)
+		return data, g.Error("invalid result: %#v", result)
 	}
 
-	ds = data.Stream(conn.Props())
-
 	return
 }
 
@@ -549,3 +734,255 @@ func (conn *PrometheusConn) GetSchemata(schemaName string, tableNames ...string)
 
 	return schemata, nil
 }
+
+// remoteWriteSeries is a series of samples, for the remote-write protocol
+type remoteWriteSeries struct {
+	labels  [][2]string // name and value, sorted by name
+	samples []remoteWriteSample
+}
+
+// remoteWriteSample is a sample, with the timestamp in milliseconds
+type remoteWriteSample struct {
+	value     float64
+	timestamp int64
+}
+
+var (
+	promInvalidLabelChars  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	promInvalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+// BulkImportStream writes the rows of the stream as samples with the
+// remote-write protocol (snappy-compressed protobuf), into Prometheus,
+// Mimir or VictoriaMetrics. The columns are mapped with the properties
+// `timestamp_column` (default `timestamp`), `value_column` (default `value`)
+// and `label_columns` (default the other columns). The metric name is the
+// `metric_name` property, the `__name__` column, or the table name.
+func (conn *PrometheusConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	writeURL := conn.GetProp("remote_write_url")
+	if writeURL == "" && conn.GetProp("http_url") != "" {
+		writeURL = strings.TrimSuffix(conn.GetProp("http_url"), "/") + "/api/v1/write"
+	} else if writeURL == "" {
+		return 0, g.Error("need to provide remote_write_url (or http_url) to write into Prometheus")
+	}
+
+	// map the columns
+	fieldMap := ds.Columns.FieldMap(true)
+	tsColumn := lo.Ternary(conn.GetProp("timestamp_column") != "", conn.GetProp("timestamp_column"), "timestamp")
+	valueColumn := lo.Ternary(conn.GetProp("value_column") != "", conn.GetProp("value_column"), "value")
+
+	tsIndex, ok := fieldMap[strings.ToLower(tsColumn)]
+	if !ok {
+		return 0, g.Error("did not find timestamp column %s", tsColumn)
+	}
+	valueIndex, ok := fieldMap[strings.ToLower(valueColumn)]
+	if !ok {
+		return 0, g.Error("did not find value column %s", valueColumn)
+	}
+
+	labelColumns := []string{}
+	if val := conn.GetProp("label_columns"); val != "" {
+		labelColumns = strings.Split(val, ",")
+	} else {
+		for _, col := range ds.Columns {
+			if !g.In(strings.ToLower(col.Name), strings.ToLower(tsColumn), strings.ToLower(valueColumn)) {
+				labelColumns = append(labelColumns, col.Name)
+			}
+		}
+	}
+
+	labelIndexes := map[string]int{} // label name => column index
+	for _, name := range labelColumns {
+		name = strings.TrimSpace(name)
+		index, ok := fieldMap[strings.ToLower(name)]
+		if !ok {
+			return 0, g.Error("did not find label column %s", name)
+		}
+		labelIndexes[promLabelName(name)] = index
+	}
+	labelNames := lo.Keys(labelIndexes)
+	sort.Strings(labelNames)
+
+	metricName := conn.GetProp("metric_name")
+	if _, ok := labelIndexes["__name__"]; !ok && metricName == "" {
+		metricName = tableFName[strings.LastIndex(tableFName, ".")+1:]
+	}
+	metricName = promInvalidMetricChars.ReplaceAllString(strings.Trim(metricName, "`\"'"), "_")
+
+	batchSize := cast.ToInt(conn.GetProp("batch_size"))
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	// samples are grouped into series, and sent in batches
+	seriesMap := map[string]*remoteWriteSeries{}
+	seriesList := []*remoteWriteSeries{}
+	batchCount := 0
+
+	flush := func() error {
+		if batchCount == 0 {
+			return nil
+		}
+		if err := conn.remoteWrite(writeURL, seriesList); err != nil {
+			return err
+		}
+		count += uint64(batchCount)
+		seriesMap = map[string]*remoteWriteSeries{}
+		seriesList = []*remoteWriteSeries{}
+		batchCount = 0
+		return nil
+	}
+
+	for row := range ds.Rows() {
+		if row[valueIndex] == nil || row[tsIndex] == nil {
+			continue // prometheus has no null values
+		}
+
+		value, err := cast.ToFloat64E(row[valueIndex])
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "invalid value: %#v", row[valueIndex]))
+			return count, ds.Context.Err()
+		}
+
+		timestamp, err := cast.ToTimeE(row[tsIndex])
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "invalid timestamp: %#v", row[tsIndex]))
+			return count, ds.Context.Err()
+		}
+
+		labels := make([][2]string, 0, len(labelNames)+1)
+		if metricName != "" {
+			labels = append(labels, [2]string{"__name__", metricName})
+		}
+		for _, name := range labelNames {
+			// empty labels are the same as missing labels
+			if val := cast.ToString(row[labelIndexes[name]]); val != "" {
+				labels = append(labels, [2]string{name, val})
+			}
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+		key := g.Marshal(labels)
+		series, ok := seriesMap[key]
+		if !ok {
+			series = &remoteWriteSeries{labels: labels}
+			seriesMap[key] = series
+			seriesList = append(seriesList, series)
+		}
+		series.samples = append(series.samples, remoteWriteSample{value: value, timestamp: timestamp.UnixMilli()})
+
+		batchCount++
+		if batchCount >= batchSize {
+			if err = flush(); err != nil {
+				ds.Context.CaptureErr(err)
+				return count, ds.Context.Err()
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		ds.Context.CaptureErr(err)
+		return count, ds.Context.Err()
+	}
+
+	if ds.Err() != nil {
+		return count, g.Error(ds.Err(), "context error")
+	}
+	return count, nil
+}
+
+// remoteWrite sends the series to the remote-write endpoint. Server errors
+// are retried, client errors (such as out of order samples) are not.
+func (conn *PrometheusConn) remoteWrite(writeURL string, seriesList []*remoteWriteSeries) (err error) {
+	for _, series := range seriesList {
+		sort.SliceStable(series.samples, func(i, j int) bool {
+			return series.samples[i].timestamp < series.samples[j].timestamp
+		})
+	}
+	payload := snappy.Encode(nil, encodeWriteRequest(seriesList))
+
+	ctx := conn.Context().Ctx
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL, bytes.NewReader(payload))
+		if err != nil {
+			return g.Error(err, "could not create remote-write request")
+		}
+
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		if token := conn.GetProp("token"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if user := conn.GetProp("user"); user != "" {
+			req.SetBasicAuth(user, conn.GetProp("password"))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				return nil
+			}
+
+			err = g.Error("remote-write returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+			if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+				return err
+			}
+		}
+
+		if attempt >= 3 {
+			return g.Error(err, "could not remote-write %d series", len(seriesList))
+		}
+
+		g.Debug("remote-write attempt %d failed, retrying: %s", attempt, err.Error())
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return g.Error(ctx.Err(), "could not remote-write %d series", len(seriesList))
+		}
+	}
+}
+
+// encodeWriteRequest encodes the series as a prometheus.WriteRequest protobuf
+// message (see prometheus/prompb/remote.proto)
+func encodeWriteRequest(seriesList []*remoteWriteSeries) (b []byte) {
+	for _, series := range seriesList {
+		var ts []byte
+		for _, label := range series.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, label[0])
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, label[1])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		for _, sample := range series.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(sample.value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(sample.timestamp))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
+
+// promLabelName replaces the characters not allowed in label names
+func promLabelName(name string) string {
+	name = promInvalidLabelChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
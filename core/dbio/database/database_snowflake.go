@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 	"sync"
 
@@ -221,17 +222,21 @@ func (conn *SnowflakeConn) BulkExportFlow(tables ...Table) (df *iop.Dataflow, er
 			err = g.Error(err, "Could not copy to S3.")
 			return
 		}
-	// case "STAGE":
-	// 	// TODO: This is not working, buggy driver. Use SQL Rows stream
-	// 	if stage := conn.getOrCreateStage(tables[0].Schema); stage != "" {
-	// 		filePath, err = conn.UnloadViaStage(tables...)
-	// 		if err != nil {
-	// 			err = g.Error(err, "Could not unload to stage.")
-	// 			return
-	// 		}
-	// 	} else {
-	// 		return conn.BaseConn.BulkExportFlow(tables...)
-	// 	}
+	case "STAGE":
+		// unload to parquet files, which keeps the types. With csv, stream the
+		// rows since the unload is not working with the buggy driver
+		var format filesys.FileType
+		if format, err = conn.copyFormat(); err != nil {
+			return df, err
+		} else if format != filesys.FileTypeParquet || conn.getOrCreateStage(tables[0].Schema) == "" {
+			return conn.BaseConn.BulkExportFlow(tables...)
+		}
+
+		filePath, err = conn.UnloadViaStage(tables...)
+		if err != nil {
+			return df, g.Error(err, "Could not unload to stage.")
+		}
+		filePath = "file://" + filePath
 	default:
 		return conn.BaseConn.BulkExportFlow(tables...)
 	}
@@ -242,8 +247,12 @@ func (conn *SnowflakeConn) BulkExportFlow(tables ...Table) (df *iop.Dataflow, er
 		return
 	}
 
-	fs.SetProp("header", "false")
-	fs.SetProp("format", "csv")
+	if conn.CopyMethod == "STAGE" {
+		fs.SetProp("format", "parquet")
+	} else {
+		fs.SetProp("header", "false")
+		fs.SetProp("format", "csv")
+	}
 	fs.SetProp("columns", g.Marshal(columns))
 	fs.SetProp("metadata", conn.GetProp("metadata"))
 	df, err = fs.ReadDataflow(filePath)
@@ -599,6 +608,16 @@ func (conn *SnowflakeConn) UnloadViaStage(tables ...Table) (filePath string, err
 		cast.ToString(g.Now()),
 	)
 
+	format, err := conn.copyFormat()
+	if err != nil {
+		return
+	}
+
+	templateKey := "copy_to_stage"
+	if format == filesys.FileTypeParquet {
+		templateKey = "copy_to_stage_parquet"
+	}
+
 	context := g.NewContext(conn.Context().Ctx)
 
 	// Write the each stage file to temp file, read to ds
@@ -608,7 +627,7 @@ func (conn *SnowflakeConn) UnloadViaStage(tables ...Table) (filePath string, err
 		defer context.Wg.Write.Done()
 
 		unloadSQL := g.R(
-			conn.template.Core["copy_to_stage"],
+			conn.template.Core[templateKey],
 			"sql", sql,
 			"stage_path", stagePartPath,
 		)
@@ -672,7 +691,20 @@ func (conn *SnowflakeConn) UnloadViaStage(tables ...Table) (filePath string, err
 // https://docs.snowflake.com/en/sql-reference/sql/copy-into-table.html
 func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 
-	context := g.NewContext(conn.Context().Ctx)
+	format, err := conn.copyFormat()
+	if err != nil {
+		return 0, err
+	} else if format == filesys.FileTypeParquet {
+		format = parquetStageFormat(df.Columns)
+	}
+
+	// the number of concurrent PUT commands
+	putConcurrency := cast.ToInt(conn.GetProp("put_concurrency"))
+	if putConcurrency <= 0 {
+		putConcurrency = runtime.NumCPU()
+	}
+
+	context := g.NewContext(conn.Context().Ctx, putConcurrency)
 
 	if conn.GetProp("internalStage") == "" {
 		return 0, g.Error("Prop internalStage is required")
@@ -703,6 +735,12 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 			return
 		}
 
+		if format == filesys.FileTypeParquet {
+			fs.SetProp("FORMAT", "parquet")
+			fs.SetProp("USE_ARROW_PARQUET", "true")
+			fs.SetProp("COMPRESSION", "SNAPPY")
+		}
+
 		_, err = fs.WriteDataflowReady(df, folderPath, fileReadyChn, iop.DefaultStreamConfig())
 
 		if err != nil {
@@ -733,7 +771,7 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 			defer os.Remove(file.Node.Path())
 		}
 		os.Chmod(file.Node.Path(), 0777) // make file readeable everywhere
-		err = conn.PutFile(file.Node.URI, stageFolderPath)
+		err := conn.PutFile(file.Node.URI, stageFolderPath)
 		if err != nil {
 			df.Context.CaptureErr(g.Error(err, "Error copying to Snowflake Stage: "+conn.GetProp("internalStage")))
 		}
@@ -756,25 +794,8 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 			return
 		}
 
-		tgtColumns := make([]string, len(file.Columns))
-		for i, name := range file.Columns.Names() {
-			colName, _ := ParseColumnName(name, conn.GetType())
-			tgtColumns[i] = conn.Quote(colName)
-		}
-
-		srcColumns := make([]string, len(file.Columns))
-		for i := range file.Columns {
-			srcColumns[i] = g.F("T.$%d", i+1)
-		}
-
-		sql := g.R(
-			conn.template.Core["copy_from_stage"],
-			"table", tableFName,
-			"tgt_columns", strings.Join(tgtColumns, ", "),
-			"src_columns", strings.Join(srcColumns, ", "),
-			"stage_path", stageFilePath,
-		)
-		_, err = conn.Exec(sql)
+		sql := conn.copyFromStageSQL(tableFName, stageFilePath, file.Columns, format)
+		_, err := conn.Exec(sql)
 		if err != nil {
 			err = g.Error(err, "Error with COPY INTO")
 			df.Context.CaptureErr(err)
@@ -788,24 +809,7 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 			return
 		}
 
-		tgtColumns := make([]string, len(df.Columns))
-		for i, name := range df.Columns.Names() {
-			colName, _ := ParseColumnName(name, conn.GetType())
-			tgtColumns[i] = conn.Quote(colName)
-		}
-
-		srcColumns := make([]string, len(df.Columns))
-		for i := range df.Columns {
-			srcColumns[i] = g.F("T.$%d", i+1)
-		}
-
-		sql := g.R(
-			conn.template.Core["copy_from_stage"],
-			"table", tableFName,
-			"tgt_columns", strings.Join(tgtColumns, ", "),
-			"src_columns", strings.Join(srcColumns, ", "),
-			"stage_path", stageFolderPath,
-		)
+		sql := conn.copyFromStageSQL(tableFName, stageFolderPath, df.Columns, format)
 		data, err := conn.Query(sql)
 		if err != nil {
 			err = g.Error(err, "Error with COPY INTO")
@@ -842,6 +846,70 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 	return df.Count(), nil
 }
 
+// copyFormat returns the format of the stage files from the `copy_format`
+// property: csv (default) or parquet, which keeps the types of the
+// semi-structured, decimal and timestamp columns
+func (conn *SnowflakeConn) copyFormat() (format filesys.FileType, err error) {
+	switch name := strings.ToLower(conn.GetProp("copy_format")); name {
+	case "", "csv":
+		return filesys.FileTypeCsv, nil
+	case "parquet":
+		return filesys.FileTypeParquet, nil
+	default:
+		return format, g.Error("invalid copy_format '%s', expecting csv or parquet", name)
+	}
+}
+
+// parquetStageFormat returns csv if a decimal column has no known precision,
+// since the parquet decimals have a fixed precision and scale, which
+// would round the values
+func parquetStageFormat(columns iop.Columns) filesys.FileType {
+	for _, col := range columns {
+		if col.Type == iop.DecimalType && col.DbPrecision == 0 {
+			g.Debug("staging as csv, the precision of decimal column %s is unknown", col.Name)
+			return filesys.FileTypeCsv
+		}
+	}
+	return filesys.FileTypeParquet
+}
+
+// copyFromStageSQL returns the COPY INTO statement of the stage files.
+// The parquet files are loaded by column name, or with a select
+// parsing the JSON columns into VARIANT values.
+func (conn *SnowflakeConn) copyFromStageSQL(tableFName, stagePath string, columns iop.Columns, format filesys.FileType) string {
+	hasJSON := false
+	tgtColumns := make([]string, len(columns))
+	srcColumns := make([]string, len(columns))
+	for i, col := range columns {
+		colName, _ := ParseColumnName(col.Name, conn.GetType())
+		tgtColumns[i] = conn.Quote(colName)
+		srcColumns[i] = g.F("T.$%d", i+1)
+
+		if format == filesys.FileTypeParquet {
+			srcColumns[i] = g.F(`T.$1:"%s"`, strings.ReplaceAll(col.Name, `"`, `""`))
+			if col.Type == iop.JsonType {
+				srcColumns[i] = g.F("PARSE_JSON(%s::string)", srcColumns[i])
+				hasJSON = true
+			}
+		}
+	}
+
+	templateKey := "copy_from_stage"
+	if format == filesys.FileTypeParquet && hasJSON {
+		templateKey = "copy_from_stage_parquet_select"
+	} else if format == filesys.FileTypeParquet {
+		templateKey = "copy_from_stage_parquet"
+	}
+
+	return g.R(
+		conn.template.Core[templateKey],
+		"table", tableFName,
+		"tgt_columns", strings.Join(tgtColumns, ", "),
+		"src_columns", strings.Join(srcColumns, ", "),
+		"stage_path", stagePath,
+	)
+}
+
 // GetFile Copies from a staging location to a local file or folder
 func (conn *SnowflakeConn) GetFile(internalStagePath, fPath string) (err error) {
 	query := g.F(
@@ -2,6 +2,7 @@ package database
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,6 +10,8 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio"
@@ -19,6 +22,7 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
 	"github.com/flarco/g/net"
+	mssql "github.com/microsoft/go-mssqldb"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/spf13/cast"
 	"github.com/xo/dburl"
@@ -193,15 +197,18 @@ func (conn *MsSQLServerConn) BulkImportFlow(tableFName string, df *iop.Dataflow)
 func (conn *MsSQLServerConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	conn.Commit() // cannot have transaction lock table
 
-	// return conn.BaseConn.InsertBatchStream(tableFName, ds)
-	_, err = exec.LookPath("bcp")
-	if err != nil {
-		g.Trace("bcp not found in path. Using cursor...")
-		return conn.BaseConn.InsertBatchStream(tableFName, ds)
-	} else if conn.GetProp("allow_bulk_import") != "true" {
+	if conn.GetProp("allow_bulk_import") != "true" {
 		return conn.BaseConn.InsertBatchStream(tableFName, ds)
 	}
 
+	// the bcp utility is opt-in, the bulk copy of the driver is used otherwise
+	if !cast.ToBool(conn.GetProp("use_bcp")) {
+		return conn.CopyInStream(tableFName, ds)
+	} else if _, err = exec.LookPath("bcp"); err != nil {
+		g.Warn("bcp not found in path. Using bulk copy...")
+		return conn.CopyInStream(tableFName, ds)
+	}
+
 	// needs to get columns to shape stream
 	columns, err := conn.GetColumns(tableFName)
 	if err != nil {
@@ -218,6 +225,175 @@ func (conn *MsSQLServerConn) BulkImportStream(tableFName string, ds *iop.Datastr
 	return conn.BcpImportFileParrallel(tableFName, ds)
 }
 
+// CopyInStream imports the stream with the bulk copy of the driver (mssql.CopyIn),
+// in batches of `bulk_copy_batch_size` rows (50000 by default) copied over
+// `bulk_copy_sessions` concurrent sessions (the number of CPUs by default)
+func (conn *MsSQLServerConn) CopyInStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	var columns iop.Columns
+
+	table, err := ParseTableName(tableFName, conn.GetType())
+	if err != nil {
+		err = g.Error(err, "could not get table name for import")
+		return
+	}
+
+	batchSize := cast.ToInt(conn.GetProp("bulk_copy_batch_size"))
+	if batchSize <= 0 {
+		batchSize = 50000
+	}
+
+	sessions := cast.ToInt(conn.GetProp("bulk_copy_sessions"))
+	if sessions <= 0 {
+		sessions = runtime.NumCPU()
+	}
+	sessCtx := g.NewContext(ds.Context.Ctx, sessions)
+
+	doCopy := func(columns iop.Columns, rows [][]any) {
+		defer sessCtx.Wg.Write.Done()
+
+		cnt, err := conn.copyIn(sessCtx.Ctx, table, columns, rows)
+		atomic.AddUint64(&count, cnt)
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not bulk copy into table %s", tableFName))
+			ds.Context.Cancel()
+		}
+	}
+
+	for batch := range ds.BatchChan {
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			ds.Context.Lock()
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			ds.Context.Unlock()
+			if err != nil {
+				return count, g.Error(err, "could not get matching list of columns from table")
+			}
+
+			err = batch.Shape(columns)
+			if err != nil {
+				return count, g.Error(err, "could not shape batch stream")
+			}
+		}
+
+		rows := make([][]any, 0, batchSize)
+		for row := range batch.Rows {
+			rows = append(rows, row)
+			if len(rows) == batchSize {
+				sessCtx.Wg.Write.Add()
+				go doCopy(columns, rows)
+				rows = make([][]any, 0, batchSize)
+			}
+		}
+
+		if len(rows) > 0 {
+			sessCtx.Wg.Write.Add()
+			go doCopy(columns, rows)
+		}
+	}
+
+	sessCtx.Wg.Write.Wait()
+
+	return count, ds.Err()
+}
+
+// copyIn copies the rows into the table in a transaction
+func (conn *MsSQLServerConn) copyIn(ctx context.Context, table Table, columns iop.Columns, rows [][]any) (count uint64, err error) {
+	tx, err := conn.Db().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, g.Error(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	options := mssql.BulkOptions{KeepNulls: true, RowsPerBatch: len(rows)}
+	stmt, err := tx.PrepareContext(ctx, mssql.CopyIn(table.FullName(), options, columns.Names()...))
+	if err != nil {
+		return 0, g.Error(err, "could not prepare bulk copy")
+	}
+	defer stmt.Close()
+
+	values := make([]any, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			var val any
+			if i < len(row) {
+				val = row[i]
+			}
+			if values[i], err = mssqlCopyValue(col, val); err != nil {
+				return 0, err
+			}
+		}
+
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			return 0, g.Error(err, "could not add row to bulk copy")
+		}
+	}
+
+	// executing without values sends the rows
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, g.Error(err, "could not execute bulk copy")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, g.Error(err, "could not commit bulk copy")
+	}
+
+	affected, _ := result.RowsAffected()
+	return cast.ToUint64(affected), nil
+}
+
+// mssqlCopyValue converts the value to the type expected by the
+// bulk copy for the column, from the database type
+func mssqlCopyValue(col iop.Column, val any) (value any, err error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	switch strings.ToLower(col.DbType) {
+	case "tinyint", "smallint", "int", "bigint":
+		value, err = cast.ToInt64E(val)
+	case "float", "real":
+		value, err = cast.ToFloat64E(val)
+	case "decimal", "numeric":
+		value, err = cast.ToStringE(val)
+	case "bit":
+		value, err = cast.ToBoolE(val)
+	case "date", "datetime", "datetime2", "smalldatetime", "datetimeoffset":
+		value, err = cast.ToTimeE(val)
+	case "time":
+		if v, ok := val.(string); ok {
+			return v, nil // such as 15:04:05.999
+		}
+		value, err = cast.ToTimeE(val)
+	case "uniqueidentifier":
+		var uuid mssql.UniqueIdentifier
+		if err = uuid.Scan(cast.ToString(val)); err == nil {
+			value, err = uuid.Value()
+		}
+	case "binary", "varbinary", "image":
+		if v, ok := val.([]byte); ok {
+			return v, nil
+		}
+		var str string
+		str, err = cast.ToStringE(val)
+		value = []byte(str)
+	default:
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format("2006-01-02 15:04:05.0000000"), nil
+		case map[string]any, []any:
+			return g.Marshal(v), nil
+		}
+		value, err = cast.ToStringE(val)
+	}
+
+	if err != nil {
+		return nil, g.Error(err, "could not convert value of column %s (%s)", col.Name, col.DbType)
+	}
+	return value, nil
+}
+
 // BcpImportFileParrallel uses goroutine to import partitioned files
 func (conn *MsSQLServerConn) BcpImportFileParrallel(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	fileRowLimit := cast.ToInt(conn.GetProp("FILE_MAX_ROWS"))
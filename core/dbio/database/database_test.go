@@ -1447,3 +1447,36 @@ func TestInteractiveMotherDuck(t *testing.T) {
 		log.Fatalln("Error while running :", err)
 	}
 }
+
+func TestInsertBatchStreamRowErrors(t *testing.T) {
+	conn, err := NewConn("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`create table main.row_errors (id integer primary key, name text)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data := iop.NewDataset(iop.NewColumnsFromFields("id", "name"))
+	data.Rows = [][]any{{1, "a"}, {2, "b"}, {2, "c"}, {4, "d"}, {4, "e"}}
+	ds := data.Stream()
+	ds.Sp.Config.OnRowError = iop.RowErrorModeDeadLetter
+
+	count, err := conn.InsertBatchStream("main.row_errors", ds)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 3, count)
+		rowErrs := ds.RowErrors()
+		if assert.Len(t, rowErrs, 2) {
+			assert.EqualValues(t, 3, rowErrs[0].RowNum)
+			assert.EqualValues(t, 5, rowErrs[1].RowNum)
+			assert.Equal(t, "e", rowErrs[1].Row[1])
+		}
+	}
+
+	cols := iop.NewColumnsFromFields("id", "name")
+	assert.Equal(t, "id", rowErrorColumn(cols, `Incorrect integer value: 'abc' for column 'ID' at row 1`))
+	assert.Equal(t, "", rowErrorColumn(cols, `UNIQUE constraint failed: row_errors.id`))
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/jackc/pgtype"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresCopyTextValues(t *testing.T) {
+	columns := iop.Columns{
+		{Name: "id", Type: iop.BigIntType},
+		{Name: "name", Type: iop.StringType},
+		{Name: "note", Type: iop.TextType},
+		{Name: "created_at", Type: iop.TimestampzType},
+		{Name: "payload", Type: iop.BinaryType},
+	}
+	sp := iop.NewStreamProcessor()
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+
+	values := pgCopyTextValues(sp, columns, []any{1, `say "hi"`, "", ts, []byte{0xde, 0xad}})
+	assert.Equal(t, []any{"1", `say "hi"`, "", "2024-01-02 03:04:05.123456 +00", []byte{0xde, 0xad}}, values)
+
+	// empty strings are kept, zero timestamps are nulls
+	values = pgCopyTextValues(sp, columns, []any{2, nil, "a,b\nc", time.Time{}, nil})
+	assert.Equal(t, []any{"2", nil, "a,b\nc", nil, nil}, values)
+}
+
+func TestPostgresCopyBinaryTuple(t *testing.T) {
+	columns := iop.Columns{
+		{Name: "id", Type: iop.BigIntType},
+		{Name: "amount", Type: iop.DecimalType},
+		{Name: "payload", Type: iop.BinaryType},
+		{Name: "tags", Type: iop.JsonType},
+		{Name: "data", Type: iop.JsonType},
+		{Name: "created_at", Type: iop.TimestampzType},
+		{Name: "note", Type: iop.StringType},
+	}
+	typeNames := []string{"int8", "numeric", "bytea", "_int4", "jsonb", "timestamptz", "text"}
+	values := make([]pgtype.Value, len(typeNames))
+	for i, name := range typeNames {
+		dataType, ok := pgCopyConnInfo.DataTypeForName(name)
+		if !assert.True(t, ok, name) {
+			return
+		}
+		values[i] = pgtype.NewValue(dataType.Value)
+	}
+
+	sp := iop.NewStreamProcessor()
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	row := []any{int64(7), "12345678901234567890.123456789", []byte{0, 1, 2}, "[1,2,3]", `{"a": 1}`, "2024-01-02 03:04:05.123456", nil}
+
+	buf, err := pgCopyBinaryTuple(nil, sp, columns, values, row)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// decode the fields with the column types, as the server would
+	if !assert.Equal(t, uint16(len(row)), binary.BigEndian.Uint16(buf)) {
+		return
+	}
+	buf = buf[2:]
+
+	decoded := make([]any, len(row))
+	for i, name := range typeNames {
+		size := int32(binary.BigEndian.Uint32(buf))
+		buf = buf[4:]
+		if size < 0 {
+			continue
+		}
+
+		dataType, _ := pgCopyConnInfo.DataTypeForName(name)
+		value := pgtype.NewValue(dataType.Value)
+		if !assert.NoError(t, value.(pgtype.BinaryDecoder).DecodeBinary(pgCopyConnInfo, buf[:size]), name) {
+			return
+		}
+		buf = buf[size:]
+
+		text, err := value.(pgtype.TextEncoder).EncodeText(pgCopyConnInfo, nil)
+		assert.NoError(t, err)
+		decoded[i] = string(text)
+	}
+	assert.Empty(t, buf)
+
+	assert.Equal(t, []any{
+		"7",
+		"12345678901234567890123456789e-9", // no precision lost
+		`\x000102`,
+		"{1,2,3}",
+		`{"a": 1}`,
+		ts.Format("2006-01-02 15:04:05.999999Z07:00:00"),
+		nil,
+	}, decoded)
+}
+
+func TestPostgresCopyURL(t *testing.T) {
+	assert.Equal(t, "postgresql://u:p@host:5432/db?sslmode=require", pgCopyURL("postgresql://u:p@host:5432/db"))
+	assert.Equal(t, "postgresql://u:p@host:5432/db?a=1&sslmode=require", pgCopyURL("postgresql://u:p@host:5432/db?a=1"))
+	assert.Equal(t, "postgresql://u:p@host:5432/db?sslmode=disable", pgCopyURL("postgresql://u:p@host:5432/db?sslmode=disable"))
+	assert.Equal(t, "host=localhost dbname=db sslmode=require", pgCopyURL("host=localhost dbname=db"))
+}
+
+func benchmarkPostgresCopyRows(n int) (columns iop.Columns, rows [][]any) {
+	columns = iop.Columns{
+		{Name: "id", Type: iop.BigIntType},
+		{Name: "name", Type: iop.StringType},
+		{Name: "amount", Type: iop.DecimalType},
+		{Name: "created_at", Type: iop.TimestampzType},
+		{Name: "payload", Type: iop.BinaryType},
+	}
+	for i := 0; i < n; i++ {
+		ts := time.Date(2024, 1, 1, 0, 0, i%60, i, time.UTC)
+		rows = append(rows, []any{int64(i), g.F("name %d", i), float64(i) / 7, ts, []byte(g.F("payload %d", i))})
+	}
+	return
+}
+
+// BenchmarkPostgresCopyEncode compares the encoding cost of the COPY formats
+func BenchmarkPostgresCopyEncode(b *testing.B) {
+	columns, rows := benchmarkPostgresCopyRows(1000)
+	sp := iop.NewStreamProcessor()
+
+	b.Run("csv", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, row := range rows {
+				pgCopyTextValues(sp, columns, row)
+			}
+		}
+	})
+
+	b.Run("binary", func(b *testing.B) {
+		values := []pgtype.Value{&pgtype.Int8{}, &pgtype.Text{}, &pgtype.Numeric{}, &pgtype.Timestamptz{}, &pgtype.Bytea{}}
+		buf := []byte{}
+		for n := 0; n < b.N; n++ {
+			for _, row := range rows {
+				buf, _ = pgCopyBinaryTuple(buf[:0], sp, columns, values, row)
+			}
+		}
+	})
+}
+
+// BenchmarkPostgresCopy loads rows with each COPY format into a local
+// Postgres, such as: POSTGRES_URL=postgres://... go test -bench PostgresCopy -run none
+func BenchmarkPostgresCopy(b *testing.B) {
+	if PostgresURL == "" {
+		b.Skip("POSTGRES_URL is not set")
+	}
+
+	columns, rows := benchmarkPostgresCopyRows(100000)
+	for _, format := range []string{"csv", "binary"} {
+		b.Run(format, func(b *testing.B) {
+			conn, err := NewConn(PostgresURL, "copy_format="+format)
+			if !assert.NoError(b, err) || !assert.NoError(b, conn.Connect()) {
+				return
+			}
+			defer conn.Close()
+
+			table := "public.sling_copy_bench_" + format
+			conn.DropTable(table)
+			_, err = conn.Exec(g.F("create table %s (id bigint, name text, amount numeric, created_at timestamptz, payload bytea)", table))
+			if !assert.NoError(b, err) {
+				return
+			}
+			defer conn.DropTable(table)
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				data := iop.NewDataset(columns)
+				data.Rows = rows
+				df, err := iop.MakeDataFlow(data.Stream())
+				if !assert.NoError(b, err) {
+					return
+				}
+				_, err = conn.BulkImportFlow(table, df)
+				assert.NoError(b, err)
+			}
+			b.ReportMetric(float64(len(rows)*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/golang/snappy"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestPrometheusRemoteWrite(t *testing.T) {
+	// stand-in remote-write receiver
+	received := []*remoteWriteSeries{}
+	requests := 0
+	mux := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+
+		body, _ := io.ReadAll(r.Body)
+		payload, err := snappy.Decode(nil, body)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mux.Lock()
+		requests++
+		received = append(received, decodeWriteRequest(t, payload)...)
+		mux.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	conn, err := NewConn("prometheus://localhost", "remote_write_url="+server.URL+"/api/v1/write", "token=my-token", "batch_size=2")
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := iop.NewDataset(iop.Columns{
+		{Name: "job", Type: iop.StringType},
+		{Name: "instance-name", Type: iop.StringType},
+		{Name: "timestamp", Type: iop.TimestampType},
+		{Name: "value", Type: iop.DecimalType},
+	})
+	data.Append([]any{"api", "host1", ts.Add(time.Minute), 2.5})
+	data.Append([]any{"api", "host1", ts, 1.5})
+	data.Append([]any{"api", "host2", ts, 3.0})
+	data.Append([]any{"api", "", ts, nil}) // null values are skipped
+	data.Append([]any{"web", "", ts, 4.0})
+
+	df, err := iop.MakeDataFlow(data.Stream())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	count, err := conn.BulkImportFlow(`"prometheus"."sling_test_metric"`, df)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, 4, count)
+	assert.Equal(t, 2, requests) // batches of 2 samples
+
+	labels := []string{}
+	samples := map[string][]remoteWriteSample{}
+	for _, series := range received {
+		pairs := []string{}
+		for _, label := range series.labels {
+			pairs = append(pairs, label[0]+"="+label[1])
+		}
+		key := strings.Join(pairs, ",")
+		labels = append(labels, key)
+		samples[key] = append(samples[key], series.samples...)
+	}
+
+	assert.Equal(t, []string{
+		"__name__=sling_test_metric,instance_name=host1,job=api",
+		"__name__=sling_test_metric,instance_name=host2,job=api",
+		"__name__=sling_test_metric,job=web",
+	}, labels)
+
+	// samples of a series are sent in time order
+	assert.Equal(t, []remoteWriteSample{
+		{value: 1.5, timestamp: ts.UnixMilli()},
+		{value: 2.5, timestamp: ts.Add(time.Minute).UnixMilli()},
+	}, samples["__name__=sling_test_metric,instance_name=host1,job=api"])
+}
+
+// decodeWriteRequest decodes the series of a prometheus.WriteRequest message
+func decodeWriteRequest(t *testing.T, b []byte) (seriesList []*remoteWriteSeries) {
+	fields := func(b []byte, handle func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if !assert.GreaterOrEqual(t, n, 0) {
+				return
+			}
+			b = b[n:]
+			n = handle(num, typ, b)
+			if !assert.GreaterOrEqual(t, n, 0) {
+				return
+			}
+			b = b[n:]
+		}
+	}
+
+	fields(b, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		tsBytes, n := protowire.ConsumeBytes(b)
+		series := &remoteWriteSeries{}
+		fields(tsBytes, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+			if num == 1 {
+				label := [2]string{}
+				fields(msg, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					val, n := protowire.ConsumeString(b)
+					label[num-1] = val
+					return n
+				})
+				series.labels = append(series.labels, label)
+			} else {
+				sample := remoteWriteSample{}
+				fields(msg, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					if num == 1 {
+						val, n := protowire.ConsumeFixed64(b)
+						sample.value = math.Float64frombits(val)
+						return n
+					}
+					val, n := protowire.ConsumeVarint(b)
+					sample.timestamp = int64(val)
+					return n
+				})
+				series.samples = append(series.samples, sample)
+			}
+			return n
+		})
+		seriesList = append(seriesList, series)
+		return n
+	})
+	return
+}
+
+func TestPrometheusRangeChunks(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	Range, err := promQueryRange(g.M("start", "2024-01-01", "end", "2024-01-02", "step", "1m"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, start, Range.Start)
+		assert.Equal(t, start.Add(24*time.Hour), Range.End)
+		assert.Equal(t, time.Minute, Range.Step)
+	}
+
+	// incremental, resumes at the step after the last loaded timestamp
+	Range, err = promQueryRange(g.M("start", "2024-01-01", "end", "2024-01-02", "step", "1m", "after", "2024-01-01 12:00:00.000"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, start.Add(12*time.Hour+time.Minute), Range.Start)
+	}
+
+	// 1441 points, in chunks of 500 points max
+	Range, _ = promQueryRange(g.M("start", "2024-01-01", "end", "2024-01-02", "step", "1m"))
+	chunks, err := promRangeChunks(Range, g.M("max_points", 500))
+	if assert.NoError(t, err) && assert.Len(t, chunks, 3) {
+		assert.Equal(t, start, chunks[0].Start)
+		assert.Equal(t, start.Add(499*time.Minute), chunks[0].End)
+		assert.Equal(t, start.Add(500*time.Minute), chunks[1].Start)
+		assert.Equal(t, start.Add(1000*time.Minute), chunks[2].Start)
+		assert.Equal(t, Range.End, chunks[2].End)
+	}
+
+	chunks, err = promRangeChunks(Range, g.M("chunk_size", "6h"))
+	if assert.NoError(t, err) {
+		assert.Len(t, chunks, 5) // the last one is the end point
+	}
+}
+
+func TestPrometheusChunkedRead(t *testing.T) {
+	// stand-in query API, returning a point per step for two series
+	queries := 0
+	mux := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		start := time.Unix(cast.ToInt64(cast.ToFloat64(r.Form.Get("start"))), 0)
+		end := time.Unix(cast.ToInt64(cast.ToFloat64(r.Form.Get("end"))), 0)
+		step, _ := time.ParseDuration(r.Form.Get("step") + "s")
+
+		mux.Lock()
+		queries++
+		mux.Unlock()
+
+		result := []any{}
+		for _, job := range []string{"api", "web"} {
+			values := [][]any{}
+			for ts := start; !ts.After(end); ts = ts.Add(step) {
+				values = append(values, []any{ts.Unix(), cast.ToString(ts.Unix())})
+			}
+			result = append(result, g.M("metric", g.M("__name__", "up", "job", job), "values", values))
+		}
+
+		// a series with another label, only from 05:00
+		if dbStart := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC); !start.Before(dbStart) {
+			values := [][]any{}
+			for ts := start; !ts.After(end); ts = ts.Add(step) {
+				values = append(values, []any{ts.Unix(), "1"})
+			}
+			result = append(result, g.M("metric", g.M("__name__", "up", "job", "db", "instance", "db1"), "values", values))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(g.Marshal(g.M("status", "success", "data", g.M("resultType", "matrix", "result", result)))))
+	}))
+	defer server.Close()
+
+	conn, err := NewConn("prometheus://localhost", "http_url="+server.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	promConn := conn.(*PrometheusConn)
+	promConn.Client, err = promConn.getNewClient()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ds, err := conn.StreamRows("up", g.M("start", "2024-01-01", "end", "2024-01-01T10:00:00Z", "step", "1m", "max_points", 100, "concurrency", 3))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, err := ds.Collect(0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 7, queries)
+	assert.Equal(t, []string{"__name__", "job", "timestamp", "value", "instance"}, data.Columns.Names())
+	assert.Len(t, data.Rows, 601*2+301)
+
+	// the label of the later chunks is kept
+	dbRows := lo.Filter(data.Rows, func(row []any, i int) bool { return row[1] == "db" })
+	if assert.Len(t, dbRows, 301) {
+		assert.Equal(t, "db1", dbRows[0][4])
+	}
+
+	// chunks are streamed in order
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := start.Add(-time.Minute)
+	for _, row := range data.Rows {
+		if row[1] != "api" {
+			continue
+		}
+		ts := cast.ToTime(row[2])
+		assert.Equal(t, last.Add(time.Minute), ts.UTC())
+		assert.EqualValues(t, ts.Unix(), cast.ToInt64(row[3]))
+		last = ts.UTC()
+	}
+	assert.Equal(t, start.Add(10*time.Hour), last.UTC())
+}
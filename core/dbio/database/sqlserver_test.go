@@ -0,0 +1,49 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLServerCopyValue(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	type testCase struct {
+		dbType   string
+		value    any
+		expected any
+	}
+
+	cases := []testCase{
+		{dbType: "int", value: "12", expected: int64(12)},
+		{dbType: "bigint", value: int32(12), expected: int64(12)},
+		{dbType: "float", value: "1.5", expected: 1.5},
+		{dbType: "decimal", value: 121.3, expected: "121.3"},
+		{dbType: "bit", value: "true", expected: true},
+		{dbType: "datetime2", value: "2024-03-01 10:30:00", expected: ts},
+		{dbType: "time", value: "10:30:00.123", expected: "10:30:00.123"},
+		{dbType: "varbinary", value: "abc", expected: []byte("abc")},
+		{dbType: "nvarchar", value: "a,\"b\"\nc", expected: "a,\"b\"\nc"},
+		{dbType: "nvarchar", value: 12, expected: "12"},
+		{dbType: "nvarchar", value: map[string]any{"a": 1}, expected: `{"a":1}`},
+		{dbType: "varchar", value: nil, expected: nil},
+		{
+			dbType:   "uniqueidentifier",
+			value:    "6F9619FF-8B86-D011-B42D-00C04FC964FF",
+			expected: []byte{0xff, 0x19, 0x96, 0x6f, 0x86, 0x8b, 0x11, 0xd0, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff},
+		},
+	}
+
+	for _, c := range cases {
+		value, err := mssqlCopyValue(iop.Column{Name: "col", DbType: c.dbType}, c.value)
+		if assert.NoError(t, err, c.dbType) {
+			assert.Equal(t, c.expected, value, c.dbType)
+		}
+	}
+
+	_, err := mssqlCopyValue(iop.Column{Name: "col", DbType: "int"}, "abc")
+	assert.ErrorContains(t, err, "could not convert value of column col (int)")
+}
@@ -287,18 +287,10 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 	}
 	_ = mux
 
-	insertBatch := func(bColumns iop.Columns, rows [][]interface{}) {
-		var err error
-		defer context.Wg.Write.Done()
-
-		mux.Lock()
-		defer mux.Unlock()
-
+	execInsert := func(bColumns iop.Columns, rows [][]interface{}) (err error) {
 		insFields, err := conn.ValidateColumnNames(columns.Names(), bColumns.Names(), true)
 		if err != nil {
-			err = g.Error(err, "columns mismatch")
-			context.CaptureErr(err)
-			return
+			return g.Error(err, "columns mismatch")
 		}
 
 		insertTemplate := conn.Self().GenerateInsertStatement(tableFName, insFields, len(rows))
@@ -311,9 +303,7 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 			stmt, err = conn.Prepare(insertTemplate)
 		}
 		if err != nil {
-			err = g.Error(err, "Error in PrepareContext")
-			context.CaptureErr(err)
-			return
+			return g.Error(err, "Error in PrepareContext")
 		}
 
 		vals := []interface{}{}
@@ -329,6 +319,7 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 		// Do insert
 		_, err = stmt.ExecContext(ds.Context.Ctx, vals...)
 		if err != nil {
+			stmt.Close()
 			batchErrStr := g.F("Batch Size: %d rows x %d cols = %d (%d vals)", len(rows), len(bColumns), len(rows)*len(bColumns), len(vals))
 			if len(insertTemplate) > 3000 {
 				insertTemplate = insertTemplate[:3000]
@@ -345,17 +336,58 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 					return g.F("len(row[%d]) = %d", i, len(row))
 				})),
 			))
-			context.CaptureErr(err)
-			return
+			return err
 		}
 
 		// close statement
 		err = stmt.Close()
 		if err != nil {
-			err = g.Error(
+			return g.Error(
 				err,
 				fmt.Sprintf("stmt.Close: %s", insertTemplate),
 			)
+		}
+		return nil
+	}
+
+	// number of rows skipped, when on_row_error is enabled
+	var skipped uint64
+
+	// insertRows inserts each row individually to isolate the bad rows.
+	// firstRowNum is the number of the first row in the stream
+	insertRows := func(bColumns iop.Columns, rows [][]interface{}, firstRowNum uint64) (err error) {
+		for i, row := range rows {
+			if rowErr := execInsert(bColumns, [][]interface{}{row}); rowErr != nil {
+				skipped++
+				err = ds.AddRowError(iop.RowError{
+					RowNum: firstRowNum + uint64(i),
+					Column: rowErrorColumn(bColumns, rowErr.Error()),
+					Error:  rowErr.Error(),
+					Row:    row,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// insertBatch inserts the rows, the last one being row number `count`
+	insertBatch := func(bColumns iop.Columns, rows [][]interface{}) {
+		defer context.Wg.Write.Done()
+
+		mux.Lock()
+		defer mux.Unlock()
+
+		firstRowNum := count - uint64(len(rows)) + 1
+		err := execInsert(bColumns, rows)
+		if err != nil && ds.RowErrorMode().Enabled() {
+			g.Debug("batch insert failed, retrying %d rows individually", len(rows))
+			err = insertRows(bColumns, rows, firstRowNum)
+		}
+
+		if err != nil {
 			context.CaptureErr(err)
 		}
 	}
@@ -435,10 +467,26 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 	}
 
 	if ds.Err() != nil {
-		return count, g.Error(ds.Err(), "context error")
+		return count - skipped, g.Error(ds.Err(), "context error")
 	}
 
-	return count, nil
+	return count - skipped, nil
+}
+
+// rowErrorColumn returns the name of the column quoted in the insert error,
+// such as `Incorrect integer value: 'abc' for column 'id' at row 1`.
+// Returns blank if no column is mentioned
+func rowErrorColumn(columns iop.Columns, errMsg string) string {
+	errMsg = strings.ToLower(errMsg)
+	for _, col := range columns {
+		name := strings.ToLower(col.Name)
+		for _, q := range []string{`'`, `"`, "`"} {
+			if strings.Contains(errMsg, q+name+q) {
+				return col.Name
+			}
+		}
+	}
+	return ""
 }
 
 // Upsert upserts from source table into target table
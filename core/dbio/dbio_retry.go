@@ -0,0 +1,108 @@
+package dbio
+
+import (
+	"strings"
+)
+
+// retryableErrorsCommon are fragments of transient error messages,
+// regardless of the connection type
+var retryableErrorsCommon = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"driver: bad connection",
+	"tls handshake timeout",
+	"too many connections",
+	"too many requests",
+	"status code: 429",
+	"status code: 503",
+	"service unavailable",
+}
+
+// retryableErrors are fragments of transient error messages, by type:
+// serialization failures, deadlocks, dropped sessions and throttling
+var retryableErrors = map[Type][]string{
+	TypeDbPostgres: {
+		"sqlstate 40001", "sqlstate 40p01", "could not serialize access",
+		"deadlock detected", "server closed the connection unexpectedly",
+		"terminating connection due to administrator command",
+	},
+	TypeDbRedshift: {
+		"sqlstate 40001", "serializable isolation violation",
+		"deadlock detected", "server closed the connection unexpectedly",
+	},
+	TypeDbMySQL: {
+		"deadlock found when trying to get lock", "lock wait timeout exceeded",
+		"server has gone away", "lost connection to mysql server",
+	},
+	TypeDbMariaDB: {
+		"deadlock found when trying to get lock", "lock wait timeout exceeded",
+		"server has gone away", "lost connection to mysql server",
+	},
+	TypeDbStarRocks: {
+		"lost connection to mysql server", "too many versions",
+	},
+	TypeDbSQLServer: {
+		"was deadlocked on lock", "chosen as the deadlock victim",
+		"error 1205", "error 40501", "error 40613", "error 49918",
+	},
+	TypeDbAzure: {
+		"chosen as the deadlock victim", "error 1205", "error 40501",
+		"error 40613", "error 49918", "error 49919",
+	},
+	TypeDbAzureDWH: {
+		"chosen as the deadlock victim", "error 1205", "error 40501",
+		"error 40613",
+	},
+	TypeDbOracle: {
+		"ora-00060", "ora-08177", "ora-03113", "ora-03114", "ora-03135",
+		"ora-12541", "ora-12170",
+	},
+	TypeDbSQLite: {
+		"database is locked", "sqlite_busy",
+	},
+	TypeDbSnowflake: {
+		"390114", "000604", "statement reached its statement or warehouse timeout",
+	},
+	TypeDbBigQuery: {
+		"ratelimitexceeded", "backenderror", "internalerror",
+		"exceeded rate limits", "jobratelimitexceeded",
+	},
+	TypeDbClickhouse: {
+		"too_many_simultaneous_queries", "too many simultaneous queries",
+		"socket_timeout", "network_error",
+	},
+	TypeDbTrino: {
+		"too_many_requests_failed", "no_nodes_available",
+	},
+	TypeDbMongoDB: {
+		"connection pool", "server selection error",
+	},
+	TypeFileS3: {
+		"slowdown", "requesttimeout", "internalerror", "serviceunavailable",
+	},
+	TypeFileGoogle: {
+		"ratelimitexceeded", "backenderror",
+	},
+	TypeFileAzure: {
+		"serverbusy", "operationtimedout", "internalerror",
+	},
+}
+
+// IsRetryableError returns true if the error is transient for the type,
+// such as a deadlock, a connection reset or a throttling response.
+// The same operation may then succeed if attempted again.
+func (t Type) IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range append(retryableErrorsCommon, retryableErrors[t]...) {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
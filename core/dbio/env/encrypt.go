@@ -0,0 +1,244 @@
+package env
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+	"golang.org/x/crypto/scrypt"
+)
+
+// the prefix of encrypted values, such as `enc:v1:<base64 of nonce + ciphertext>`
+const encryptedPrefix = "enc:v1:"
+
+// GetEnvKeyPath returns the path of the key file used to encrypt the
+// connection values of the env file, unless SLING_ENV_KEY is set.
+// The default is next to the env file, so it only protects the values
+// if the env file is shared without it: it is only created with
+// SLING_ENV_KEY_LOCAL=true. Otherwise, the key should be kept
+// elsewhere, with SLING_ENV_KEY_FILE or SLING_ENV_KEY
+func GetEnvKeyPath(envFilePath string) string {
+	if keyPath := os.Getenv("SLING_ENV_KEY_FILE"); keyPath != "" {
+		return keyPath
+	}
+	return path.Join(path.Dir(envFilePath), ".env.key")
+}
+
+// envKey returns the AES-256 key, from SLING_ENV_KEY or the key file.
+// A base64 key of 32 bytes is used as is, other values as a passphrase,
+// the key being derived with scrypt and the salt of the env file.
+// If generate is true and there is no key, a random key file is created,
+// unless values are already encrypted (with a key which is not found).
+func (ef *EnvFile) envKey(generate bool) (key []byte, err error) {
+	keyText := os.Getenv("SLING_ENV_KEY")
+	if keyText == "" {
+		keyPath := GetEnvKeyPath(ef.Path)
+		bytes, err := os.ReadFile(keyPath)
+		if os.IsNotExist(err) && generate {
+			for name, conn := range ef.Connections {
+				if HasEncrypted(conn) {
+					return nil, g.Error("key file %s not found, but the values of connection %s are encrypted. Set SLING_ENV_KEY or SLING_ENV_KEY_FILE with their key", keyPath, name)
+				}
+			}
+
+			if os.Getenv("SLING_ENV_KEY_FILE") == "" && !cast.ToBool(os.Getenv("SLING_ENV_KEY_LOCAL")) {
+				return nil, g.Error("no key to encrypt the connections. Set SLING_ENV_KEY (such as from a secret manager), or SLING_ENV_KEY_FILE with the path of a key file to create outside of %s. Set SLING_ENV_KEY_LOCAL=true to create the key file next to the env file", path.Dir(ef.Path))
+			}
+
+			key = make([]byte, 32)
+			if _, err = rand.Read(key); err != nil {
+				return nil, g.Error(err, "could not generate key")
+			}
+			keyText = base64.StdEncoding.EncodeToString(key)
+			if err = os.WriteFile(keyPath, []byte(keyText+"\n"), 0600); err != nil {
+				return nil, g.Error(err, "could not write key file")
+			}
+			g.Info("created key file %s. Back it up, the connections cannot be decrypted without it", keyPath)
+			return key, nil
+		} else if err != nil {
+			return nil, g.Error(err, "could not read key file (or set SLING_ENV_KEY)")
+		}
+		keyText = string(bytes)
+	}
+
+	keyText = strings.TrimSpace(keyText)
+	if key, err = base64.StdEncoding.DecodeString(keyText); err == nil && len(key) == 32 {
+		return key, nil
+	}
+
+	// a passphrase, the salt is created with the first encryption
+	if ef.Salt == "" {
+		if !generate {
+			return nil, g.Error("env file %s has no salt for the passphrase key", ef.Path)
+		}
+		salt := make([]byte, 16)
+		if _, err = rand.Read(salt); err != nil {
+			return nil, g.Error(err, "could not generate salt")
+		}
+		ef.Salt = base64.StdEncoding.EncodeToString(salt)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(ef.Salt)
+	if err != nil {
+		return nil, g.Error(err, "could not decode salt of env file %s", ef.Path)
+	}
+
+	key, err = scrypt.Key([]byte(keyText), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, g.Error(err, "could not derive key from passphrase")
+	}
+	return key, nil
+}
+
+// IsEncrypted returns true if the value was encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// EncryptValue encrypts the value with AES-GCM
+func EncryptValue(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", g.Error(err, "could not generate nonce")
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptValue decrypts a value encrypted with EncryptValue
+func DecryptValue(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", g.Error(err, "could not decode encrypted value")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", g.Error("encrypted value is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", g.Error(err, "could not decrypt value, the key may be wrong")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, g.Error(err, "could not create cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, g.Error(err, "could not create GCM")
+	}
+	return gcm, nil
+}
+
+// decryptConnections decrypts the connection values. The connections
+// which cannot be decrypted are left as is.
+func (ef *EnvFile) decryptConnections() (err error) {
+	key, err := ef.envKey(false)
+	if err != nil {
+		return err
+	}
+
+	eG := g.ErrorGroup{}
+	for name, conn := range ef.Connections {
+		decrypted, err := cryptMap(conn, func(value string) (string, error) {
+			return DecryptValue(key, value)
+		})
+		if err != nil {
+			eG.Capture(g.Error(err, "could not decrypt connection %s", name))
+			continue
+		}
+		ef.Connections[name] = decrypted
+	}
+	return eG.Err()
+}
+
+// encryptedConnections returns a copy of the connections,
+// with the values encrypted (except the type)
+func (ef *EnvFile) encryptedConnections() (conns map[string]map[string]any, err error) {
+	key, err := ef.envKey(true)
+	if err != nil {
+		return nil, err
+	}
+
+	conns = map[string]map[string]any{}
+	for name, conn := range ef.Connections {
+		conns[name], err = cryptMap(conn, func(value string) (string, error) {
+			if IsEncrypted(value) {
+				return value, nil // not decrypted, such as without the key
+			}
+			return EncryptValue(key, value)
+		})
+		if err != nil {
+			return nil, g.Error(err, "could not encrypt connection %s", name)
+		}
+	}
+	return conns, nil
+}
+
+// HasEncrypted returns true if a string value of the map was encrypted,
+// such as the values of a connection which could not be decrypted
+func HasEncrypted(m map[string]any) bool {
+	for _, v := range m {
+		switch val := v.(type) {
+		case string:
+			if IsEncrypted(val) {
+				return true
+			}
+		case map[string]any:
+			if HasEncrypted(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cryptMap returns a copy of the map, with the function applied
+// to the string values (except the type)
+func cryptMap(m map[string]any, crypt func(value string) (string, error)) (result map[string]any, err error) {
+	result = make(map[string]any, len(m))
+	for k, v := range m {
+		switch val := v.(type) {
+		case string:
+			if k == "type" {
+				result[k] = val
+			} else if result[k], err = crypt(val); err != nil {
+				return nil, g.Error(err, "could not process key %s", k)
+			}
+		case map[string]any:
+			if result[k], err = cryptMap(val, crypt); err != nil {
+				return nil, err
+			}
+		default:
+			result[k] = v
+		}
+	}
+	return result, nil
+}
@@ -26,6 +26,8 @@ var EnvFolder embed.FS
 type EnvFile struct {
 	Connections map[string]map[string]interface{} `json:"connections,omitempty" yaml:"connections,omitempty"`
 	Variables   map[string]interface{}            `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Encrypted   bool                              `json:"encrypted,omitempty" yaml:"encrypted,omitempty"` // connection values are encrypted
+	Salt        string                            `json:"salt,omitempty" yaml:"salt,omitempty"`           // salt of the key derived from a passphrase
 
 	Path       string `json:"-" yaml:"-"`
 	TopComment string `json:"-" yaml:"-"`
@@ -47,11 +49,19 @@ func SetHomeDir(name string) string {
 func (ef *EnvFile) WriteEnvFile() (err error) {
 	connsMap := yaml.MapSlice{}
 
+	connections := ef.Connections
+	if ef.Encrypted {
+		connections, err = ef.encryptedConnections()
+		if err != nil {
+			return g.Error(err, "could not encrypt connections")
+		}
+	}
+
 	// order connections names
-	names := lo.Keys(ef.Connections)
+	names := lo.Keys(connections)
 	sort.Strings(names)
 	for _, name := range names {
-		keyMap := ef.Connections[name]
+		keyMap := connections[name]
 		// order connection keys (type first)
 		cMap := yaml.MapSlice{}
 		keys := lo.Keys(keyMap)
@@ -76,6 +86,13 @@ func (ef *EnvFile) WriteEnvFile() (err error) {
 		{Key: "connections", Value: connsMap},
 		{Key: "variables", Value: ef.Variables},
 	}
+	if ef.Encrypted {
+		header := yaml.MapSlice{{Key: "encrypted", Value: true}}
+		if ef.Salt != "" {
+			header = append(header, yaml.MapItem{Key: "salt", Value: ef.Salt})
+		}
+		efMap = append(header, efMap...)
+	}
 
 	envBytes, err := yaml.Marshal(efMap)
 	if err != nil {
@@ -151,6 +168,13 @@ func LoadEnvFile(path string) (ef EnvFile) {
 		ef.Variables = map[string]interface{}{}
 	}
 
+	if ef.Encrypted {
+		// the connections left encrypted fail when used (see HasEncrypted)
+		if err = ef.decryptConnections(); err != nil {
+			g.Warn("could not decrypt connections of %s: %s", path, g.ErrMsgSimple(err))
+		}
+	}
+
 	// set env vars
 	envMap := map[string]string{}
 	for _, tuple := range os.Environ() {
@@ -22,7 +22,8 @@ var envVars = []string{
 	"AZURE_ACCOUNT", "AZURE_KEY", "AZURE_CONTAINER", "AZURE_SAS_SVC_URL",
 	"AZURE_CONN_STR",
 
-	"SSH_TUNNEL", "SSH_PRIVATE_KEY", "SSH_PUBLIC_KEY",
+	"SSH_TUNNEL", "SSH_PRIVATE_KEY", "SSH_PUBLIC_KEY", "SSH_PASSPHRASE",
+	"SSH_JUMP_HOSTS", "SSH_KNOWN_HOSTS",
 
 	"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM_EMAIL", "SMTP_REPLY_EMAIL",
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"runtime"
@@ -379,6 +380,38 @@ func (fs *BaseFileSysClient) SetProp(key string, val string) {
 	fs.context.Mux.Unlock()
 }
 
+// sshDialer returns the dial function through the SSH tunnel (SSH_TUNNEL prop),
+// nil if not set
+func (fs *BaseFileSysClient) sshDialer() (dial iop.DialFunc, err error) {
+	if fs.GetProp("SSH_TUNNEL") == "" {
+		return nil, nil
+	}
+
+	sshClient, err := iop.NewSSHTunnelClient(fs.Props())
+	if err != nil {
+		return nil, g.Error(err, "could not create ssh client")
+	}
+
+	dial, err = iop.SSHDialer(sshClient)
+	if err != nil {
+		return nil, g.Error(err, "could not connect to ssh server")
+	}
+	return dial, nil
+}
+
+// httpClient returns a HTTP client, connecting through the
+// SSH tunnel if set
+func (fs *BaseFileSysClient) httpClient() (client *http.Client, err error) {
+	dial, err := fs.sshDialer()
+	if err != nil || dial == nil {
+		return &http.Client{}, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dial
+	return &http.Client{Transport: transport}, nil
+}
+
 // Props returns a copy of the properties map
 func (fs *BaseFileSysClient) Props() map[string]string {
 	m := map[string]string{}
@@ -587,6 +620,7 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 	fsClient := fs.Self()
 	defer close(fileReadyChn)
 	useBufferedStream := cast.ToBool(fs.GetProp("USE_BUFFERED_STREAM"))
+	useArrowParquet := cast.ToBool(fs.GetProp("USE_ARROW_PARQUET")) // keeps nulls, decimals & timestamps types
 	concurrency := cast.ToInt(fs.GetProp("CONCURRENCY"))
 	compression := iop.CompressorType(strings.ToUpper(fs.GetProp("COMPRESSION")))
 	fileFormat := FileType(strings.ToLower(cast.ToString(fs.GetProp("FORMAT"))))
@@ -626,8 +660,8 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 		url = strings.TrimSuffix(url, "/"+lastPart)
 	}
 
-	// adjust fileBytesLimit due to compression
-	if g.In(compression, iop.GzipCompressorType, iop.ZStandardCompressorType, iop.SnappyCompressorType) {
+	// adjust fileBytesLimit due to compression (the arrow parquet writer counts the compressed bytes)
+	if g.In(compression, iop.GzipCompressorType, iop.ZStandardCompressorType, iop.SnappyCompressorType) && !(useArrowParquet && fileFormat == FileTypeParquet) {
 		fileBytesLimit = fileBytesLimit * 6 // compressed, multiply
 	}
 
@@ -717,7 +751,11 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 				}
 			}
 		case FileTypeParquet:
-			for reader := range ds.NewParquetReaderChnl(fileRowLimit, fileBytesLimit, compression) {
+			readerChn := ds.NewParquetReaderChnl
+			if useArrowParquet {
+				readerChn = ds.NewParquetArrowReaderChnl
+			}
+			for reader := range readerChn(fileRowLimit, fileBytesLimit, compression) {
 				err := processReader(reader)
 				if err != nil {
 					break
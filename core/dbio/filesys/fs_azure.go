@@ -74,12 +74,19 @@ func (fs *AzureFileSysClient) GetPath(uri string) (path string, err error) {
 // Connect initiates the fs client connection
 func (fs *AzureFileSysClient) Connect() (err error) {
 
+	options := &azblob.ClientOptions{}
+	if fs.GetProp("SSH_TUNNEL") != "" {
+		if options.Transport, err = fs.httpClient(); err != nil {
+			return g.Error(err, "could not connect through SSH tunnel")
+		}
+	}
+
 	if cs := fs.GetProp("CONN_STR"); cs != "" {
 		connProps := g.KVArrToMap(strings.Split(cs, ";")...)
 		fs.account = connProps["AccountName"]
 		fs.key = connProps["AccountKey"]
 
-		fs.client, err = azblob.NewClientFromConnectionString(cs, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClientFromConnectionString(cs, options)
 		if err != nil {
 			err = g.Error(err, "Could not connect to Azure using provided CONN_STR")
 			return
@@ -91,7 +98,7 @@ func (fs *AzureFileSysClient) Connect() (err error) {
 			return
 		}
 
-		fs.client, err = azblob.NewClientWithNoCredential(cs, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClientWithNoCredential(cs, options)
 		if err != nil {
 			err = g.Error(err, "Could not connect to Azure using provided SAS_SVC_URL")
 			return
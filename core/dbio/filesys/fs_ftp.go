@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"io"
+	"net"
 	"net/url"
 	"strings"
 	"time"
@@ -92,7 +93,16 @@ func (fs *FtpFileSysClient) Connect() (err error) {
 		address = g.F("%s:%s", fs.GetProp("host"), fs.GetProp("port"))
 	}
 
-	fs.client, err = ftp.Dial(address, ftp.DialWithTimeout(time.Duration(timeout)*time.Second))
+	options := []ftp.DialOption{ftp.DialWithTimeout(time.Duration(timeout) * time.Second)}
+	if dial, err := fs.sshDialer(); err != nil {
+		return g.Error(err, "could not connect through SSH tunnel")
+	} else if dial != nil {
+		options = append(options, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+			return dial(fs.Context().Ctx, network, address)
+		}))
+	}
+
+	fs.client, err = ftp.Dial(address, options...)
 	if err != nil {
 		return g.Error(err, "unable to connect to ftp server ")
 	}
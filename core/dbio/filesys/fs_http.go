@@ -54,7 +54,10 @@ func (fs *HTTPFileSysClient) Init(ctx context.Context) (err error) {
 // Connect initiates the http client
 func (fs *HTTPFileSysClient) Connect() (err error) {
 	// fs.client = &http.Client{Timeout: 20 * time.Second}
-	fs.client = &http.Client{}
+	fs.client, err = fs.httpClient()
+	if err != nil {
+		return g.Error(err, "could not connect through SSH tunnel")
+	}
 	fs.username = fs.GetProp("HTTP_USER")
 	fs.password = fs.GetProp("HTTP_PASSWORD")
 	fs.isHttps = strings.HasPrefix(fs.GetProp("url"), "https://")
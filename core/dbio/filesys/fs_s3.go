@@ -105,6 +105,12 @@ func (fs *S3FileSysClient) Connect() (err error) {
 		// LogLevel: aws.LogLevel(aws.LogDebugWithHTTPBody),
 	}
 
+	if fs.GetProp("SSH_TUNNEL") != "" {
+		if awsConfig.HTTPClient, err = fs.httpClient(); err != nil {
+			return g.Error(err, "could not connect through SSH tunnel")
+		}
+	}
+
 	if profile := fs.GetProp("PROFILE"); profile != "" {
 		awsConfig.Credentials = credentials.NewSharedCredentials("", profile)
 	} else if fs.GetProp("ACCESS_KEY_ID") != "" && fs.GetProp("SECRET_ACCESS_KEY") != "" {
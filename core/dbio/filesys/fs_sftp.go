@@ -104,6 +104,12 @@ func (fs *SftpFileSysClient) Connect() (err error) {
 		Passphrase: fs.GetProp("PASSPHRASE"),
 	}
 
+	// connect through the jump hosts, then the SSH tunnel if set
+	fs.sshClient.SetProxyProps(fs.Props())
+	if sshURL := fs.GetProp("SSH_TUNNEL"); sshURL != "" {
+		fs.sshClient.ProxyJumps = append(fs.sshClient.ProxyJumps, sshURL)
+	}
+
 	err = fs.sshClient.Connect()
 	if err != nil {
 		return g.Error(err, "unable to connect to ssh server ")
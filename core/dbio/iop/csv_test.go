@@ -365,3 +365,45 @@ func TestRecords4(t *testing.T) {
 	g.Info("delta: %d us", end.UnixMicro()-start.UnixMicro())
 	g.Info("%#v", row)
 }
+
+func TestStreamRowErrors(t *testing.T) {
+	csvText := "id,amount\n1,10.5\n2,abc\n3,7\n4,xyz\n"
+	columns := `[{"name":"id","type":"integer"},{"name":"amount","type":"decimal"}]`
+
+	consume := func(configMap map[string]string) (Dataset, *Datastream, error) {
+		ds := NewDatastream(nil)
+		ds.SetConfig(configMap)
+		err := ds.ConsumeCsvReader(strings.NewReader(csvText))
+		if err != nil {
+			return Dataset{}, ds, err
+		}
+		data, err := ds.Collect(0)
+		return data, ds, err
+	}
+
+	// default is to change type, not skip
+	data, _, err := consume(map[string]string{"columns": columns})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 4)
+
+	data, ds, err := consume(map[string]string{"columns": columns, "on_row_error": "dead_letter"})
+	if assert.NoError(t, err) {
+		assert.Len(t, data.Rows, 2)
+		assert.EqualValues(t, 2, ds.RowErrorCount())
+		if rowErrs := ds.RowErrors(); assert.Len(t, rowErrs, 2) {
+			assert.EqualValues(t, 2, rowErrs[0].RowNum)
+			assert.Equal(t, "amount", rowErrs[0].Column)
+			assert.Equal(t, `["2","abc"]`, rowErrs[0].Record())
+		}
+	}
+
+	data, ds, err = consume(map[string]string{"columns": columns, "on_row_error": "skip"})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 2)
+	assert.Len(t, ds.RowErrors(), 0) // not kept when skipping
+
+	_, _, err = consume(map[string]string{"columns": columns, "on_row_error": "skip", "max_errors": "1"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeded max_errors")
+	}
+}
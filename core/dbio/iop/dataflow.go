@@ -32,6 +32,7 @@ type Dataflow struct {
 	closed          bool
 	mux             sync.Mutex
 	SchemaVersion   int // for column type version
+	rowErrors       rowErrors
 }
 
 // NewDataflow creates a new dataflow
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"io"
 	"os"
 	"path"
@@ -63,6 +64,7 @@ type Datastream struct {
 	paused        bool
 	pauseChan     chan struct{}
 	unpauseChan   chan struct{}
+	rowErrors     rowErrors
 }
 
 type schemaChg struct {
@@ -744,6 +746,20 @@ loop:
 				ds.it.Row = setMetaValues(ds.it)
 				if ds.it.IsCasted || ds.it.RowIsCasted {
 					row = ds.it.Row
+				} else if ds.Sp.Config.OnRowError.Enabled() {
+					// keep the original values in case the row cannot be casted
+					origRow := make([]any, len(ds.it.Row))
+					copy(origRow, ds.it.Row)
+
+					row = ds.Sp.CastRow(ds.it.Row, ds.Columns)
+					if rowErr := ds.Sp.rowErr; rowErr != nil {
+						rowErr.Row = origRow
+						if err = ds.AddRowError(*rowErr); err != nil {
+							ds.Context.CaptureErr(err)
+							break loop
+						}
+						goto loop
+					}
 				} else {
 					row = ds.Sp.CastRow(ds.it.Row, ds.Columns)
 				}
@@ -936,11 +952,24 @@ func (ds *Datastream) ConsumeCsvReader(reader io.Reader) (err error) {
 
 	nextFunc := func(it *Iterator) bool {
 
+	read:
 		row, err := r.Read()
 		if err == io.EOF {
 			c.File.Close()
 			return false
 		} else if err != nil {
+			// skip malformed lines if on_row_error is enabled
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && it.ds.RowErrorMode().Enabled() {
+				rowErr := RowError{
+					RowNum: it.Counter + 1,
+					Error:  parseErr.Error(),
+					Row:    lo.Map(row, func(v string, i int) any { return v }),
+				}
+				if err = it.ds.AddRowError(rowErr); err == nil {
+					goto read
+				}
+			}
 			it.ds.Context.CaptureErr(g.Error(err, "Error reading file"))
 			return false
 		}
@@ -1730,8 +1759,8 @@ func (ds *Datastream) NewJsonLinesReaderChnl(rowLimit int, bytesLimit int64) (re
 }
 
 // NewParquetArrowReaderChnl provides a channel of readers as the limit is reached
-// each channel flows as fast as the consumer consumes
-// WARN: Not using this one since it doesn't write Decimals properly.
+// each channel flows as fast as the consumer consumes.
+// Nulls, decimals and timestamps keep their types.
 func (ds *Datastream) NewParquetArrowReaderChnl(rowLimit int, bytesLimit int64, compression CompressorType) (readerChn chan *BatchReader) {
 	readerChn = make(chan *BatchReader, 100)
 
@@ -1774,7 +1803,7 @@ func (ds *Datastream) NewParquetArrowReaderChnl(rowLimit int, bytesLimit int64,
 				codec = arrowCompress.Codecs.Uncompressed
 			}
 
-			pw, err = NewParquetArrowWriter(pipeW, ds.Columns, codec)
+			pw, err = NewParquetArrowWriter(pipeW, batch.Columns, codec)
 			if err != nil {
 				return g.Error(err, "could not create parquet writer")
 			}
@@ -1801,6 +1830,7 @@ func (ds *Datastream) NewParquetArrowReaderChnl(rowLimit int, bytesLimit int64,
 				}
 
 				br.Counter++
+				tbw = pw.BytesWritten()
 
 				if (rowLimit > 0 && br.Counter >= rowLimit) || (bytesLimit > 0 && tbw >= bytesLimit) {
 					err = nextPipe(batch)
@@ -248,6 +248,14 @@ func (p *ParquetArrowReader) readRowsLoop() {
 					}
 
 					switch v := val.(type) {
+					case int32:
+						if col.Type == DecimalType {
+							val = decimalIntToString(int64(v), col.DbScale)
+						}
+					case int64:
+						if col.Type == DecimalType {
+							val = decimalIntToString(v, col.DbScale)
+						}
 					case parquet.ByteArray:
 						if col.Type == DecimalType {
 							val = DecimalByteArrayToString(v.Bytes(), col.DbPrecision, col.DbScale)
@@ -417,7 +425,9 @@ func (pad *ParquetArrowDumper) Next() (interface{}, bool) {
 }
 
 func convertTimestamp(col Column, val any) (newVal any, err error) {
-	if int96, ok := val.(parquet.Int96); ok && col.Metadata["primitiveType"] == "INT96" {
+	if val == nil {
+		return nil, nil
+	} else if int96, ok := val.(parquet.Int96); ok && col.Metadata["primitiveType"] == "INT96" {
 		return int96ToTimestamp(int96, cast.ToString(col.Metadata["timeUnit"])), nil
 	}
 
@@ -490,11 +500,12 @@ type ParquetArrowWriter struct {
 	colWriters      []file.ColumnChunkWriter
 	colValuesBuffer [][]any
 	decNumScale     []*big.Rat
+	bytesWritten    int64 // of the closed row groups
 }
 
 func NewParquetArrowWriter(w io.Writer, columns Columns, codec compress.Compression) (p *ParquetArrowWriter, err error) {
 
-	p = &ParquetArrowWriter{columns: columns, decNumScale: make([]*big.Rat, len(columns))}
+	p = &ParquetArrowWriter{columns: columns.Clone(), decNumScale: make([]*big.Rat, len(columns))}
 	schema, err := p.makeSchema()
 	if err != nil {
 		return nil, g.Error(err, "could not make schema")
@@ -524,6 +535,7 @@ func (p *ParquetArrowWriter) AppendNewRowGroup() (err error) {
 		if err != nil {
 			return g.Error(err, "could not close rowGroup")
 		}
+		p.bytesWritten += p.rowGroup.TotalBytesWritten()
 	}
 
 	p.rowGroup = p.Writer.AppendBufferedRowGroup()
@@ -575,8 +587,13 @@ func (p *ParquetArrowWriter) Columns() Columns {
 	return p.columns
 }
 
+// BytesWritten returns the approximate number of bytes written so far
+func (p *ParquetArrowWriter) BytesWritten() int64 {
+	return p.bytesWritten + p.rowGroup.TotalBytesWritten()
+}
+
 func (p *ParquetArrowWriter) makeSchema() (s *schema.Schema, err error) {
-	rep := parquet.Repetitions.Undefined
+	rep := parquet.Repetitions.Optional // nullable
 	fields := make([]schema.Node, len(p.Columns()))
 	for i, col := range p.Columns() {
 		fields[i], _ = schema.NewPrimitiveNode(col.Name, rep, parquetMapPhysicalType[col.Type], -1, 12)
@@ -589,24 +606,24 @@ func (p *ParquetArrowWriter) makeSchema() (s *schema.Schema, err error) {
 		case col.Type == FloatType:
 			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, -1, -1)
 		case col.Type == DecimalType:
-			rep = parquet.Repetitions.Required
-			col.DbPrecision = lo.Ternary(col.DbPrecision == 0, 28, col.DbPrecision)
-			col.DbScale = lo.Ternary(col.DbScale == 0, 9, col.DbScale)
+			// the scale is only defaulted when the precision is unknown
+			if col.DbPrecision == 0 {
+				col.DbPrecision, col.DbScale = 28, lo.Ternary(col.DbScale == 0, 9, col.DbScale)
+			}
 			p.columns[i] = col
 			lType := schema.NewDecimalLogicalType(int32(col.DbPrecision), int32(col.DbScale))
 			node, err = schema.NewPrimitiveNodeLogical(col.Name, rep, lType, pType, 16, fieldID)
-			if col.DbScale > 0 {
-				p.decNumScale[i] = MakeDecNumScale(col.DbScale)
-			} else {
-				p.decNumScale[i] = MakeDecNumScale(1)
-			}
+			p.decNumScale[i] = MakeDecNumScale(col.DbScale)
 		case col.IsInteger():
 			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, -1, -1)
 		case col.IsDatetime() || col.IsDate():
-			lType := schema.NewTimestampLogicalType(true, schema.TimeUnitNanos)
+			// only the timestamps with time zone are adjusted to UTC
+			lType := schema.NewTimestampLogicalType(col.Type == TimestampzType, schema.TimeUnitNanos)
 			node, err = schema.NewPrimitiveNodeLogical(col.Name, rep, lType, pType, -1, fieldID)
 		case col.IsBool():
 			node = schema.NewBooleanNode(col.Name, rep, fieldID)
+		case col.Type == BinaryType:
+			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, -1, -1)
 		// case col.Type == JsonType:
 		// 	node, err = schema.NewPrimitiveNodeConverted(col.Name, rep, pType, schema.ConvertedTypes.JSON, -1, 0, 0, fieldID)
 		default:
@@ -623,8 +640,8 @@ func (p *ParquetArrowWriter) makeSchema() (s *schema.Schema, err error) {
 }
 
 func (p *ParquetArrowWriter) writeBuffer() (err error) {
-	for i, col := range p.Columns() {
-		err = p.writeColumnValues(&col, p.colWriters[i], p.colValuesBuffer[i])
+	for i := range p.Columns() {
+		err = p.writeColumnValues(i, p.colWriters[i], p.colValuesBuffer[i])
 		if err != nil {
 			return g.Error(err, "could not write colValuesBuffer")
 		}
@@ -657,79 +674,88 @@ func (p *ParquetArrowWriter) WriteRow(row []any) (err error) {
 	return
 }
 
-func (p *ParquetArrowWriter) writeColumnValues(col *Column, writer file.ColumnChunkWriter, colValuesBatch []any) (err error) {
+func (p *ParquetArrowWriter) writeColumnValues(i int, writer file.ColumnChunkWriter, colValuesBatch []any) (err error) {
 	if len(colValuesBatch) == 0 {
 		return
 	}
 
+	col := p.columns[i]
+
+	// the definition level is 0 for nulls, which are not in the values
 	var offset int64
 	defLevels := make([]int16, len(colValuesBatch))
-	for j := range defLevels {
-		defLevels[j] = 0
+	nonNullValues := make([]any, 0, len(colValuesBatch))
+	for j, val := range colValuesBatch {
+		if val != nil {
+			defLevels[j] = 1
+			nonNullValues = append(nonNullValues, val)
+		}
 	}
-	defLevels = nil
+	colValuesBatch = nonNullValues
 
 	switch w := writer.(type) {
 	case *file.Int32ColumnChunkWriter:
 		values := make([]int32, len(colValuesBatch))
-		for i, val := range colValuesBatch {
-			values[i] = cast.ToInt32(val)
+		for j, val := range colValuesBatch {
+			values[j] = cast.ToInt32(val)
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.Int64ColumnChunkWriter:
 		values := make([]int64, len(colValuesBatch))
-		for i, val := range colValuesBatch {
+		for j, val := range colValuesBatch {
 			if col.IsDatetime() || col.IsDate() {
 				tVal, _ := cast.ToTimeE(val)
-				values[i] = cast.ToInt64(tVal.UnixNano())
+				values[j] = cast.ToInt64(tVal.UnixNano())
 			} else {
-				values[i] = cast.ToInt64(val)
+				values[j] = cast.ToInt64(val)
 			}
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.Float32ColumnChunkWriter:
 		values := make([]float32, len(colValuesBatch))
-		for i, val := range colValuesBatch {
-			values[i] = cast.ToFloat32(val)
+		for j, val := range colValuesBatch {
+			values[j] = cast.ToFloat32(val)
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.Float64ColumnChunkWriter:
 		values := make([]float64, len(colValuesBatch))
-		for i, val := range colValuesBatch {
-			values[i] = cast.ToFloat64(val)
+		for j, val := range colValuesBatch {
+			values[j] = cast.ToFloat64(val)
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.BooleanColumnChunkWriter:
 		values := make([]bool, len(colValuesBatch))
-		for i, val := range colValuesBatch {
-			values[i] = cast.ToBool(val)
+		for j, val := range colValuesBatch {
+			values[j] = cast.ToBool(val)
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	// case *file.Int96ColumnChunkWriter:
 	// 	values := make([]parquet.Int96, len(colValuesBatch))
-	// 	for i, val := range colValuesBatch {
+	// 	for j, val := range colValuesBatch {
 	// 	}
 	// 	offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.ByteArrayColumnChunkWriter:
 		values := make([]parquet.ByteArray, len(colValuesBatch))
-		for i, val := range colValuesBatch {
+		for j, val := range colValuesBatch {
 			valS := cast.ToString(val)
 			if col.Type == DecimalType {
-				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.ByteArray, 16)
+				values[j] = StringToDecimalByteArray(valS, p.decNumScale[i], parquet.Types.ByteArray, 16)
+			} else if b, ok := val.([]byte); ok {
+				values[j] = b
 			} else {
-				values[i] = []byte(cast.ToString(val))
+				values[j] = []byte(cast.ToString(val))
 			}
 		}
 		offset, err = w.WriteBatch(values, defLevels, nil)
 	case *file.FixedLenByteArrayColumnChunkWriter:
 		values := make([]parquet.FixedLenByteArray, len(colValuesBatch))
 
-		for i, val := range colValuesBatch {
+		for j, val := range colValuesBatch {
 			valS := cast.ToString(val)
 			if col.Type == DecimalType {
-				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.FixedLenByteArray, 16)
+				values[j] = StringToDecimalByteArray(valS, p.decNumScale[i], parquet.Types.FixedLenByteArray, 16)
 			} else {
-				values[i] = []byte(cast.ToString(val))
+				values[j] = []byte(cast.ToString(val))
 			}
 		}
 
@@ -772,6 +798,16 @@ func DecimalByteArrayToString(dec []byte, precision int, scale int) string {
 	return sign + sa
 }
 
+// decimalIntToString converts the unscaled integer of a decimal to string,
+// such as the INT32/INT64 decimals written by Snowflake
+func decimalIntToString(unscaled int64, scale int) string {
+	if scale <= 0 {
+		return cast.ToString(unscaled)
+	}
+	denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	return new(big.Rat).SetFrac(big.NewInt(unscaled), denom).FloatString(scale)
+}
+
 func MakeDecNumScale(scale int) *big.Rat {
 	numSca := big.NewRat(1, 1)
 	for i := 0; i < scale; i++ {
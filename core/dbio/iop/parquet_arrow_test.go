@@ -3,8 +3,10 @@ package iop
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
 	"reflect"
 	"testing"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/apache/arrow/go/v16/parquet/file"
 	"github.com/apache/arrow/go/v16/parquet/schema"
 	"github.com/flarco/g"
+	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -158,6 +161,7 @@ func TestNewParquetWriter(t *testing.T) {
 			{Name: "col_float", Type: FloatType},
 			{Name: "col_json", Type: JsonType},
 			{Name: "col_timestamp", Type: TimestampType},
+			{Name: "col_integral", Type: DecimalType, DbPrecision: 10},
 		}...,
 	)
 
@@ -202,6 +206,89 @@ func TestNewParquetWriter(t *testing.T) {
 	g.LogFatal(err)
 }
 
+func TestParquetArrowRoundTrip(t *testing.T) {
+	columns := NewColumns(
+		Columns{
+			{Name: "col_string", Type: StringType},
+			{Name: "col_bigint", Type: BigIntType},
+			{Name: "col_decimal", Type: DecimalType, DbPrecision: 10, DbScale: 2},
+			{Name: "col_json", Type: JsonType},
+			{Name: "col_timestamp", Type: TimestampType},
+			{Name: "col_integral", Type: DecimalType, DbPrecision: 10},
+		}...,
+	)
+
+	ts := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	data := NewDataset(columns)
+	data.Append([]any{"hello", int64(133332), "12.33", `{"msg":"Hello!"}`, ts, "1234567890"})
+	data.Append([]any{nil, nil, nil, nil, nil, nil})
+	data.Append([]any{"bye", int64(-987123), "-121.30", `[1,2]`, ts, "-42"})
+
+	// write with rows limit, to make 2 files
+	var filePaths []string
+	ds := data.Stream()
+	for reader := range ds.NewParquetArrowReaderChnl(2, 0, SnappyCompressorType) {
+		filePath := path.Join(t.TempDir(), g.F("%d.parquet", len(filePaths)))
+		bytes, err := io.ReadAll(reader.Reader)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, os.WriteFile(filePath, bytes, 0644))
+		filePaths = append(filePaths, filePath)
+	}
+	assert.NoError(t, ds.Err())
+	assert.Len(t, filePaths, 2)
+
+	var rows [][]any
+	for _, filePath := range filePaths {
+		f, err := os.Open(filePath)
+		if !assert.NoError(t, err) {
+			return
+		}
+		ds := NewDatastream(Columns{})
+		err = ds.ConsumeParquetReaderSeeker(f)
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, err := ds.Collect(0)
+		assert.NoError(t, err)
+		rows = append(rows, data.Rows...)
+
+		assert.Equal(t, DecimalType, data.Columns[2].Type)
+		assert.Equal(t, 10, data.Columns[2].DbPrecision)
+		assert.Equal(t, DatetimeType, data.Columns[4].Type)
+		assert.Equal(t, 0, data.Columns[5].DbScale)
+		f.Close()
+	}
+
+	if assert.Len(t, rows, 3) {
+		assert.EqualValues(t, "hello", rows[0][0])
+		assert.EqualValues(t, 133332, rows[0][1])
+		assert.Equal(t, "12.33", cast.ToString(rows[0][2]))
+		assert.EqualValues(t, `{"msg":"Hello!"}`, rows[0][3])
+		assert.Equal(t, ts.Unix(), cast.ToTime(rows[0][4]).Unix())
+		assert.Equal(t, "1234567890", cast.ToString(rows[0][5]))
+		assert.Equal(t, []any{nil, nil, nil, nil, nil, nil}, rows[1])
+		assert.Equal(t, "-121.30", cast.ToString(rows[2][2]))
+		assert.Equal(t, "-42", cast.ToString(rows[2][5]))
+	}
+
+	// binary is written without the UTF8 type
+	pw, err := NewParquetArrowWriter(io.Discard, Columns{{Name: "col_binary", Type: BinaryType}}, compress.Codecs.Uncompressed)
+	if assert.NoError(t, err) {
+		col := pw.Writer.Schema.Column(0)
+		assert.Equal(t, parquet.Types.ByteArray, col.PhysicalType())
+		assert.Equal(t, schema.ConvertedTypes.None, col.ConvertedType())
+		assert.NoError(t, pw.WriteRow([]any{[]byte{0, 255, 10}}))
+		assert.NoError(t, pw.Close())
+	}
+
+	// decimals as integers, such as from Snowflake
+	assert.Equal(t, "-121.30", decimalIntToString(-12130, 2))
+	assert.Equal(t, "0.05", decimalIntToString(5, 2))
+	assert.Equal(t, "42", decimalIntToString(42, 0))
+}
+
 const defaultBatchSize = 128
 
 type Dumper struct {
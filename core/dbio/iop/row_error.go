@@ -0,0 +1,137 @@
+package iop
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// RowErrorMode is the behavior when a row fails casting or insertion
+type RowErrorMode string
+
+const (
+	// RowErrorModeFail fails the stream on the first bad row (default)
+	RowErrorModeFail RowErrorMode = "fail"
+	// RowErrorModeSkip skips the bad rows, logging them
+	RowErrorModeSkip RowErrorMode = "skip"
+	// RowErrorModeDeadLetter skips the bad rows, collecting them to be
+	// written into a dead-letter target
+	RowErrorModeDeadLetter RowErrorMode = "dead_letter"
+)
+
+// NewRowErrorMode parses a string value into a RowErrorMode
+func NewRowErrorMode(val string) (mode RowErrorMode, err error) {
+	mode = RowErrorMode(strings.ToLower(strings.TrimSpace(val)))
+	switch mode {
+	case "":
+		return RowErrorModeFail, nil
+	case RowErrorModeFail, RowErrorModeSkip, RowErrorModeDeadLetter:
+		return mode, nil
+	}
+	return RowErrorModeFail, g.Error("invalid on_row_error value: %s. Expecting fail, skip or dead_letter", val)
+}
+
+// Enabled returns true if bad rows should not fail the stream
+func (m RowErrorMode) Enabled() bool {
+	return m == RowErrorModeSkip || m == RowErrorModeDeadLetter
+}
+
+// RowError is a row that could not be casted or inserted
+type RowError struct {
+	StreamURL string `json:"stream_url,omitempty"`
+	RowNum    uint64 `json:"row_num"`
+	Column    string `json:"column,omitempty"`
+	Error     string `json:"error"`
+	Row       []any  `json:"row"`
+}
+
+// Record returns the row as a JSON string
+func (re RowError) Record() string {
+	vals := make([]string, len(re.Row))
+	for i, val := range re.Row {
+		vals[i] = cast.ToString(val)
+	}
+	return g.Marshal(vals)
+}
+
+// rowErrors holds the bad rows of a datastream or dataflow
+type rowErrors struct {
+	Errors []RowError
+	count  uint64
+	mux    sync.Mutex
+}
+
+func (re *rowErrors) add(rowErr RowError, keep bool) (count uint64) {
+	re.mux.Lock()
+	defer re.mux.Unlock()
+	re.count++
+	if keep {
+		re.Errors = append(re.Errors, rowErr)
+	}
+	return re.count
+}
+
+// RowErrorMode returns the configured row error mode
+func (ds *Datastream) RowErrorMode() RowErrorMode {
+	if ds == nil || ds.Sp == nil || ds.Sp.Config == nil {
+		return RowErrorModeFail
+	}
+	return ds.Sp.Config.OnRowError
+}
+
+// AddRowError records a bad row. Returns an error if the row error mode
+// is fail, or if the number of bad rows exceeds max_errors.
+func (ds *Datastream) AddRowError(rowErr RowError) (err error) {
+	mode := ds.RowErrorMode()
+	if !mode.Enabled() {
+		return g.Error("%s (row %d)", rowErr.Error, rowErr.RowNum)
+	}
+
+	if rowErr.StreamURL == "" {
+		rowErr.StreamURL = cast.ToString(ds.Metadata.StreamURL.Value)
+	}
+
+	keep := mode == RowErrorModeDeadLetter
+	count := ds.rowErrors.add(rowErr, keep)
+	if ds.df != nil {
+		count = ds.df.rowErrors.add(RowError{}, false)
+	}
+
+	g.Debug("skipped row %d: %s", rowErr.RowNum, rowErr.Error)
+
+	if maxErrors := ds.Sp.Config.MaxErrors; maxErrors > 0 && count > uint64(maxErrors) {
+		return g.Error("exceeded max_errors (%d). Last error: %s (row %d)", maxErrors, rowErr.Error, rowErr.RowNum)
+	}
+	return nil
+}
+
+// RowErrors returns the bad rows collected
+func (ds *Datastream) RowErrors() []RowError {
+	ds.rowErrors.mux.Lock()
+	defer ds.rowErrors.mux.Unlock()
+	return ds.rowErrors.Errors
+}
+
+// RowErrorCount returns the number of bad rows
+func (ds *Datastream) RowErrorCount() uint64 {
+	ds.rowErrors.mux.Lock()
+	defer ds.rowErrors.mux.Unlock()
+	return ds.rowErrors.count
+}
+
+// RowErrors returns the bad rows collected from all the datastreams
+func (df *Dataflow) RowErrors() (rowErrs []RowError) {
+	for _, ds := range df.Streams {
+		rowErrs = append(rowErrs, ds.RowErrors()...)
+	}
+	return
+}
+
+// RowErrorCount returns the number of bad rows from all the datastreams
+func (df *Dataflow) RowErrorCount() uint64 {
+	df.rowErrors.mux.Lock()
+	defer df.rowErrors.mux.Unlock()
+	return df.rowErrors.count
+}
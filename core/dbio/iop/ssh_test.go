@@ -0,0 +1,276 @@
+package iop
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is a SSH server forwarding the direct-tcpip channels
+type testSSHServer struct {
+	addr     string
+	key      ssh.Signer
+	sessions int
+	forwards []string
+	mux      sync.Mutex
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	_, privKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(privKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "sling" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, g.Error("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testSSHServer{addr: listener.Addr().String(), key: signer}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(conn, config)
+		}
+	}()
+	return server
+}
+
+func (server *testSSHServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	server.mux.Lock()
+	server.sessions++
+	server.mux.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+
+		// host (string), port (uint32), origin host (string), origin port (uint32)
+		data := newChannel.ExtraData()
+		hostLen := binary.BigEndian.Uint32(data[:4])
+		host := string(data[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(data[4+hostLen:])
+		target := g.F("%s:%d", host, port)
+
+		server.mux.Lock()
+		server.forwards = append(server.forwards, target)
+		server.mux.Unlock()
+
+		targetConn, err := net.Dial("tcp", target)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, chReqs, err := newChannel.Accept()
+		if err != nil {
+			targetConn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			io.Copy(channel, targetConn)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(targetConn, channel)
+			targetConn.Close()
+		}()
+	}
+}
+
+func (server *testSSHServer) client() *SSHClient {
+	s, _ := NewSSHClient("ssh://sling:secret@" + server.addr)
+	return s
+}
+
+func newEchoServer(t *testing.T) (host string, port int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte("echo: " + line))
+				}
+			}()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func testEcho(t *testing.T, conn net.Conn, err error) {
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+}
+
+func TestSSHTunnel(t *testing.T) {
+	echoHost, echoPort := newEchoServer(t)
+	bastion := newTestSSHServer(t)
+	jump := newTestSSHServer(t)
+
+	// the tunnels of connections are shared, with one SSH session
+	client := bastion.client()
+	client.TgtHost, client.TgtPort = echoHost, echoPort
+
+	tunnel1, err := OpenSSHTunnel(client)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tunnel2, err := OpenSSHTunnel(client)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, tunnel1.LocalPort, tunnel2.LocalPort)
+	assert.Equal(t, 1, bastion.sessions)
+
+	conn, err := net.Dial("tcp", g.F("127.0.0.1:%d", tunnel1.LocalPort))
+	testEcho(t, conn, err)
+
+	// the closed connections are pruned
+	assert.Eventually(t, func() bool {
+		tunnel1.mux.Lock()
+		defer tunnel1.mux.Unlock()
+		return len(tunnel1.conns) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// another target re-uses the session
+	otherHost, otherPort := newEchoServer(t)
+	client.TgtHost, client.TgtPort = otherHost, otherPort
+	tunnel3, err := OpenSSHTunnel(client)
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, tunnel1.LocalPort, tunnel3.LocalPort)
+		assert.Equal(t, 1, bastion.sessions)
+		tunnel3.Close()
+	}
+
+	// closed once released by all
+	tunnel1.Close()
+	assert.Len(t, sshTunnels.sessions, 1)
+	tunnel2.Close()
+	assert.Len(t, sshTunnels.sessions, 0)
+	assert.Len(t, sshTunnels.forwards, 0)
+
+	// through a jump host, with the ProxyJump syntax
+	client = bastion.client()
+	client.TgtHost, client.TgtPort = echoHost, echoPort
+	client.ProxyJumps = []string{"sling:secret@" + jump.addr}
+	tunnel, err := OpenSSHTunnel(client)
+	if assert.NoError(t, err) {
+		conn, err := net.Dial("tcp", g.F("127.0.0.1:%d", tunnel.LocalPort))
+		testEcho(t, conn, err)
+		assert.Equal(t, []string{bastion.addr}, jump.forwards)
+		tunnel.Close()
+	}
+
+	// concurrent opens share the session being connected
+	other := newTestSSHServer(t)
+	tunnels := make([]*SSHTunnel, 5)
+	var wg sync.WaitGroup
+	for i := range tunnels {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := other.client()
+			client.TgtHost, client.TgtPort = echoHost, echoPort
+			tunnels[i], _ = OpenSSHTunnel(client)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, other.sessions)
+	for _, tunnel := range tunnels {
+		if assert.NotNil(t, tunnel) {
+			tunnel.Close()
+		}
+	}
+	assert.Len(t, sshTunnels.sessions, 0)
+
+	// dialer, such as for HTTP clients
+	dial, err := SSHDialer(bastion.client())
+	if assert.NoError(t, err) {
+		conn, err := dial(context.Background(), "tcp", g.F("%s:%d", echoHost, echoPort))
+		testEcho(t, conn, err)
+	}
+}
+
+func TestSSHKnownHosts(t *testing.T) {
+	bastion := newTestSSHServer(t)
+	other := newTestSSHServer(t)
+
+	writeKnownHosts := func(key ssh.PublicKey) string {
+		filePath := path.Join(t.TempDir(), "known_hosts")
+		line := knownhosts.Line([]string{knownhosts.Normalize(bastion.addr)}, key)
+		os.WriteFile(filePath, []byte(line+"\n"), 0600)
+		return filePath
+	}
+
+	client := bastion.client()
+	client.SetProxyProps(map[string]string{"ssh_known_hosts": writeKnownHosts(bastion.key.PublicKey())})
+	if assert.NoError(t, client.Connect()) {
+		client.Close()
+	}
+
+	// host key mismatch
+	client = bastion.client()
+	client.SetProxyProps(map[string]string{"ssh_known_hosts": writeKnownHosts(other.key.PublicKey())})
+	err := client.Connect()
+	assert.ErrorContains(t, err, "key mismatch")
+}
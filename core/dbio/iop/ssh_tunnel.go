@@ -0,0 +1,307 @@
+package iop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTunnels holds the shared SSH sessions (per host, jump hosts and credentials)
+// and the port forwards (per session and target)
+var sshTunnels = struct {
+	sessions map[string]*sshSession
+	forwards map[string]*SSHTunnel
+	mux      sync.Mutex
+}{
+	sessions: map[string]*sshSession{},
+	forwards: map[string]*SSHTunnel{},
+}
+
+type sshSession struct {
+	key    string
+	client *SSHClient
+	refs   int
+	ready  chan struct{} // closed once connected, or failed with err
+	err    error
+}
+
+// SSHTunnel is a local port forwarded to a target through a shared SSH
+// session. Use OpenSSHTunnel to open, and Close to release.
+type SSHTunnel struct {
+	LocalPort int
+	key       string
+	session   *sshSession
+	listener  net.Listener
+	conns     map[net.Conn]struct{} // the open forwarded connections
+	refs      int
+	mux       sync.Mutex
+}
+
+// NewSSHTunnelClient creates the client of the SSH tunnel of a connection,
+// from the `ssh_tunnel`, `ssh_private_key` and `ssh_passphrase` properties,
+// and the jump hosts properties (see SetProxyProps)
+func NewSSHTunnelClient(props map[string]string) (s *SSHClient, err error) {
+	s, err = NewSSHClient(props["ssh_tunnel"])
+	if err != nil {
+		return nil, g.Error(err, "could not parse SSH_TUNNEL URL")
+	}
+
+	s.PrivateKey = props["ssh_private_key"]
+	s.Passphrase = props["ssh_passphrase"]
+	s.SetProxyProps(props)
+
+	return s, nil
+}
+
+// SetProxyProps sets the jump hosts from the `ssh_jump_hosts` property (comma
+// separated, such as `user@bastion1,user@bastion2:2222`), and the host keys
+// verification from `ssh_known_hosts` (a file path, or `true` for ~/.ssh/known_hosts)
+func (s *SSHClient) SetProxyProps(props map[string]string) {
+	for _, jump := range strings.Split(props["ssh_jump_hosts"], ",") {
+		if jump = strings.TrimSpace(jump); jump != "" {
+			s.ProxyJumps = append(s.ProxyJumps, jump)
+		}
+	}
+
+	s.KnownHosts = props["ssh_known_hosts"]
+	if strings.EqualFold(s.KnownHosts, "true") {
+		s.KnownHosts = path.Join(g.UserHomeDir(), ".ssh", "known_hosts")
+	} else if strings.EqualFold(s.KnownHosts, "false") {
+		s.KnownHosts = ""
+	}
+}
+
+// sessionKey identifies a SSH session, by host, jump hosts and credentials
+func (s *SSHClient) sessionKey() string {
+	h := sha256.New()
+	for _, part := range []string{
+		s.Host, g.F("%d", s.Port), s.User, s.Password, s.PrivateKey,
+		s.Passphrase, s.KnownHosts, strings.Join(s.ProxyJumps, ","),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// acquireSSHSession returns the shared session of the client, connecting if
+// needed. The connection is made outside of the lock, so that the sessions
+// of other hosts are not blocked, the callers of the same host wait for it.
+func acquireSSHSession(s *SSHClient) (session *sshSession, err error) {
+	key := s.sessionKey()
+
+	sshTunnels.mux.Lock()
+	session, ok := sshTunnels.sessions[key]
+	if !ok {
+		client := *s
+		session = &sshSession{key: key, client: &client, refs: 1, ready: make(chan struct{})}
+		sshTunnels.sessions[key] = session
+		sshTunnels.mux.Unlock()
+
+		session.err = session.client.Connect()
+		close(session.ready)
+		if session.err != nil {
+			sshTunnels.mux.Lock()
+			session.release()
+			sshTunnels.mux.Unlock()
+			return nil, g.Error(session.err, "unable to connect to ssh server")
+		}
+
+		g.Debug("SSH session opened to %s:%d", s.Host, s.Port)
+		return session, nil
+	}
+	session.refs++ // held while waiting
+	sshTunnels.mux.Unlock()
+
+	<-session.ready
+	if session.err != nil {
+		sshTunnels.mux.Lock()
+		session.release()
+		sshTunnels.mux.Unlock()
+		return nil, g.Error(session.err, "unable to connect to ssh server")
+	}
+
+	// check that the session is still alive
+	if _, _, err = session.client.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		g.Debug("SSH session to %s:%d was closed, reconnecting", s.Host, s.Port)
+		sshTunnels.mux.Lock()
+		if sshTunnels.sessions[key] == session {
+			delete(sshTunnels.sessions, key)
+		}
+		session.release()
+		sshTunnels.mux.Unlock()
+		return acquireSSHSession(s)
+	}
+
+	return session, nil
+}
+
+// release closes the session when it is not used anymore.
+// Must be called with sshTunnels.mux locked.
+func (session *sshSession) release() {
+	session.refs--
+	if session.refs > 0 {
+		return
+	}
+
+	if sshTunnels.sessions[session.key] == session {
+		delete(sshTunnels.sessions, session.key)
+	}
+	if session.err == nil {
+		session.client.Close()
+		g.Debug("SSH session closed to %s:%d", session.client.Host, session.client.Port)
+	}
+}
+
+// OpenSSHTunnel forwards a local port to the target of the client (TgtHost:TgtPort).
+// The SSH session of a host is shared across the tunnels, and the tunnel
+// of a target is shared across the connections. They are closed once released by all.
+func OpenSSHTunnel(s *SSHClient) (tunnel *SSHTunnel, err error) {
+	session, err := acquireSSHSession(s)
+	if err != nil {
+		return nil, err
+	}
+
+	sshTunnels.mux.Lock()
+	defer sshTunnels.mux.Unlock()
+
+	key := g.F("%s|%s:%d", session.key, s.TgtHost, s.TgtPort)
+	if tunnel, ok := sshTunnels.forwards[key]; ok && tunnel.session == session {
+		session.release() // already held by the tunnel
+		tunnel.refs++
+		return tunnel, nil
+	}
+
+	tunnel = &SSHTunnel{key: key, session: session, refs: 1, conns: map[net.Conn]struct{}{}}
+	tunnel.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		session.release()
+		return nil, g.Error(err, "unable to open local port")
+	}
+	tunnel.LocalPort = tunnel.listener.Addr().(*net.TCPAddr).Port
+
+	remoteAddr := g.F("%s:%d", s.TgtHost, s.TgtPort)
+	go func() {
+		for {
+			localConn, err := tunnel.listener.Accept()
+			if err != nil {
+				if !strings.Contains(err.Error(), "use of closed network") {
+					g.LogError(err, "error accepting local connection")
+				}
+				return
+			}
+			go tunnel.forward(localConn, remoteAddr)
+		}
+	}()
+
+	sshTunnels.forwards[key] = tunnel
+
+	g.Debug(
+		"SSH tunnel established -> 127.0.0.1:%d to %s:%d ",
+		tunnel.LocalPort, s.TgtHost, s.TgtPort,
+	)
+
+	return tunnel, nil
+}
+
+func (t *SSHTunnel) forward(localConn net.Conn, remoteAddr string) {
+	remoteConn, err := t.session.client.client.Dial("tcp", remoteAddr)
+	if err != nil {
+		g.LogError(err, "unable to connect to remote server "+remoteAddr)
+		localConn.Close()
+		return
+	}
+
+	t.mux.Lock()
+	t.conns[localConn] = struct{}{}
+	t.conns[remoteConn] = struct{}{}
+	t.mux.Unlock()
+
+	go func() {
+		io.Copy(remoteConn, localConn)
+		remoteConn.Close()
+	}()
+	io.Copy(localConn, remoteConn)
+	localConn.Close()
+
+	// the connections are closed by both sides once one is done
+	remoteConn.Close()
+	t.mux.Lock()
+	delete(t.conns, localConn)
+	delete(t.conns, remoteConn)
+	t.mux.Unlock()
+}
+
+// Close releases the tunnel, which is closed when not used anymore
+func (t *SSHTunnel) Close() {
+	sshTunnels.mux.Lock()
+	defer sshTunnels.mux.Unlock()
+
+	t.refs--
+	if t.refs > 0 {
+		return
+	}
+
+	t.listener.Close()
+	t.mux.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = map[net.Conn]struct{}{}
+	t.mux.Unlock()
+
+	if sshTunnels.forwards[t.key] == t {
+		delete(sshTunnels.forwards, t.key)
+	}
+	t.session.release()
+}
+
+// DialFunc connects to the address, such as for the transport of HTTP clients
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SSHDialer returns a dial function connecting through the shared SSH session
+// of the client. The session is kept open for the life of the process.
+func SSHDialer(s *SSHClient) (dial DialFunc, err error) {
+	session, err := acquireSSHSession(s)
+	if err != nil {
+		return nil, err
+	}
+
+	key := session.key
+	dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		sshTunnels.mux.Lock()
+		session := sshTunnels.sessions[key]
+		sshTunnels.mux.Unlock()
+
+		var client *ssh.Client
+		if session != nil {
+			<-session.ready
+			sshTunnels.mux.Lock()
+			if session.err == nil {
+				client = session.client.client // nil once closed
+			}
+			sshTunnels.mux.Unlock()
+		}
+
+		if client == nil {
+			// reconnect, if the session was closed
+			session, err := acquireSSHSession(s)
+			if err != nil {
+				return nil, err
+			}
+			client = session.client.client
+		}
+
+		return client.DialContext(ctx, network, addr)
+	}
+
+	return dial, nil
+}
@@ -36,6 +36,7 @@ type StreamProcessor struct {
 	dateLayouts      []string
 	Config           *StreamConfig
 	rowBlankValCnt   int
+	rowErr           *RowError
 	transformers     Transformers
 }
 
@@ -53,6 +54,8 @@ type StreamConfig struct {
 	Flatten           bool                       `json:"flatten"`
 	FieldsPerRec      int                        `json:"fields_per_rec"`
 	Jmespath          string                     `json:"jmespath"`
+	OnRowError        RowErrorMode               `json:"on_row_error"`
+	MaxErrors         int                        `json:"max_errors"`
 	BoolAsInt         bool                       `json:"-"`
 	Columns           Columns                    `json:"columns"` // list of column types. Can be partial list! likely is!
 	transforms        map[string][]TransformFunc // array of transform functions to apply
@@ -277,6 +280,16 @@ func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
 	if configMap["bool_at_int"] != "" {
 		sp.Config.BoolAsInt = cast.ToBool(configMap["bool_at_int"])
 	}
+	if configMap["on_row_error"] != "" {
+		mode, err := NewRowErrorMode(configMap["on_row_error"])
+		if err != nil {
+			g.Warn(err.Error())
+		}
+		sp.Config.OnRowError = mode
+	}
+	if configMap["max_errors"] != "" {
+		sp.Config.MaxErrors = cast.ToInt(configMap["max_errors"])
+	}
 	if configMap["columns"] != "" {
 		g.Unmarshal(configMap["columns"], &sp.Config.Columns)
 	}
@@ -316,6 +329,26 @@ func (sp *StreamProcessor) applyTransforms(transformsPayload string) {
 	}
 }
 
+// captureCastError records a cast failure of a sourced column, when
+// on_row_error is enabled. Returns true if the row should be skipped.
+func (sp *StreamProcessor) captureCastError(i int, val any, col *Column, err error) bool {
+	if sp.ds == nil || !col.Sourced || !sp.Config.OnRowError.Enabled() {
+		return false
+	}
+
+	if sp.rowErr == nil {
+		sp.rowErr = &RowError{
+			RowNum: sp.N,
+			Column: col.Name,
+			Error:  g.F("could not cast value '%s' as %s for column '%s'", cast.ToString(val), col.Type, col.Name),
+		}
+		if err != nil {
+			sp.rowErr.Error = sp.rowErr.Error + ": " + err.Error()
+		}
+	}
+	return true
+}
+
 // CastVal  casts the type of an interface based on its value
 // From html/template/content.go
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -622,6 +655,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 			fVal, err := sp.toFloat64E(val)
 			if err != nil || sp.ds == nil {
 				// is string
+				if sp.captureCastError(i, val, col, err) {
+					return nil // row is skipped
+				}
 				sp.ds.ChangeColumn(i, StringType)
 				cs.StringCnt++
 				cs.TotalCnt++
@@ -653,6 +689,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 			fVal, err := sp.toFloat64E(val)
 			if err != nil || sp.ds == nil {
 				// is string
+				if sp.captureCastError(i, val, col, err) {
+					return nil // row is skipped
+				}
 				sp.ds.ChangeColumn(i, StringType)
 				cs.StringCnt++
 				cs.TotalCnt++
@@ -686,6 +725,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 			return nil
 		} else if err != nil {
 			// is string
+			if sp.captureCastError(i, val, col, err) {
+				return nil // row is skipped
+			}
 			sp.ds.ChangeColumn(i, StringType)
 			cs.StringCnt++
 			cs.TotalCnt++
@@ -710,6 +752,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 			return nil
 		} else if err != nil {
 			// is string
+			if sp.captureCastError(i, val, col, err) {
+				return nil // row is skipped
+			}
 			sp.ds.ChangeColumn(i, StringType)
 			cs.StringCnt++
 			cs.TotalCnt++
@@ -750,6 +795,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 		bVal, err := cast.ToBoolE(val)
 		if err != nil {
 			// is string
+			if sp.captureCastError(i, val, col, err) {
+				return nil // row is skipped
+			}
 			sp.ds.ChangeColumn(i, StringType)
 			cs.StringCnt++
 			cs.TotalCnt++
@@ -769,6 +817,9 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 			// 	"N: %d, ind: %d, val: %s", sp.N, i, cast.ToString(val),
 			// )
 			// sp.warn = true
+			if sp.captureCastError(i, val, col, err) {
+				return nil // row is skipped
+			}
 			sp.ds.ChangeColumn(i, StringType)
 			cs.StringCnt++
 			sVal = cast.ToString(val)
@@ -1057,6 +1108,7 @@ func (sp *StreamProcessor) CastRow(row []interface{}, columns Columns) []interfa
 	sp.N++
 	// Ensure usable types
 	sp.rowBlankValCnt = 0
+	sp.rowErr = nil
 	sp.rowChecksum = make([]uint64, len(row))
 	for i, val := range row {
 		// fmt.Printf("| (%s) %#v", columns[i].Type, val)
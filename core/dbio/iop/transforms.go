@@ -48,6 +48,26 @@ const (
 	TransformTrimSpace           Transform = "trim_space"
 )
 
+// readerTransforms are applied on the whole reader (see transformReader),
+// and are not registered in Transforms
+var readerTransforms = []Transform{
+	TransformEncodeLatin1,
+	TransformEncodeLatin5,
+	TransformEncodeLatin9,
+	TransformEncodeUtf8Bom,
+	TransformEncodeUtf16,
+	TransformEncodeWindows1250,
+	TransformEncodeWindows1252,
+}
+
+// IsValid returns true if the transform is known
+func (t Transform) IsValid() bool {
+	if _, ok := Transforms[t]; ok {
+		return true
+	}
+	return g.In(t, readerTransforms...)
+}
+
 // https://stackoverflow.com/a/46637343/2295355
 // https://web.itu.edu.tr/sgunduz/courses/mikroisl/ascii.html
 func ReplaceNonPrintable(val string) string {
@@ -0,0 +1,252 @@
+package sling
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Client runs sling tasks and replications from Go code, such as in a
+// service. The options apply to the runs of the client only, so several
+// clients (or runs of the same client) can be used concurrently. The env
+// values of the configs are read from the configs, instead of being set in
+// the process environment, and the secrets are cached for each run.
+//
+// The connections are resolved with the connection provider first (see
+// WithConnectionProvider), then from the environment variables,
+// env.yaml and dbt profiles, as with the CLI.
+type Client struct {
+	logger      *slog.Logger
+	onProgress  func(Progress)
+	connections ConnectionProvider
+	store       StateStore
+	timeout     time.Duration
+}
+
+// Option configures a Client
+type Option func(c *Client)
+
+// ConnectionProvider returns the connection of a name, such as from a
+// secrets manager. If ok is false, the name is looked up in the environment.
+type ConnectionProvider func(name string) (conn connection.Connection, ok bool)
+
+// Progress is the state of a task, sent to the progress callback
+type Progress struct {
+	ExecID  string     `json:"exec_id"`
+	Stream  string     `json:"stream"`
+	Stage   string     `json:"stage"`
+	Status  ExecStatus `json:"status"`
+	Rows    uint64     `json:"rows"`
+	Bytes   uint64     `json:"bytes"`
+	Message string     `json:"message"`
+}
+
+// NewClient returns a client with the options
+func NewClient(opts ...Option) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithLogger logs the progress messages and warnings of the tasks with the
+// logger, with the exec_id and stream attributes. The other messages
+// (such as debug and connection messages) go to the sling logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) { c.logger = logger }
+}
+
+// WithProgress calls the callback at each stage and progress message of
+// the tasks, and every second while running
+func WithProgress(callback func(Progress)) Option {
+	return func(c *Client) { c.onProgress = callback }
+}
+
+// WithTimeout cancels each run (task or replication) after the timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+// WithConnectionProvider resolves the connection names with the provider
+func WithConnectionProvider(provider ConnectionProvider) Option {
+	return func(c *Client) { c.connections = provider }
+}
+
+// WithConnections resolves the connection names with the connections
+// (case-insensitive), instead of the environment
+func WithConnections(conns ...connection.Connection) Option {
+	connsMap := map[string]connection.Connection{}
+	for _, conn := range conns {
+		connsMap[strings.ToLower(conn.Name)] = conn
+	}
+
+	return WithConnectionProvider(func(name string) (conn connection.Connection, ok bool) {
+		conn, ok = connsMap[strings.ToLower(name)]
+		return
+	})
+}
+
+// WithStateStore saves the executions with the store, instead of the
+// local .sling.db (when the store package is imported)
+func WithStateStore(store StateStore) Option {
+	return func(c *Client) { c.store = store }
+}
+
+// RunTask runs a task. Cancelling the context interrupts it.
+// The task is returned even if it failed, with its counts and status.
+func (c *Client) RunTask(ctx context.Context, cfg *Config) (task *TaskExecution, err error) {
+	if cfg.HasWildcard() {
+		return nil, g.Error("stream %s has a wildcard, use RunReplication with cfg.AsReplication()", cfg.Source.Stream)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// secrets are resolved again for each run
+	task, err = c.newTask(NewExecID(), cfg, connection.NewSecretCache())
+	if err != nil {
+		return task, err
+	}
+
+	return task, c.execute(ctx, task)
+}
+
+// RunReplication runs the streams of the replication, one after the other,
+// with the same exec id. The streams can be selected with patterns (such
+// as `my_schema.*`). The tasks are returned with the errors of the failed
+// streams. Cancelling the context interrupts the run.
+func (c *Client) RunReplication(ctx context.Context, replication ReplicationConfig, streams ...string) (tasks []*TaskExecution, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cfgs, err := replication.Compile(nil, streams...)
+	if err != nil {
+		return nil, g.Error(err, "could not compile replication")
+	}
+
+	traceCtx, span := StartSpan(ctx, "replication",
+		attribute.String("sling.source", replication.Source),
+		attribute.String("sling.target", replication.Target),
+		attribute.Int("sling.streams", len(cfgs)),
+	)
+	defer func() { EndSpan(span, err) }()
+
+	execID := NewExecID()
+	secrets := connection.NewSecretCache()
+	eG := g.ErrorGroup{}
+	for i := range cfgs {
+		if err = ctx.Err(); err != nil {
+			eG.Capture(g.Error(err, "replication interrupted"))
+			break
+		}
+
+		task, err := c.newTask(execID, &cfgs[i], secrets)
+		if task != nil {
+			task.Replication = &replication
+			task.TraceCtx = traceCtx
+			tasks = append(tasks, task)
+		}
+		if err == nil {
+			err = c.execute(ctx, task)
+		}
+		if err != nil {
+			eG.Capture(g.Error(err, "error for stream %s", cfgs[i].StreamName))
+		}
+	}
+
+	return tasks, eG.Err()
+}
+
+// newTask creates the task, with the connections and hooks of the client,
+// and the secrets of the run
+func (c *Client) newTask(execID string, cfg *Config, secrets *connection.SecretCache) (task *TaskExecution, err error) {
+	cfg.localEnv = true
+	cfg.secrets = secrets
+
+	if c.connections != nil && !cfg.Prepared {
+		if conn, ok := c.connections(cfg.Source.Conn); ok && cfg.Source.Conn != "" {
+			cfg.SrcConn = *conn.Copy()
+			cfg.Source.Data = cfg.SrcConn.Data
+		}
+		if conn, ok := c.connections(cfg.Target.Conn); ok && cfg.Target.Conn != "" {
+			cfg.TgtConn = *conn.Copy()
+			cfg.Target.Data = cfg.TgtConn.Data
+		}
+	}
+
+	task = newTask(execID, cfg, false)
+	task.store = c.store
+	task.logger = c.logger
+	task.onProgress = c.onProgress
+	if task.Err != nil {
+		return task, g.Error(task.Err, "could not create task")
+	}
+
+	return task, nil
+}
+
+// execute runs the task with the context, sending the progress every
+// second while running
+func (c *Client) execute(ctx context.Context, task *TaskExecution) (err error) {
+	taskCtx := g.NewContext(ctx)
+	task.Context = &taskCtx
+	task.storeInsert()
+
+	if task.onProgress != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					task.sendProgress()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	err = task.Execute()
+	task.sendProgress()
+
+	return err
+}
+
+// sendProgress calls the progress callback of the client, if any
+func (t *TaskExecution) sendProgress() {
+	if t.onProgress == nil {
+		return
+	}
+
+	// the task is running, its state is read with its lock
+	t.stateMux.Lock()
+	stage, status, message := t.stage, t.Status, t.Progress
+	t.stateMux.Unlock()
+
+	bytes, _ := t.GetBytes()
+	t.onProgress(Progress{
+		ExecID:  t.ExecID,
+		Stream:  t.streamName(),
+		Stage:   stage,
+		Status:  status,
+		Rows:    t.GetCount(),
+		Bytes:   bytes,
+		Message: message,
+	})
+}
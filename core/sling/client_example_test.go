@@ -0,0 +1,108 @@
+package sling_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/sling"
+)
+
+func ExampleClient_RunTask() {
+	folder, _ := os.MkdirTemp("", "sling_example")
+	defer os.RemoveAll(folder)
+	os.WriteFile(filepath.Join(folder, "accounts.csv"), []byte("id,name\n1,alice\n2,bob\n"), 0644)
+
+	client := sling.NewClient(
+		sling.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		sling.WithTimeout(time.Minute),
+	)
+
+	task, err := client.RunTask(context.Background(), &sling.Config{
+		Source: sling.Source{Conn: "LOCAL", Stream: "file://" + filepath.Join(folder, "accounts.csv")},
+		Target: sling.Target{Conn: "LOCAL", Object: "file://" + filepath.Join(folder, "accounts.json")},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(task.Status, task.GetCount())
+	// Output: success 2
+}
+
+func ExampleClient_RunReplication() {
+	replication, err := sling.UnmarshalReplication(`
+source: MY_POSTGRES
+target: MY_SNOWFLAKE
+defaults:
+  mode: full-refresh
+  object: 'raw.{stream_schema}_{stream_table}'
+streams:
+  public.accounts:
+  public.orders:
+    mode: incremental
+    primary_key: [id]
+    update_key: updated_at
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := sling.NewClient(
+		sling.WithProgress(func(p sling.Progress) {
+			fmt.Printf("%s | %s | %d rows\n", p.Stream, p.Stage, p.Rows)
+		}),
+	)
+
+	// runs the selected streams, one after the other
+	tasks, err := client.RunReplication(context.Background(), replication, "public.*")
+	for _, task := range tasks {
+		fmt.Println(task.Config.StreamName, task.Status)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleWithConnections() {
+	// connections from a secrets manager, instead of env variables
+	postgres, _ := connection.NewConnection("MY_POSTGRES", dbio.TypeDbPostgres, map[string]any{
+		"url": os.Getenv("POSTGRES_URL"),
+	})
+	warehouse, _ := connection.NewConnection("MY_WAREHOUSE", dbio.TypeDbSnowflake, map[string]any{
+		"url": os.Getenv("SNOWFLAKE_URL"),
+	})
+
+	client := sling.NewClient(sling.WithConnections(postgres, warehouse))
+
+	// tasks can run concurrently
+	targets := map[string]string{
+		"public.accounts": "raw.accounts",
+		"public.orders":   "raw.orders",
+	}
+
+	wg := sync.WaitGroup{}
+	for table, target := range targets {
+		wg.Add(1)
+		go func(table, target string) {
+			defer wg.Done()
+			_, err := client.RunTask(context.Background(), &sling.Config{
+				Source: sling.Source{Conn: "MY_POSTGRES", Stream: table},
+				Target: sling.Target{Conn: "MY_WAREHOUSE", Object: target},
+				Mode:   sling.FullRefreshMode,
+			})
+			if err != nil {
+				log.Println(err)
+			}
+		}(table, target)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStateStore struct {
+	inserted, updated map[string]int
+	mux               sync.Mutex
+}
+
+func (s *testStateStore) Insert(t *TaskExecution) {
+	s.mux.Lock()
+	s.inserted[t.ExecID]++
+	s.mux.Unlock()
+}
+
+func (s *testStateStore) Update(t *TaskExecution) {
+	s.mux.Lock()
+	s.updated[t.ExecID]++
+	s.mux.Unlock()
+}
+
+func TestClient(t *testing.T) {
+	folder := t.TempDir()
+	for i := 0; i < 4; i++ {
+		content := "id,name\n" + strings.Repeat(g.F("%d,name\n", i), i+1)
+		os.WriteFile(path.Join(folder, g.F("file%d.csv", i)), []byte(content), 0644)
+	}
+
+	store := &testStateStore{inserted: map[string]int{}, updated: map[string]int{}}
+	progress := map[string]Progress{}
+	progressMux := sync.Mutex{}
+	client := NewClient(
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithStateStore(store),
+		WithProgress(func(p Progress) {
+			progressMux.Lock()
+			progress[p.Stream] = p
+			progressMux.Unlock()
+		}),
+	)
+
+	// concurrent tasks
+	wg := sync.WaitGroup{}
+	tasks := make([]*TaskExecution, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			tasks[i], err = client.RunTask(context.Background(), &Config{
+				Source: Source{Conn: "LOCAL", Stream: "file://" + path.Join(folder, g.F("file%d.csv", i))},
+				Target: Target{Conn: "LOCAL", Object: "file://" + path.Join(folder, g.F("out%d.csv", i))},
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, task := range tasks {
+		if !assert.NotNil(t, task) {
+			continue
+		}
+		assert.Equal(t, ExecStatusSuccess, task.Status)
+		assert.EqualValues(t, i+1, task.GetCount())
+		assert.Equal(t, 1, store.inserted[task.ExecID])
+		assert.Greater(t, store.updated[task.ExecID], 0)
+
+		p := progress[task.Config.Source.Stream]
+		assert.Equal(t, task.ExecID, p.ExecID)
+		assert.Equal(t, ExecStatusSuccess, p.Status)
+		assert.EqualValues(t, i+1, p.Rows)
+	}
+
+	// replication, with the connection provider
+	local, _ := connection.NewConnection("MY_FOLDER", dbio.TypeFileLocal, g.M("type", "file"))
+	client = NewClient(WithConnections(local), WithStateStore(store))
+	replication := ReplicationConfig{
+		Source:   "MY_FOLDER",
+		Target:   "MY_FOLDER",
+		Defaults: ReplicationStreamConfig{Mode: FullRefreshMode},
+		Streams: map[string]*ReplicationStreamConfig{
+			"file://" + path.Join(folder, "file1.csv"): {Object: "file://" + path.Join(folder, "repl1.csv")},
+			"file://" + path.Join(folder, "file2.csv"): {Object: "file://" + path.Join(folder, "repl2.csv")},
+			"file://" + path.Join(folder, "file3.csv"): {Object: "file://" + path.Join(folder, "repl3.csv"), Disabled: true},
+		},
+	}
+
+	replTasks, err := client.RunReplication(context.Background(), replication)
+	if assert.NoError(t, err) && assert.Len(t, replTasks, 2) {
+		assert.Equal(t, replTasks[0].ExecID, replTasks[1].ExecID)
+		assert.EqualValues(t, 2, replTasks[0].GetCount())
+		assert.EqualValues(t, 3, replTasks[1].GetCount())
+	}
+
+	// cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.RunReplication(ctx, replication)
+	assert.Error(t, err)
+
+	// the env stays in the config, the secrets are resolved for each run
+	resolved := 0
+	connection.RegisterSecretProvider("client_test", func(ref string) (string, error) {
+		resolved++
+		return "value", nil
+	})
+	secretFolder, _ := connection.NewConnection("MY_SECRET_FOLDER", dbio.TypeFileLocal, g.M("type", "file", "note", "${secret:client_test:note}"))
+	client = NewClient(WithConnections(secretFolder), WithStateStore(store))
+	for i := 0; i < 2; i++ {
+		_, err = client.RunTask(context.Background(), &Config{
+			Source: Source{Conn: "MY_SECRET_FOLDER", Stream: "file://" + path.Join(folder, "file0.csv")},
+			Target: Target{Conn: "MY_SECRET_FOLDER", Object: "file://" + path.Join(folder, "env.csv")},
+			Env:    map[string]string{"SLING_TEST_CLIENT_ENV": "1"},
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, resolved)
+	assert.Empty(t, os.Getenv("SLING_TEST_CLIENT_ENV"))
+}
@@ -134,9 +134,11 @@ func (cfg *Config) SetDefault() {
 		cfg.Target.Options.DatetimeFormat = "2006-01-02 15:04:05.000000-07"
 	}
 
-	// set vars
-	for k, v := range cfg.Env {
-		os.Setenv(k, v)
+	// set vars, unless kept in the config (see getEnv)
+	if !cfg.localEnv {
+		for k, v := range cfg.Env {
+			os.Setenv(k, v)
+		}
 	}
 
 	// default mode
@@ -144,16 +146,16 @@ func (cfg *Config) SetDefault() {
 		cfg.Mode = FullRefreshMode
 	}
 
-	if val := os.Getenv("SLING_LOADED_AT_COLUMN"); val != "" {
+	if val := cfg.getEnv("SLING_LOADED_AT_COLUMN"); val != "" {
 		cfg.MetadataLoadedAt = cast.ToBool(val)
 	}
-	if val := os.Getenv("SLING_STREAM_URL_COLUMN"); val != "" {
+	if val := cfg.getEnv("SLING_STREAM_URL_COLUMN"); val != "" {
 		cfg.MetadataStreamURL = cast.ToBool(val)
 	}
-	if val := os.Getenv("SLING_ROW_ID_COLUMN"); val != "" {
+	if val := cfg.getEnv("SLING_ROW_ID_COLUMN"); val != "" {
 		cfg.MetadataRowID = cast.ToBool(val)
 	}
-	if val := os.Getenv("SLING_ROW_NUM_COLUMN"); val != "" {
+	if val := cfg.getEnv("SLING_ROW_NUM_COLUMN"); val != "" {
 		cfg.MetadataRowNum = cast.ToBool(val)
 	}
 	if val := os.Getenv("SAMPLE_SIZE"); val != "" {
@@ -180,6 +182,17 @@ func (cfg *Config) Unmarshal(cfgStr string) error {
 		}
 	}
 
+	return cfg.unmarshal(cfgStr, cfgBytes, errStat)
+}
+
+// UnmarshalInline parses a YAML or JSON config. Unlike Unmarshal,
+// the string is never read as a file path, such as for API requests.
+func (cfg *Config) UnmarshalInline(cfgStr string) error {
+	cfgStr = expandEnvVars(cfgStr)
+	return cfg.unmarshal(cfgStr, []byte(cfgStr), g.Error("not a YAML or JSON config"))
+}
+
+func (cfg *Config) unmarshal(cfgStr string, cfgBytes []byte, errStat error) error {
 	err := yaml.Unmarshal(cfgBytes, cfg)
 	if err != nil {
 		if errStat != nil && !strings.Contains(cfgStr, "\n") && !strings.Contains(cfgStr, ": ") {
@@ -211,7 +224,7 @@ func (cfg *Config) Unmarshal(cfgStr string) error {
 	}
 
 	// add config path
-	if g.PathExists(cfgStr) && !cfg.ReplicationMode {
+	if errStat == nil && !cfg.ReplicationMode {
 		cfg.Env["SLING_CONFIG_PATH"] = cfgStr
 	}
 
@@ -233,17 +246,9 @@ func (cfg *Config) sourceIsFile() bool {
 	return cfg.Options.StdIn || cfg.SrcConn.Info().Type.IsFile()
 }
 
-func (cfg *Config) DetermineType() (Type JobType, err error) {
-
-	srcFileProvided := cfg.sourceIsFile()
-	tgtFileProvided := cfg.Options.StdOut || cfg.TgtConn.Info().Type.IsFile()
-	srcDbProvided := cfg.SrcConn.Info().Type.IsDb()
-	tgtDbProvided := cfg.TgtConn.Info().Type.IsDb()
-	srcStreamProvided := cfg.Source.Stream != ""
-
-	summary := g.F("srcFileProvided: %t, tgtFileProvided: %t, srcDbProvided: %t, tgtDbProvided: %t, srcStreamProvided: %t", srcFileProvided, tgtFileProvided, srcDbProvided, tgtDbProvided, srcStreamProvided)
-	g.Trace(summary)
-
+// setMode sets the default mode if blank, and validates that
+// the keys required by the mode are provided
+func (cfg *Config) setMode() (err error) {
 	if cfg.Mode == "" {
 		if cfg.Source.PrimaryKeyI != nil || cfg.Source.UpdateKey != "" {
 			cfg.Mode = IncrementalMode
@@ -268,7 +273,7 @@ func (cfg *Config) DetermineType() (Type JobType, err error) {
 			if cfg.Source.UpdateKey == "" {
 				cfg.Source.UpdateKey = "_bigtable_timestamp"
 			}
-		} else if srcFileProvided && cfg.Source.UpdateKey == slingLoadedAtColumn {
+		} else if cfg.sourceIsFile() && cfg.Source.UpdateKey == slingLoadedAtColumn {
 			// need to loaded_at column for file incremental
 			cfg.MetadataLoadedAt = true
 		} else if cfg.Source.UpdateKey == "" && len(cfg.Source.PrimaryKey()) == 0 {
@@ -297,6 +302,28 @@ func (cfg *Config) DetermineType() (Type JobType, err error) {
 		cfg.MetadataLoadedAt = true // needed for snapshot mode
 	}
 
+	return
+}
+
+func (cfg *Config) DetermineType() (Type JobType, err error) {
+
+	srcFileProvided := cfg.sourceIsFile()
+	tgtFileProvided := cfg.Options.StdOut || cfg.TgtConn.Info().Type.IsFile()
+	srcDbProvided := cfg.SrcConn.Info().Type.IsDb()
+	tgtDbProvided := cfg.TgtConn.Info().Type.IsDb()
+	srcStreamProvided := cfg.Source.Stream != ""
+
+	summary := g.F("srcFileProvided: %t, tgtFileProvided: %t, srcDbProvided: %t, tgtDbProvided: %t, srcStreamProvided: %t", srcFileProvided, tgtFileProvided, srcDbProvided, tgtDbProvided, srcStreamProvided)
+	g.Trace(summary)
+
+	if err = cfg.setMode(); err != nil {
+		return
+	}
+
+	if err = cfg.RetryPolicy.Validate(); err != nil {
+		return
+	}
+
 	if srcDbProvided && tgtDbProvided {
 		Type = DbToDb
 	} else if srcFileProvided && tgtDbProvided {
@@ -399,7 +426,7 @@ func (cfg *Config) Prepare() (err error) {
 		return g.Error("invalid target connection (blank or not found)")
 	}
 
-	if cfg.Options.Debug && os.Getenv("DEBUG") == "" {
+	if cfg.Options.Debug && os.Getenv("DEBUG") == "" && !cfg.localEnv {
 		os.Setenv("DEBUG", "LOW")
 	}
 	if cfg.Options.StdIn && cfg.Source.Stream == "" {
@@ -434,6 +461,10 @@ func (cfg *Config) Prepare() (err error) {
 		cfg.Target.Data = cfg.TgtConn.Data
 	}
 
+	if err = cfg.TgtConn.ResolveWith(cfg.secrets); err != nil {
+		return g.Error(err, "could not resolve target connection")
+	}
+
 	if connection.SchemeType(cfg.Target.Object).IsFile() {
 		if connection.SchemeType(cfg.Target.Object) == dbio.TypeFileLocal {
 			cfg.Target.Object = strings.ReplaceAll(cfg.Target.Object, `\`, `/`) // windows path fix
@@ -461,11 +492,13 @@ func (cfg *Config) Prepare() (err error) {
 		))
 		if err != nil {
 			return g.Error(err, "could not create data conn for target")
+		} else if err = tgtConn.ResolveWith(cfg.secrets); err != nil {
+			return g.Error(err, "could not resolve target connection")
 		}
 		cfg.TgtConn = tgtConn
 	}
 
-	if cfg.Options.StdOut {
+	if cfg.Options.StdOut && !cfg.localEnv {
 		os.Setenv("CONCURRENCY", "1")
 	}
 
@@ -492,6 +525,10 @@ func (cfg *Config) Prepare() (err error) {
 		cfg.Source.Data = cfg.SrcConn.Data
 	}
 
+	if err = cfg.SrcConn.ResolveWith(cfg.secrets); err != nil {
+		return g.Error(err, "could not resolve source connection")
+	}
+
 	if connection.SchemeType(cfg.Source.Stream) == dbio.TypeFileLocal {
 		cfg.Source.Stream = strings.ReplaceAll(cfg.Source.Stream, `\`, `/`) // windows path fix
 	}
@@ -515,6 +552,8 @@ func (cfg *Config) Prepare() (err error) {
 		srcConn, err := connection.NewConnectionFromMap(g.M("name", cfg.Source.Conn, "data", cfg.Source.Data))
 		if err != nil {
 			return g.Error(err, "could not create data conn for source")
+		} else if err = srcConn.ResolveWith(cfg.secrets); err != nil {
+			return g.Error(err, "could not resolve source connection")
 		}
 		cfg.SrcConn = srcConn
 	}
@@ -542,6 +581,10 @@ func (cfg *Config) Prepare() (err error) {
 	cfg.SrcConn.Data["_source_options_md5"] = g.MD5(g.Marshal(cfg.Source.Options))
 	cfg.TgtConn.Data["_target_options_md5"] = g.MD5(g.Marshal(cfg.Target.Options))
 
+	// the retry policy of the target, then source connection, for the unset values
+	cfg.RetryPolicy.SetDefaults(connRetryPolicy(cfg.TgtConn))
+	cfg.RetryPolicy.SetDefaults(connRetryPolicy(cfg.SrcConn))
+
 	// validate table keys
 	if tkMap := cfg.Target.Options.TableKeys; tkMap != nil {
 		for _, kt := range lo.Keys(tkMap) {
@@ -555,6 +598,24 @@ func (cfg *Config) Prepare() (err error) {
 		}
 	}
 
+	// validate on_row_error
+	if onRowError := cfg.Target.Options.OnRowError; onRowError != nil {
+		mode, err := iop.NewRowErrorMode(string(*onRowError))
+		if err != nil {
+			return g.Error(err, "invalid target option")
+		}
+		cfg.Target.Options.OnRowError = &mode
+	}
+
+	// validate schema contract
+	if contract := cfg.Target.Options.SchemaContract; contract != nil {
+		if !cfg.TgtConn.Type.IsDb() {
+			return g.Error("schema_contract is only supported for database targets, not %s", cfg.TgtConn.Type)
+		} else if err = contract.Validate(); err != nil {
+			return g.Error(err, "invalid schema_contract")
+		}
+	}
+
 	// validate conn data keys
 	for key := range cfg.SrcConn.Data {
 		if strings.Contains(key, ":") {
@@ -692,6 +753,10 @@ func (cfg *Config) GetFormatMap() (m map[string]any, err error) {
 	}
 
 	if cfg.SrcConn.Type.IsFile() {
+		if err = cfg.SrcConn.ResolveWith(cfg.secrets); err != nil {
+			return m, g.Error(err, "could not resolve source connection")
+		}
+
 		uri := cfg.SrcConn.URL()
 		m["stream_name"] = strings.ToLower(cfg.Source.Stream)
 
@@ -799,6 +864,8 @@ type Config struct {
 	Options ConfigOptions     `json:"options,omitempty" yaml:"options,omitempty"`
 	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
 
+	RetryPolicy `yaml:",inline"`
+
 	StreamName      string                `json:"stream_name,omitempty" yaml:"stream_name,omitempty"`
 	SrcConn         connection.Connection `json:"_src_conn,omitempty" yaml:"_src_conn,omitempty"`
 	TgtConn         connection.Connection `json:"_tgt_conn,omitempty" yaml:"_tgt_conn,omitempty"`
@@ -810,6 +877,24 @@ type Config struct {
 	MetadataStreamURL bool `json:"-" yaml:"-"`
 	MetadataRowNum    bool `json:"-" yaml:"-"`
 	MetadataRowID     bool `json:"-" yaml:"-"`
+
+	localEnv bool                    // the env values are read from the config, not set in the process
+	secrets  *connection.SecretCache // the secrets of the run, instead of the process cache
+}
+
+// getEnv returns the value of the env variable, from the env of the
+// config first when it is not set in the process (see localEnv)
+func (cfg *Config) getEnv(key string) string {
+	if val, ok := cfg.Env[key]; ok && cfg.localEnv {
+		return val
+	}
+	return os.Getenv(key)
+}
+
+// SetSecretCache sets the cache of the secrets of the run,
+// such as for a job of sling serve (the process cache if nil)
+func (cfg *Config) SetSecretCache(cache *connection.SecretCache) {
+	cfg.secrets = cache
 }
 
 // Scan scan value into Jsonb, implements sql.Scanner interface
@@ -975,6 +1060,13 @@ type TargetOptions struct {
 	AddNewColumns    *bool               `json:"add_new_columns,omitempty" yaml:"add_new_columns,omitempty"`
 	AdjustColumnType *bool               `json:"adjust_column_type,omitempty" yaml:"adjust_column_type,omitempty"`
 	ColumnCasing     *ColumnCasing       `json:"column_casing,omitempty" yaml:"column_casing,omitempty"`
+	OnRowError       *iop.RowErrorMode   `json:"on_row_error,omitempty" yaml:"on_row_error,omitempty"`
+	DeadLetter       string              `json:"dead_letter,omitempty" yaml:"dead_letter,omitempty"`
+	MaxErrors        *int                `json:"max_errors,omitempty" yaml:"max_errors,omitempty"`
+	SchemaContract   *SchemaContract     `json:"schema_contract,omitempty" yaml:"schema_contract,omitempty"`
+	RemoteWrite      *RemoteWriteOptions `json:"remote_write,omitempty" yaml:"remote_write,omitempty"`
+	CopyFormat       string              `json:"copy_format,omitempty" yaml:"copy_format,omitempty"`
+	TableEngine      string              `json:"table_engine,omitempty" yaml:"table_engine,omitempty"`
 
 	TableKeys database.TableKeys `json:"table_keys,omitempty" yaml:"table_keys,omitempty"`
 	TableTmp  string             `json:"table_tmp,omitempty" yaml:"table_tmp,omitempty"`
@@ -983,6 +1075,40 @@ type TargetOptions struct {
 	PostSQL   string             `json:"post_sql,omitempty" yaml:"post_sql,omitempty"`
 }
 
+// RemoteWriteOptions maps the stream columns to series, when writing into
+// Prometheus (or Mimir, VictoriaMetrics) with the remote-write protocol
+type RemoteWriteOptions struct {
+	Metric          string   `json:"metric,omitempty" yaml:"metric,omitempty"`                     // default is the __name__ column, or the object name
+	TimestampColumn string   `json:"timestamp_column,omitempty" yaml:"timestamp_column,omitempty"` // default is timestamp
+	ValueColumn     string   `json:"value_column,omitempty" yaml:"value_column,omitempty"`         // default is value
+	LabelColumns    []string `json:"label_columns,omitempty" yaml:"label_columns,omitempty"`       // default is the other columns
+	BatchSize       int      `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`             // samples per request, default is 5000
+}
+
+// Props returns the connection properties of the options
+func (o *RemoteWriteOptions) Props() map[string]string {
+	props := map[string]string{}
+	if o == nil {
+		return props
+	}
+	if o.Metric != "" {
+		props["metric_name"] = o.Metric
+	}
+	if o.TimestampColumn != "" {
+		props["timestamp_column"] = o.TimestampColumn
+	}
+	if o.ValueColumn != "" {
+		props["value_column"] = o.ValueColumn
+	}
+	if len(o.LabelColumns) > 0 {
+		props["label_columns"] = strings.Join(o.LabelColumns, ",")
+	}
+	if o.BatchSize > 0 {
+		props["batch_size"] = cast.ToString(o.BatchSize)
+	}
+	return props
+}
+
 var SourceFileOptionsDefault = SourceOptions{
 	TrimSpace:      g.Bool(false),
 	EmptyAsNull:    g.Bool(true),
@@ -1155,6 +1281,24 @@ func (o *TargetOptions) SetDefaults(targetOptions TargetOptions) {
 	if o.TableKeys == nil {
 		o.TableKeys = targetOptions.TableKeys
 	}
+	if o.OnRowError == nil {
+		o.OnRowError = targetOptions.OnRowError
+	}
+	if o.DeadLetter == "" {
+		o.DeadLetter = targetOptions.DeadLetter
+	}
+	if o.MaxErrors == nil {
+		o.MaxErrors = targetOptions.MaxErrors
+	}
+	if o.SchemaContract == nil {
+		o.SchemaContract = targetOptions.SchemaContract
+	}
+	if o.CopyFormat == "" {
+		o.CopyFormat = targetOptions.CopyFormat
+	}
+	if o.TableEngine == "" {
+		o.TableEngine = targetOptions.TableEngine
+	}
 }
 
 func castKeyArray(keyI any) (key []string) {
@@ -0,0 +1,149 @@
+package sling
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+)
+
+// deadLetterColumns are the columns of the dead-letter file or table
+var deadLetterColumns = iop.NewColumns(
+	iop.Column{Name: "exec_id", Type: iop.StringType},
+	iop.Column{Name: "stream_name", Type: iop.StringType},
+	iop.Column{Name: "stream_url", Type: iop.StringType},
+	iop.Column{Name: "row_num", Type: iop.BigIntType},
+	iop.Column{Name: "column_name", Type: iop.StringType},
+	iop.Column{Name: "error", Type: iop.TextType},
+	iop.Column{Name: "record", Type: iop.TextType},
+	iop.Column{Name: "created_at", Type: iop.DatetimeType},
+)
+
+// RowErrorMode returns the configured on_row_error mode
+func (cfg *Config) RowErrorMode() iop.RowErrorMode {
+	if cfg.Target.Options == nil || cfg.Target.Options.OnRowError == nil {
+		return iop.RowErrorModeFail
+	}
+	return *cfg.Target.Options.OnRowError
+}
+
+// deadLetterTarget returns the dead-letter location. It is either a
+// file path / URL, or a table name when the target is a database.
+func (cfg *Config) deadLetterTarget(execID string) (target string, isTable bool) {
+	target = strings.TrimSpace(cfg.Target.Options.DeadLetter)
+	switch {
+	case target == "":
+		fileName := g.F("%s_%s.csv", iop.CleanName(cfg.StreamName), execID)
+		return "file://" + path.Join(env.HomeDir, "dead_letter", fileName), false
+	case strings.Contains(target, "://"):
+		return target, false
+	case cfg.TgtConn.Type.IsDb() && !strings.Contains(target, "/"):
+		return target, true
+	}
+	return "file://" + target, false
+}
+
+// writeDeadLetter writes the bad rows collected during the run into the
+// dead-letter target
+func (t *TaskExecution) writeDeadLetter() (err error) {
+	if t.df == nil || !t.Config.RowErrorMode().Enabled() {
+		return nil
+	}
+
+	skipped := t.df.RowErrorCount()
+	if skipped == 0 {
+		return nil
+	}
+
+	if t.Config.RowErrorMode() == iop.RowErrorModeSkip {
+		t.warn("skipped %d bad rows", skipped)
+		return nil
+	}
+
+	data := iop.NewDataset(deadLetterColumns)
+	now := time.Now()
+	for _, rowErr := range t.df.RowErrors() {
+		data.Append([]any{
+			t.ExecID, t.Config.StreamName, rowErr.StreamURL, rowErr.RowNum,
+			rowErr.Column, rowErr.Error, rowErr.Record(), now,
+		})
+	}
+
+	target, isTable := t.Config.deadLetterTarget(t.ExecID)
+	if isTable {
+		err = t.writeDeadLetterTable(target, data)
+	} else {
+		err = t.writeDeadLetterFile(target, data)
+	}
+	if err != nil {
+		return g.Error(err, "could not write dead-letter rows to %s", target)
+	}
+
+	t.warn("skipped %d bad rows, written to %s", skipped, target)
+	return nil
+}
+
+func (t *TaskExecution) writeDeadLetterFile(url string, data iop.Dataset) (err error) {
+	// use the target connection properties if on same file system
+	props := []string{}
+	if t.Config.TgtConn.Type.IsFile() {
+		if fsType, _, _, _ := dbio.ParseURL(url); fsType == t.Config.TgtConn.Type {
+			props = g.MapToKVArr(t.Config.TgtConn.DataS())
+		}
+	}
+
+	fs, err := filesys.NewFileSysClientFromURLContext(context.Background(), url, props...)
+	if err != nil {
+		return g.Error(err, "could not initialize file system client")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err = data.WriteCsv(buf); err != nil {
+		return g.Error(err, "could not write csv")
+	}
+
+	_, err = fs.Write(url, buf)
+	if err != nil {
+		return g.Error(err, "could not write file")
+	}
+	return nil
+}
+
+func (t *TaskExecution) writeDeadLetterTable(tableName string, data iop.Dataset) (err error) {
+	conn, err := t.getTgtDBConn(context.Background())
+	if err != nil {
+		return g.Error(err, "could not initialize target connection")
+	}
+
+	if err = conn.Connect(); err != nil {
+		return g.Error(err, "could not connect to target")
+	}
+	if !t.isUsingPool() {
+		defer conn.Close()
+	}
+
+	table, err := database.ParseTableName(tableName, conn.GetType())
+	if err != nil {
+		return g.Error(err, "could not parse dead-letter table name")
+	}
+	table.Columns = data.Columns
+
+	_, err = createTableIfNotExists(conn, data, &table)
+	if err != nil {
+		return g.Error(err, "could not create dead-letter table")
+	}
+
+	_, err = conn.InsertBatchStream(table.FullName(), data.Stream())
+	if err != nil {
+		return g.Error(err, "could not insert into dead-letter table")
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package sling
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/spf13/cast"
+)
+
+// metricsRegistry holds the metrics of the tasks executed in this process
+var metricsRegistry = prometheus.NewRegistry()
+
+var metricsLabels = []string{"stream", "source", "target"}
+
+// metricsDescs are the metrics exposed per stream
+var metricsDescs = struct {
+	rowsRead, rowsWritten, bytesRead, bytesWritten, rowRate *prometheus.Desc
+	running, stage, attempts, errors, duration, lastSuccess *prometheus.Desc
+}{
+	rowsRead:     prometheus.NewDesc("sling_stream_rows_read", "Rows read from the source in the last execution", metricsLabels, nil),
+	rowsWritten:  prometheus.NewDesc("sling_stream_rows_written", "Rows written into the target in the last execution", metricsLabels, nil),
+	bytesRead:    prometheus.NewDesc("sling_stream_bytes_read", "Bytes read from the source in the last execution", metricsLabels, nil),
+	bytesWritten: prometheus.NewDesc("sling_stream_bytes_written", "Bytes written into the target in the last execution", metricsLabels, nil),
+	rowRate:      prometheus.NewDesc("sling_stream_rows_per_second", "Average rows per second of the last execution", metricsLabels, nil),
+	running:      prometheus.NewDesc("sling_stream_running", "Whether the stream is running (1) or not (0)", metricsLabels, nil),
+	stage:        prometheus.NewDesc("sling_stream_stage", "The current stage of the running stream", append(metricsLabels, "stage"), nil),
+	attempts:     prometheus.NewDesc("sling_stream_attempts", "Attempts of the last execution (see retries)", metricsLabels, nil),
+	errors:       prometheus.NewDesc("sling_stream_errors_total", "Failed executions of the stream", metricsLabels, nil),
+	duration:     prometheus.NewDesc("sling_stream_duration_seconds", "Duration of the last execution, or elapsed time if running", metricsLabels, nil),
+	lastSuccess:  prometheus.NewDesc("sling_stream_last_success_timestamp_seconds", "Unix time of the last successful execution", metricsLabels, nil),
+}
+
+// streamMetrics is the state of a stream, across executions
+type streamMetrics struct {
+	task        *TaskExecution
+	errors      int
+	lastSuccess time.Time
+}
+
+// taskCollector collects the metrics of the tasks, when scraped or pushed
+type taskCollector struct {
+	streams map[string]*streamMetrics
+	mux     sync.Mutex
+}
+
+var metricsCollector = &taskCollector{streams: map[string]*streamMetrics{}}
+
+func init() {
+	metricsRegistry.MustRegister(metricsCollector)
+}
+
+func (tc *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(tc, ch)
+}
+
+func (tc *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	tc.mux.Lock()
+	defer tc.mux.Unlock()
+
+	for _, sm := range tc.streams {
+		t := sm.task
+		labels := t.metricsLabelValues()
+		gauge := func(desc *prometheus.Desc, value float64, extraLabels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append(labels, extraLabels...)...)
+		}
+
+		// the task is running, its state is read with its lock
+		t.stateMux.Lock()
+		df, stage, status := t.df, t.stage, t.Status
+		rowsWritten, attempts := t.rowsWritten, t.Attempts
+		startTime, endTime := t.StartTime, t.EndTime
+		t.stateMux.Unlock()
+
+		var rowsRead, bytesRead, bytesWritten uint64
+		if df != nil && startTime != nil {
+			rowsRead = df.Count()
+			bytesRead, bytesWritten = df.Bytes()
+		}
+		gauge(metricsDescs.rowsRead, float64(rowsRead))
+		gauge(metricsDescs.rowsWritten, float64(rowsWritten))
+		gauge(metricsDescs.bytesRead, float64(bytesRead))
+		gauge(metricsDescs.bytesWritten, float64(bytesWritten))
+		gauge(metricsDescs.attempts, float64(attempts))
+
+		running := status == ExecStatusRunning
+		gauge(metricsDescs.running, cast.ToFloat64(running))
+		if running && stage != "" {
+			gauge(metricsDescs.stage, 1, stage)
+		}
+
+		if startTime != nil {
+			if endTime == nil {
+				now := time.Now()
+				endTime = &now
+			}
+			duration := endTime.Sub(*startTime).Seconds()
+			gauge(metricsDescs.duration, duration)
+			if duration > 0 {
+				gauge(metricsDescs.rowRate, math.Round(float64(rowsRead)/duration))
+			}
+		}
+
+		if !sm.lastSuccess.IsZero() {
+			gauge(metricsDescs.lastSuccess, float64(sm.lastSuccess.Unix()))
+		}
+
+		ch <- prometheus.MustNewConstMetric(metricsDescs.errors, prometheus.CounterValue, float64(sm.errors), labels...)
+	}
+}
+
+func (t *TaskExecution) metricsLabelValues() []string {
+	return []string{t.streamName(), t.Config.SrcConn.Info().Name, t.Config.TgtConn.Info().Name}
+}
+
+// setState changes the state of the task read by the metrics collector
+func (t *TaskExecution) setState(f func()) {
+	t.stateMux.Lock()
+	defer t.stateMux.Unlock()
+	f()
+}
+
+// metricsStart tracks the task as the current execution of its stream
+func (t *TaskExecution) metricsStart() {
+	key := g.Marshal(t.metricsLabelValues())
+
+	metricsCollector.mux.Lock()
+	defer metricsCollector.mux.Unlock()
+
+	sm, ok := metricsCollector.streams[key]
+	if !ok {
+		sm = &streamMetrics{}
+		metricsCollector.streams[key] = sm
+	}
+	sm.task = t
+}
+
+// metricsEnd records the result of the task execution
+func (t *TaskExecution) metricsEnd() {
+	key := g.Marshal(t.metricsLabelValues())
+
+	metricsCollector.mux.Lock()
+	defer metricsCollector.mux.Unlock()
+
+	sm, ok := metricsCollector.streams[key]
+	if !ok {
+		return
+	}
+
+	if t.Status == ExecStatusSuccess && t.EndTime != nil {
+		sm.lastSuccess = *t.EndTime
+	} else if t.Status.IsFailure() {
+		sm.errors++
+	}
+}
+
+// MetricsHandler returns the http handler exposing the metrics of the
+// tasks executed in this process, in the Prometheus / OpenMetrics format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// PushMetrics pushes the metrics of the tasks executed in this process to
+// a Prometheus Pushgateway compatible URL, grouped by instance (hostname)
+func PushMetrics(url string) (err error) {
+	hostname, _ := os.Hostname()
+	err = push.New(url, "sling").
+		Gatherer(metricsRegistry).
+		Grouping("instance", hostname).
+		Push()
+	if err != nil {
+		return g.Error(err, "could not push metrics to %s", url)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package sling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskMetrics(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	end := time.Now()
+	task := &TaskExecution{
+		Config:      &Config{StreamName: "public.metrics_test"},
+		Status:      ExecStatusError,
+		StartTime:   &start,
+		EndTime:     &end,
+		Attempts:    2,
+		df:          iop.NewDataflow(),
+		rowsWritten: 100,
+	}
+
+	task.metricsStart()
+	task.metricsEnd()
+	task.Status = ExecStatusSuccess
+	task.metricsEnd()
+
+	families, err := metricsRegistry.Gather()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "stream" && label.GetValue() == "public.metrics_test" {
+					values[family.GetName()] = metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, float64(100), values["sling_stream_rows_written"])
+	assert.Equal(t, float64(2), values["sling_stream_attempts"])
+	assert.Equal(t, float64(1), values["sling_stream_errors_total"])
+	assert.Equal(t, float64(0), values["sling_stream_running"])
+	assert.Equal(t, float64(end.Unix()), values["sling_stream_last_success_timestamp_seconds"])
+	assert.InDelta(t, 60, values["sling_stream_duration_seconds"], 1)
+
+	// scraped while the task runs (see go test -race)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			task.setState(func() { task.stage, task.rowsWritten = g.F("stage %d", i), uint64(i) })
+			task.setState(func() { task.Status = ExecStatusRunning })
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err = metricsRegistry.Gather()
+		assert.NoError(t, err)
+	}
+	<-done
+}
@@ -0,0 +1,353 @@
+package sling
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// TaskPlan describes what a task would do, without moving any rows
+type TaskPlan struct {
+	Stream           string   `json:"stream"`
+	Type             JobType  `json:"type"`
+	Mode             Mode     `json:"mode,omitempty"`
+	Source           string   `json:"source,omitempty"`
+	Target           string   `json:"target,omitempty"`
+	SourceQuery      string   `json:"source_query,omitempty"`
+	IncrementalValue string   `json:"incremental_value,omitempty"`
+	TargetObject     string   `json:"target_object,omitempty"`
+	TargetExists     bool     `json:"target_exists"`
+	TargetDDL        string   `json:"target_ddl,omitempty"`
+	TempTable        string   `json:"temp_table,omitempty"`
+	TempDDL          string   `json:"temp_ddl,omitempty"`
+	PreSQL           string   `json:"pre_sql,omitempty"`
+	FinalSQL         string   `json:"final_sql,omitempty"`
+	PostSQL          string   `json:"post_sql,omitempty"`
+	Notes            []string `json:"notes,omitempty"`
+}
+
+// Plan resolves the connections, the source query and the statements
+// that would be executed on the target, without moving any rows.
+// Nothing is executed on the target, the temp table is not created.
+func (t *TaskExecution) Plan() (plan *TaskPlan, err error) {
+	if t.Err != nil {
+		return nil, t.Err
+	}
+
+	if t.Context == nil {
+		ctx := g.NewContext(context.Background())
+		t.Context = &ctx
+	}
+
+	t.Config.SetDefault()
+	if t.Config.Mode == Mode("") {
+		t.Config.Mode = FullRefreshMode
+	}
+
+	cfg := t.Config
+	plan = &TaskPlan{
+		Stream:       cfg.StreamName,
+		Type:         t.Type,
+		Mode:         cfg.Mode,
+		Source:       cfg.SrcConn.Info().Name,
+		Target:       cfg.TgtConn.Info().Name,
+		TargetObject: t.getTargetObjectValue(),
+	}
+
+	if t.Type == DbSQL {
+		plan.Mode = ""
+		plan.FinalSQL = cfg.Target.Object
+		return plan, nil
+	}
+
+	var tgtConn database.Connection
+	if g.In(t.Type, DbToDb, FileToDB) {
+		tgtConn, err = t.getTgtDBConn(t.Context.Ctx)
+		if err != nil {
+			return plan, g.Error(err, "Could not initialize target connection")
+		}
+
+		if err = tgtConn.Connect(); err != nil {
+			return plan, g.Error(err, "Could not connect to: %s (%s)", cfg.TgtConn.Info().Name, tgtConn.GetType())
+		}
+
+		if !t.isUsingPool() {
+			defer tgtConn.Close()
+		}
+
+		// set schema if needed
+		cfg.Target.Object = setSchema(cast.ToString(cfg.Target.Data["schema"]), cfg.Target.Object)
+		cfg.Target.Options.TableTmp = setSchema(cast.ToString(cfg.Target.Data["schema"]), cfg.Target.Options.TableTmp)
+		plan.TargetObject = cfg.Target.Object
+
+		// check if table exists by getting target columns
+		pullTargetTableColumns(cfg, tgtConn, false)
+		plan.TargetExists = len(cfg.Target.columns) > 0
+
+		if t.usingCheckpoint() && t.Type == DbToDb {
+			srcConn, err := t.getSrcDBConn(t.Context.Ctx)
+			if err != nil {
+				return plan, g.Error(err, "Could not initialize source connection")
+			}
+			cfg.IncrementalVal, err = getIncrementalValue(cfg, tgtConn, srcConn.Template().Variable)
+			if err != nil {
+				return plan, g.Error(err, "Could not get incremental value")
+			}
+			plan.IncrementalValue = cfg.IncrementalVal
+		}
+	}
+
+	var columns iop.Columns
+	if g.In(t.Type, DbToDb, DbToFile) {
+		srcConn, err := t.getSrcDBConn(t.Context.Ctx)
+		if err != nil {
+			return plan, g.Error(err, "Could not initialize source connection")
+		}
+
+		if err = srcConn.Connect(); err != nil {
+			return plan, g.Error(err, "Could not connect to: %s (%s)", cfg.SrcConn.Info().Name, srcConn.GetType())
+		}
+
+		if !t.isUsingPool() {
+			defer srcConn.Close()
+		}
+
+		sTable, err := t.getSourceTable(cfg, srcConn)
+		if err != nil {
+			return plan, g.Error(err, "Could not build source query")
+		}
+
+		plan.SourceQuery = lo.Ternary(sTable.SQL != "", sTable.SQL, sTable.Select(0))
+		columns = sTable.Columns
+	} else {
+		plan.Notes = append(plan.Notes, g.F("source files are read from %s", cfg.Source.Stream))
+	}
+
+	if tgtConn != nil {
+		err = t.planTarget(plan, tgtConn, columns)
+		if err != nil {
+			return plan, g.Error(err, "could not plan target")
+		}
+	}
+
+	return plan, nil
+}
+
+// planTarget fills the target ddl and sql statements of the plan
+func (t *TaskExecution) planTarget(plan *TaskPlan, tgtConn database.Connection, columns iop.Columns) (err error) {
+	cfg := t.Config
+
+	plan.PreSQL, err = t.planSQL(cfg.Target.Options.PreSQL)
+	if err != nil {
+		return g.Error(err, "could not get pre-sql body")
+	}
+
+	plan.PostSQL, err = t.planSQL(cfg.Target.Options.PostSQL)
+	if err != nil {
+		return g.Error(err, "could not get post-sql body")
+	}
+
+	targetTable, err := database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+	if err != nil {
+		return g.Error(err, "could not parse object table name")
+	}
+	targetTable.DDL = cfg.Target.Options.TableDDL
+	targetTable.DDL = g.R(targetTable.DDL, "object_name", targetTable.Raw, "table", targetTable.Raw)
+
+	tableTmp, err := getTempTable(cfg, tgtConn)
+	if err != nil {
+		return err
+	}
+	tableTmp.DDL = strings.Replace(targetTable.DDL, targetTable.Raw, tableTmp.FullName(), 1)
+	tableTmp.Raw = tableTmp.FullName()
+	plan.TempTable = tableTmp.FullName()
+
+	if len(columns) == 0 {
+		plan.Notes = append(plan.Notes, "column types are inferred from the source data at runtime, DDL and final sql are not available")
+		return nil
+	}
+
+	// apply column casing
+	if cc := cfg.Target.Options.ColumnCasing; cc != nil && *cc != SourceColumnCasing {
+		for i := range columns {
+			columns[i].Name = applyColumnCasing(columns[i].Name, *cc == SnakeColumnCasing, tgtConn.GetType())
+		}
+	}
+
+	data := iop.NewDataset(columns)
+	data.Inferred = true
+
+	targetTable.Columns = columns
+	targetTable.SetKeys(cfg.Source.PrimaryKey(), cfg.Source.UpdateKey, cfg.Target.Options.TableKeys)
+	plan.TargetDDL, err = tgtConn.GenerateDDL(targetTable, data, false)
+	if err != nil {
+		return g.Error(err, "could not generate DDL for "+targetTable.FullName())
+	}
+
+	tableTmp.Columns = columns
+	tableTmp.SetKeys(cfg.Source.PrimaryKey(), cfg.Source.UpdateKey, cfg.Target.Options.TableKeys)
+	plan.TempDDL, err = tgtConn.GenerateDDL(tableTmp, data, false)
+	if err != nil {
+		return g.Error(err, "could not generate DDL for "+tableTmp.FullName())
+	}
+
+	if !plan.TargetExists || cfg.Mode == FullRefreshMode {
+		plan.Notes = append(plan.Notes, g.F("target table %s will be created", targetTable.FullName()))
+	}
+
+	// the final sql is generated with the plan connection, since the
+	// temp table is not created (see planConn)
+	pConn := &planConn{Connection: tgtConn, tmpTable: tableTmp, tmpColumns: columns}
+	tgtConn.Base().SetInstance(pConn)
+	defer tgtConn.Base().SetInstance(tgtConn)
+	tgtConn = pConn
+
+	upsert := (cfg.Mode == IncrementalMode && len(cfg.Source.PrimaryKey()) > 0) || cfg.Mode == BackfillMode
+	switch {
+	case !plan.TargetExists || cfg.Mode == FullRefreshMode:
+		// target is created from the same columns as the temp table
+		fields := lo.Map(columns.Names(), func(name string, i int) string {
+			return tgtConn.Quote(name, false)
+		})
+		plan.FinalSQL = g.R(
+			tgtConn.Template().Core["insert_from_table"],
+			"tgt_table", targetTable.FullName(),
+			"src_table", tableTmp.FullName(),
+			"tgt_fields", strings.Join(fields, ", "),
+			"src_fields", strings.Join(fields, ", "),
+		)
+		if upsert {
+			plan.Notes = append(plan.Notes, "target table is new, so the upsert inserts all rows")
+		}
+	case upsert:
+		plan.FinalSQL, err = tgtConn.GenerateUpsertSQL(tableTmp.FullName(), targetTable.FullName(), cfg.Source.PrimaryKey())
+	case cfg.Mode == TruncateMode:
+		plan.FinalSQL, err = insertFromTempSQL(cfg, tgtConn)
+		truncSQL := g.R(tgtConn.GetTemplateValue("core.truncate_table"), "table", targetTable.FullName())
+		plan.FinalSQL = truncSQL + ";\n" + plan.FinalSQL
+	default:
+		plan.FinalSQL, err = insertFromTempSQL(cfg, tgtConn)
+	}
+	if err != nil {
+		return g.Error(err, "could not generate final sql")
+	}
+
+	// statements executed when generating, such as a unique index
+	if len(pConn.statements) > 0 {
+		plan.FinalSQL = strings.Join(append(pConn.statements, strings.TrimSpace(plan.FinalSQL)), ";\n")
+	}
+
+	return nil
+}
+
+// planConn is the target connection of a plan. The columns of the temp
+// table (which is not created) are the planned columns, and the statements
+// executed when generating the final sql are recorded instead of executed.
+type planConn struct {
+	database.Connection
+	tmpTable   database.Table
+	tmpColumns iop.Columns
+	statements []string
+}
+
+// GetColumns returns the planned columns for the temp table
+func (conn *planConn) GetColumns(tableFName string, fields ...string) (columns iop.Columns, err error) {
+	table, err := database.ParseTableName(tableFName, conn.GetType())
+	if err != nil {
+		return columns, g.Error(err, "could not parse table name: "+tableFName)
+	}
+	return conn.GetTableColumns(&table, fields...)
+}
+
+// GetTableColumns returns the planned columns for the temp table
+func (conn *planConn) GetTableColumns(table *database.Table, fields ...string) (columns iop.Columns, err error) {
+	if table.FullName() != conn.tmpTable.FullName() {
+		return conn.Connection.GetTableColumns(table, fields...)
+	} else if len(fields) == 0 {
+		return conn.tmpColumns, nil
+	}
+
+	for _, field := range fields {
+		col := conn.tmpColumns.GetColumn(field)
+		if col.Name == "" {
+			return columns, g.Error("provided field '%s' not found in table %s", strings.ToLower(field), table.FullName())
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// ExecContext records the statement
+func (conn *planConn) ExecContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	conn.statements = append(conn.statements, strings.TrimSpace(q))
+	return driver.RowsAffected(0), nil
+}
+
+// ExecMultiContext records the statements
+func (conn *planConn) ExecMultiContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	return conn.ExecContext(ctx, q, args...)
+}
+
+// planSQL returns the rendered text of a pre/post sql
+func (t *TaskExecution) planSQL(text string) (sql string, err error) {
+	if text == "" {
+		return "", nil
+	}
+
+	sql, err = GetSQLText(text)
+	if err != nil {
+		return "", err
+	}
+
+	fMap, err := t.Config.GetFormatMap()
+	if err != nil {
+		return "", g.Error(err, "could not get format map")
+	}
+
+	return g.Rm(sql, fMap), nil
+}
+
+// Pretty returns the plan as readable text
+func (p *TaskPlan) Pretty() string {
+	lines := []string{env.CyanString(g.F("Plan for %s [%s]", p.Stream, p.Type))}
+
+	add := func(label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			lines = append(lines, g.F("  %s: %s", env.DarkGrayString(label), value))
+		}
+	}
+	addSQL := func(label, sql string) {
+		if sql = strings.TrimSpace(sql); sql != "" {
+			lines = append(lines, g.F("  %s:", env.DarkGrayString(label)))
+			for _, line := range strings.Split(sql, "\n") {
+				lines = append(lines, "    "+line)
+			}
+		}
+	}
+
+	add("mode", string(p.Mode))
+	add("source", p.Source)
+	add("target", p.Target)
+	add("target object", p.TargetObject)
+	addSQL("source query", p.SourceQuery)
+	add("incremental value", p.IncrementalValue)
+	add("temp table", p.TempTable)
+	addSQL("temp table ddl", p.TempDDL)
+	addSQL("target table ddl", p.TargetDDL)
+	addSQL("pre sql", p.PreSQL)
+	addSQL("final sql", p.FinalSQL)
+	addSQL("post sql", p.PostSQL)
+	for _, note := range p.Notes {
+		add("note", note)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,64 @@
+package sling
+
+import (
+	"path"
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskPlan(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "plan.db")
+	conn, err := database.NewConn("sqlite://" + dbPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, conn.Connect())
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(`create table src (id integer primary key, name text); create table tgt (id integer, name text)`)
+	assert.NoError(t, err)
+
+	cfg := &Config{
+		Source: Source{Conn: "sqlite://" + dbPath, Stream: "main.src", PrimaryKeyI: []string{"id"}},
+		Target: Target{Conn: "sqlite://" + dbPath, Object: "main.tgt"},
+		Mode:   TruncateMode,
+	}
+	assert.NoError(t, cfg.Prepare())
+
+	task := NewTask("", cfg)
+	plan, err := task.Plan()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, DbToDb, plan.Type)
+	assert.True(t, plan.TargetExists)
+	assert.Equal(t, `select * from "main"."src"`, plan.SourceQuery)
+	assert.Equal(t, `"main"."tgt_tmp"`, plan.TempTable)
+	assert.Contains(t, plan.TargetDDL, `"main"."tgt"`)
+	assert.Contains(t, plan.FinalSQL, `delete from "main"."tgt"`)
+	assert.Contains(t, plan.FinalSQL, `from "main"."tgt_tmp"`)
+	assert.Contains(t, plan.Pretty(), "final sql")
+
+	// upsert into the existing target
+	cfg.Mode = IncrementalMode
+	task = NewTask("", cfg)
+	plan, err = task.Plan()
+	if assert.NoError(t, err) {
+		assert.Contains(t, plan.FinalSQL, "create unique index if not exists")
+		assert.Contains(t, plan.FinalSQL, `FROM "main"."tgt_tmp" as src`)
+		assert.Contains(t, plan.FinalSQL, "ON CONFLICT")
+	}
+
+	// nothing is executed on the target: no temp table, no index
+	exists, err := database.TableExists(conn, `"main"."tgt_tmp"`)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	data, err := conn.Query(`select name from sqlite_master where type = 'index' and tbl_name = 'tgt'`)
+	if assert.NoError(t, err) {
+		assert.Empty(t, data.Rows)
+	}
+}
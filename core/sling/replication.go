@@ -5,6 +5,7 @@ import (
 	"database/sql/driver"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/flarco/g"
@@ -273,9 +274,62 @@ func (rd *ReplicationConfig) ProcessWildcardsFile(c connection.ConnEntry, wildca
 	return
 }
 
-// TODO: Compile
+// Compile returns the task configs of the enabled streams, in order.
+// The streams can be selected with patterns (such as `my_schema.*`), and the
+// mode, update key and primary key overwritten with cfgOverwrite.
 func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...string) (tasks []Config, err error) {
-	return
+	err = rd.ProcessWildcards()
+	if err != nil {
+		return nil, g.Error(err, "could not process streams using wildcard")
+	}
+
+	matchedStreams := map[string]bool{}
+	for _, selectStream := range selectStreams {
+		for key := range rd.MatchStreams(selectStream) {
+			matchedStreams[rd.Normalize(key)] = true
+		}
+	}
+
+	// when not parsed from YAML, there is no order
+	streamsOrdered := rd.StreamsOrdered()
+	if len(streamsOrdered) == 0 {
+		streamsOrdered = lo.Keys(rd.Streams)
+		sort.Strings(streamsOrdered)
+	}
+
+	for _, name := range streamsOrdered {
+		if len(selectStreams) > 0 && !matchedStreams[rd.Normalize(name)] {
+			continue
+		}
+
+		stream := rd.Streams[name]
+		if stream == nil {
+			stream = &ReplicationStreamConfig{}
+		}
+		SetStreamDefaults(stream, *rd)
+
+		if stream.Disabled {
+			continue
+		} else if stream.Object == "" {
+			return nil, g.Error("need to specify `object` for stream %s", name)
+		}
+
+		if cfgOverwrite != nil {
+			if string(cfgOverwrite.Mode) != "" {
+				stream.Mode = cfgOverwrite.Mode
+			}
+			if string(cfgOverwrite.Source.UpdateKey) != "" {
+				stream.UpdateKey = cfgOverwrite.Source.UpdateKey
+			}
+			if cfgOverwrite.Source.PrimaryKeyI != nil {
+				stream.PrimaryKeyI = cfgOverwrite.Source.PrimaryKeyI
+			}
+		}
+
+		tasks = append(tasks, rd.StreamConfig(name, stream))
+	}
+
+	return tasks, nil
 }
 
 type ReplicationStreamConfig struct {
@@ -290,6 +344,8 @@ type ReplicationStreamConfig struct {
 	TargetOptions *TargetOptions `json:"target_options,omitempty" yaml:"target_options,omitempty"`
 	Disabled      bool           `json:"disabled,omitempty" yaml:"disabled,omitempty"`
 
+	RetryPolicy `yaml:",inline"`
+
 	State *StreamIncrementalState `json:"state,omitempty" yaml:"state,omitempty"`
 }
 
@@ -336,6 +392,41 @@ func SetStreamDefaults(stream *ReplicationStreamConfig, replicationCfg Replicati
 	} else if replicationCfg.Defaults.TargetOptions != nil {
 		stream.TargetOptions.SetDefaults(*replicationCfg.Defaults.TargetOptions)
 	}
+
+	stream.RetryPolicy.SetDefaults(replicationCfg.Defaults.RetryPolicy)
+}
+
+// StreamConfig returns the task config of a stream.
+// The stream defaults should already be set (see SetStreamDefaults)
+func (rd ReplicationConfig) StreamConfig(name string, stream *ReplicationStreamConfig) (cfg Config) {
+	cfg = Config{
+		Source: Source{
+			Conn:        rd.Source,
+			Stream:      name,
+			Select:      stream.Select,
+			PrimaryKeyI: stream.PrimaryKey(),
+			UpdateKey:   stream.UpdateKey,
+		},
+		Target: Target{
+			Conn:   rd.Target,
+			Object: stream.Object,
+		},
+		Mode:            stream.Mode,
+		RetryPolicy:     stream.RetryPolicy,
+		ReplicationMode: true,
+		Env:             g.ToMapString(rd.Env),
+		StreamName:      name,
+	}
+
+	// so that the next stream does not retain previous pointer values
+	g.Unmarshal(g.Marshal(stream.SourceOptions), &cfg.Source.Options)
+	g.Unmarshal(g.Marshal(stream.TargetOptions), &cfg.Target.Options)
+
+	if stream.SQL != "" {
+		cfg.Source.Stream = stream.SQL
+	}
+
+	return
 }
 
 // UnmarshalReplication converts a yaml file to a replication
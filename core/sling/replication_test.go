@@ -1,10 +1,16 @@
 package sling
 
 import (
+	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,3 +39,114 @@ streams:
 
 	g.PP(replication)
 }
+
+func TestValidateReplication(t *testing.T) {
+	yaml := `
+source: sqlite:///tmp/validate.db
+target: sqlite:///tmp/validate.db
+defaults:
+	object: main.{stream_table}
+	target_options:
+		colum_casing: snake
+streams:
+	main.orders:
+		mode: incremental
+		primary_keys: [id]
+	main.customers:
+		mode: backfill
+		primary_key: [id]
+		update_key: updated_at
+		source_options:
+			range: 2021-01-01,2021-02-01
+			transforms: [trim_space, bogus]
+	`
+	yaml = strings.ReplaceAll(yaml, "\t", "  ")
+	issues, err := ValidateReplication(yaml)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	messages := lo.Map(issues, func(vi ValidationIssue, i int) string { return vi.String() })
+	assert.Len(t, messages, 4, g.Marshal(messages))
+	assert.Contains(t, messages, "defaults.target_options.colum_casing: unknown key")
+	assert.Contains(t, messages, "stream main.orders -> primary_keys: unknown key")
+	assert.Contains(t, messages, `stream main.customers -> source_options.transforms: invalid transform "bogus" for column *`)
+	assert.True(t, lo.ContainsBy(messages, func(m string) bool {
+		return strings.HasPrefix(m, "stream main.orders: must specify value for 'update_key' and/or 'primary_key'")
+	}))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	yaml := `
+source: postgres://localhost/db
+target: file://
+defaults:
+	object: /tmp/{stream_table}.csv
+	retries: 3
+	retry_delay: 5
+streams:
+	public.orders:
+	public.customers:
+		retries: 0
+		retry_backoff: constant
+	`
+	yaml = strings.ReplaceAll(yaml, "\t", "  ")
+	replication, err := UnmarshalReplication(yaml)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, expected := range map[string]int{"public.orders": 3, "public.customers": 0} {
+		stream := &ReplicationStreamConfig{}
+		if replication.Streams[name] != nil {
+			g.Unmarshal(g.Marshal(replication.Streams[name]), stream)
+		}
+		SetStreamDefaults(stream, replication)
+		cfg := replication.StreamConfig(name, stream)
+		assert.Equal(t, expected, cfg.MaxRetries(), name)
+		assert.Equal(t, 5, *cfg.RetryDelay, name)
+	}
+
+	policy := RetryPolicy{RetryDelay: g.Int(5)}
+	assert.Equal(t, 5*time.Second, policy.Delay(1))
+	assert.Equal(t, 20*time.Second, policy.Delay(3))
+	assert.Equal(t, maxRetryDelay, policy.Delay(20))
+
+	backoff := RetryBackoffConstant
+	policy.RetryBackoff = &backoff
+	assert.Equal(t, 5*time.Second, policy.Delay(3))
+
+	backoff = RetryBackoff("linear")
+	assert.Error(t, policy.Validate())
+
+	// the connection policy applies to the values unset for the stream
+	conn, _ := connection.NewConnection("PG", dbio.TypeDbPostgres, g.M("retries", 3, "RETRY_DELAY", "30", "retry_backoff", "constant"))
+	policy = RetryPolicy{Retries: g.Int(1)}
+	policy.SetDefaults(connRetryPolicy(conn))
+	assert.Equal(t, 1, policy.MaxRetries())
+	assert.Equal(t, 30*time.Second, policy.Delay(3))
+	assert.Empty(t, connRetryPolicy(connection.Connection{}))
+
+	deadlock := g.Error("ERROR: deadlock detected (SQLSTATE 40P01)")
+	assert.True(t, dbio.TypeDbPostgres.IsRetryableError(deadlock))
+	assert.False(t, dbio.TypeDbPostgres.IsRetryableError(g.Error(`relation "orders" does not exist`)))
+	assert.False(t, dbio.TypeDbMySQL.IsRetryableError(g.Error("ORA-00060: deadlock detected while waiting for resource")))
+	assert.True(t, dbio.TypeDbOracle.IsRetryableError(g.Error("ORA-00060: deadlock detected while waiting for resource")))
+}
+
+func TestReplicationJSONSchema(t *testing.T) {
+	schema := ReplicationJSONSchema()
+	definitions := schema["definitions"].(map[string]any)
+	if assert.Contains(t, definitions, "ReplicationStreamConfig") {
+		properties := definitions["ReplicationStreamConfig"].(map[string]any)["properties"].(map[string]any)
+		assert.Contains(t, properties, "primary_key")
+		assert.Contains(t, properties, "target_options")
+		assert.Equal(t, schemaEnums[reflect.TypeOf(Mode(""))], properties["mode"].(map[string]any)["enum"])
+	}
+
+	// published schema should be up to date
+	published, err := os.ReadFile("../../schema/replication.schema.json")
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, g.Marshal(schema), string(published), "regenerate with `sling validate --json-schema`")
+	}
+}
@@ -0,0 +1,251 @@
+package sling
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// ValidationIssue is a problem found when validating a replication
+type ValidationIssue struct {
+	Stream  string `json:"stream,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+func (vi ValidationIssue) String() string {
+	parts := []string{}
+	if vi.Stream != "" {
+		parts = append(parts, g.F("stream %s", vi.Stream))
+	}
+	if vi.Key != "" {
+		parts = append(parts, vi.Key)
+	}
+	if len(parts) == 0 {
+		return vi.Message
+	}
+	return g.F("%s: %s", strings.Join(parts, " -> "), vi.Message)
+}
+
+// schemaEnums are the allowed values of the config string types
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(Mode("")):             {string(FullRefreshMode), string(IncrementalMode), string(TruncateMode), string(SnapshotMode), string(BackfillMode)},
+	reflect.TypeOf(ColumnCasing("")):     {string(SourceColumnCasing), string(TargetColumnCasing), string(SnakeColumnCasing)},
+	reflect.TypeOf(iop.RowErrorMode("")): {string(iop.RowErrorModeFail), string(iop.RowErrorModeSkip), string(iop.RowErrorModeDeadLetter)},
+	reflect.TypeOf(DriftPolicy("")):      {string(DriftPolicyAllow), string(DriftPolicyWarn), string(DriftPolicyFail), string(DriftPolicyQuarantine)},
+	reflect.TypeOf(RetryBackoff("")):     {string(RetryBackoffExponential), string(RetryBackoffConstant)},
+}
+
+// ValidateReplication checks a replication config without running it:
+// unknown keys, mode / key compatibility, connections existence and
+// transform names. Wildcard streams are not expanded.
+func ValidateReplication(replicYAML string) (issues []ValidationIssue, err error) {
+	// strict key checking
+	root := map[string]any{}
+	if err = yaml3.Unmarshal([]byte(replicYAML), &root); err != nil {
+		return nil, g.Error(err, "Error parsing yaml content")
+	}
+	issues = checkConfigKeys(nil, root, reflect.TypeOf(ReplicationConfig{}))
+
+	config, err := UnmarshalReplication(replicYAML)
+	if err != nil {
+		return issues, g.Error(err, "Error parsing replication config")
+	}
+
+	// check that connections exist
+	connsMap := lo.KeyBy(connection.GetLocalConns(), func(c connection.ConnEntry) string {
+		return strings.ToLower(c.Connection.Name)
+	})
+	connsFound := true
+	for _, kv := range [][2]string{{"source", config.Source}, {"target", config.Target}} {
+		_, found := connsMap[strings.ToLower(kv[1])]
+		if !found && connection.SchemeType(kv[1]).IsUnknown() {
+			issues = append(issues, ValidationIssue{Key: kv[0], Message: g.F("connection %#v not found", kv[1])})
+			connsFound = false
+		}
+	}
+
+	for _, name := range config.StreamsOrdered() {
+		stream := &ReplicationStreamConfig{}
+		if config.Streams[name] != nil {
+			g.Unmarshal(g.Marshal(config.Streams[name]), stream)
+		}
+		SetStreamDefaults(stream, config)
+
+		if stream.Disabled {
+			continue
+		} else if stream.Object == "" {
+			issues = append(issues, ValidationIssue{Stream: name, Key: "object", Message: "need to specify `object`"})
+			continue
+		}
+
+		// check mode & keys, with the connections if available
+		cfg := config.StreamConfig(name, stream)
+		if connsFound {
+			if err = cfg.Prepare(); err == nil {
+				_, err = cfg.DetermineType()
+			}
+		} else if err = cfg.setMode(); err == nil {
+			err = cfg.RetryPolicy.Validate()
+		}
+		if err != nil {
+			issues = append(issues, ValidationIssue{Stream: name, Message: g.ErrMsgSimple(err)})
+		}
+
+		// check transforms
+		if stream.SourceOptions != nil && stream.SourceOptions.Transforms != nil {
+			colTransforms := castTransforms(stream.SourceOptions.Transforms)
+			for _, col := range lo.Keys(colTransforms) {
+				for _, transform := range colTransforms[col] {
+					if !iop.Transform(transform).IsValid() {
+						issues = append(issues, ValidationIssue{
+							Stream:  name,
+							Key:     "source_options.transforms",
+							Message: g.F("invalid transform %#v for column %s", transform, col),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// checkConfigKeys returns an issue for each key of the value which does not
+// match a field of the config type
+func checkConfigKeys(path []string, value any, t reflect.Type) (issues []ValidationIssue) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := configFields(t)
+		keys := lo.Keys(m)
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := append(append([]string{}, path...), key)
+			if field, ok := fields[key]; ok {
+				issues = append(issues, checkConfigKeys(keyPath, m[key], field.Type)...)
+				continue
+			}
+
+			issue := ValidationIssue{Key: strings.Join(keyPath, "."), Message: "unknown key"}
+			if len(keyPath) > 2 && keyPath[0] == "streams" {
+				issue.Stream = keyPath[1]
+				issue.Key = strings.Join(keyPath[2:], ".")
+			}
+			issues = append(issues, issue)
+		}
+	case reflect.Map:
+		if m, ok := value.(map[string]any); ok {
+			for key, val := range m {
+				keyPath := append(append([]string{}, path...), key)
+				issues = append(issues, checkConfigKeys(keyPath, val, t.Elem())...)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := value.([]any); ok {
+			for _, val := range arr {
+				issues = append(issues, checkConfigKeys(path, val, t.Elem())...)
+			}
+		}
+	}
+
+	return
+}
+
+// configFields returns the exported fields of a config struct, by json key.
+// The fields of embedded structs are included, as with json.
+func configFields(t reflect.Type) (fields map[string]reflect.StructField) {
+	fields = map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && key == "" && field.Type.Kind() == reflect.Struct {
+			for k, f := range configFields(field.Type) {
+				fields[k] = f
+			}
+			continue
+		}
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		fields[key] = field
+	}
+	return
+}
+
+// ReplicationJSONSchema returns the JSON Schema of the replication config,
+// generated from the config structs, so editors can autocomplete the YAML
+func ReplicationJSONSchema() map[string]any {
+	definitions := map[string]any{}
+	schema := jsonSchemaOf(reflect.TypeOf(ReplicationConfig{}), definitions)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Sling Replication"
+	schema["definitions"] = definitions
+	return schema
+}
+
+func jsonSchemaOf(t reflect.Type, definitions map[string]any) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if values, ok := schemaEnums[t]; ok {
+		return g.M("type", "string", "enum", values)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return g.M("type", "string", "format", "date-time")
+		}
+
+		name := t.Name()
+		if _, ok := definitions[name]; !ok {
+			definitions[name] = nil // placeholder, in case of recursion
+			properties := map[string]any{}
+			for key, field := range configFields(t) {
+				properties[key] = jsonSchemaOf(field.Type, definitions)
+			}
+			definitions[name] = g.M(
+				"type", "object",
+				"properties", properties,
+				"additionalProperties", false,
+			)
+		}
+		return g.M("$ref", "#/definitions/"+name)
+	case reflect.Map:
+		values := jsonSchemaOf(t.Elem(), definitions)
+		if t.Elem().Kind() == reflect.Ptr {
+			values = g.M("anyOf", []any{values, g.M("type", "null")}) // such as `my_schema.*:`
+		}
+		return g.M("type", "object", "additionalProperties", values)
+	case reflect.Slice, reflect.Array:
+		return g.M("type", "array", "items", jsonSchemaOf(t.Elem(), definitions))
+	case reflect.String:
+		return g.M("type", "string")
+	case reflect.Bool:
+		return g.M("type", "boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return g.M("type", "integer")
+	case reflect.Float32, reflect.Float64:
+		return g.M("type", "number")
+	}
+
+	return g.M() // any value
+}
@@ -0,0 +1,203 @@
+package sling
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+)
+
+// ReportStatus is the status of a run, in the run report
+type ReportStatus string
+
+const (
+	ReportStatusSuccess     ReportStatus = "success"     // all streams succeeded
+	ReportStatusPartial     ReportStatus = "partial"     // some streams failed
+	ReportStatusError       ReportStatus = "error"       // all streams failed, or the run failed
+	ReportStatusInterrupted ReportStatus = "interrupted" // the run was interrupted
+)
+
+// RunReport is the machine-readable report of a run (task or
+// replication), with an entry per stream. The exit code is the one of the
+// CLI: 0 if the run succeeded, 1 if any stream failed.
+type RunReport struct {
+	ExecID      string         `json:"exec_id"`
+	Replication string         `json:"replication,omitempty"`
+	Source      string         `json:"source,omitempty"`
+	Target      string         `json:"target,omitempty"`
+	Status      ReportStatus   `json:"status"`
+	ExitCode    int            `json:"exit_code"`
+	Error       string         `json:"error,omitempty"`
+	StartTime   time.Time      `json:"start_time"`
+	EndTime     time.Time      `json:"end_time"`
+	Duration    float64        `json:"duration"` // in seconds
+	Totals      ReportTotals   `json:"totals"`
+	Streams     []StreamReport `json:"streams"`
+
+	mux sync.Mutex
+}
+
+// ReportTotals are the replication-level totals of the run report
+type ReportTotals struct {
+	Streams   int    `json:"streams"`
+	Successes int    `json:"successes"`
+	Failures  int    `json:"failures"`
+	Rows      uint64 `json:"rows"`
+	Bytes     uint64 `json:"bytes"`
+}
+
+// StreamReport is the report entry of a stream
+type StreamReport struct {
+	Stream        string             `json:"stream"`
+	Mode          Mode               `json:"mode"`
+	Source        ReportEndpoint     `json:"source"`
+	Target        ReportEndpoint     `json:"target"`
+	Status        ExecStatus         `json:"status"`
+	Rows          uint64             `json:"rows"`
+	Bytes         uint64             `json:"bytes"`
+	StartTime     *time.Time         `json:"start_time,omitempty"`
+	EndTime       *time.Time         `json:"end_time,omitempty"`
+	Duration      float64            `json:"duration"` // in seconds
+	Incremental   *ReportIncremental `json:"incremental,omitempty"`
+	SchemaChanges []SchemaChange     `json:"schema_changes,omitempty"`
+	Warnings      []string           `json:"warnings,omitempty"`
+	Error         string             `json:"error,omitempty"`
+}
+
+// ReportEndpoint is the source or target of a stream
+type ReportEndpoint struct {
+	Conn string    `json:"conn"`
+	Type dbio.Type `json:"type"`
+	Name string    `json:"name"` // the stream or object
+}
+
+// ReportIncremental is the incremental value of a stream, before and
+// after the run
+type ReportIncremental struct {
+	UpdateKey string `json:"update_key"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+}
+
+// NewRunReport creates a run report, starting now
+func NewRunReport(execID string) *RunReport {
+	return &RunReport{ExecID: execID, StartTime: time.Now(), Streams: []StreamReport{}}
+}
+
+// AddStream adds the entry of a stream. The task is nil if it could not
+// be created.
+func (r *RunReport) AddStream(cfg *Config, task *TaskExecution, err error) {
+	sr := StreamReport{
+		Stream: cfg.StreamName,
+		Mode:   cfg.Mode,
+		Source: ReportEndpoint{Conn: cfg.Source.Conn, Type: cfg.SrcConn.Type, Name: cfg.Source.Stream},
+		Target: ReportEndpoint{Conn: cfg.Target.Conn, Type: cfg.TgtConn.Type, Name: cfg.Target.Object},
+		Status: ExecStatusError,
+	}
+
+	if task != nil {
+		sr.Status = task.Status
+		sr.Rows = task.GetCount()
+		sr.Bytes, _ = task.GetBytes()
+		sr.StartTime = task.StartTime
+		sr.EndTime = task.EndTime
+		if task.StartTime != nil && task.EndTime != nil {
+			sr.Duration = task.EndTime.Sub(*task.StartTime).Seconds()
+		}
+		sr.SchemaChanges = task.SchemaChanges()
+		sr.Warnings = task.Warnings()
+
+		if task.usingCheckpoint() {
+			sr.Incremental = &ReportIncremental{
+				UpdateKey: cfg.Source.UpdateKey,
+				Before:    cfg.IncrementalVal,
+				After:     task.incrementalValAfter,
+			}
+		}
+	}
+
+	if err != nil {
+		if sr.Status != ExecStatusInterrupted {
+			sr.Status = ExecStatusError
+		}
+		sr.Error = g.ErrMsgSimple(err)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.Streams = append(r.Streams, sr)
+}
+
+// Finish sets the totals, status and exit code with the error of the run
+func (r *RunReport) Finish(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.EndTime = time.Now()
+	r.Duration = r.EndTime.Sub(r.StartTime).Seconds()
+
+	r.Totals = ReportTotals{Streams: len(r.Streams)}
+	interrupted := false
+	for _, sr := range r.Streams {
+		switch sr.Status {
+		case ExecStatusSuccess, ExecStatusSkipped:
+			r.Totals.Successes++
+		case ExecStatusInterrupted, ExecStatusTerminated:
+			interrupted = true
+			r.Totals.Failures++
+		default:
+			r.Totals.Failures++
+		}
+		r.Totals.Rows += sr.Rows
+		r.Totals.Bytes += sr.Bytes
+	}
+
+	switch {
+	case interrupted:
+		r.Status = ReportStatusInterrupted
+	case err == nil && r.Totals.Failures == 0:
+		r.Status = ReportStatusSuccess
+	case r.Totals.Successes > 0:
+		r.Status = ReportStatusPartial
+	default:
+		r.Status = ReportStatusError
+	}
+
+	if err != nil {
+		r.ExitCode = 1
+		r.Error = g.ErrMsgSimple(err)
+	}
+}
+
+// Write writes the report as JSON to the path or file system URL
+// (such as `s3://bucket/reports/report.json`)
+func (r *RunReport) Write(url string) (err error) {
+	if !strings.Contains(url, "://") {
+		url, err = filepath.Abs(url)
+		if err != nil {
+			return g.Error(err, "could not get absolute path of %s", url)
+		}
+		url = "file://" + url
+	}
+
+	fs, err := filesys.NewFileSysClientFromURLContext(context.Background(), url)
+	if err != nil {
+		return g.Error(err, "could not initialize file system client")
+	}
+
+	r.mux.Lock()
+	payload := g.Pretty(r)
+	r.mux.Unlock()
+
+	_, err = fs.Write(url, bytes.NewBufferString(payload))
+	if err != nil {
+		return g.Error(err, "could not write report to %s", url)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sling
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReport(t *testing.T) {
+	folder := t.TempDir()
+	os.WriteFile(path.Join(folder, "accounts.csv"), []byte("id,name\n1,alice\n2,bob\n"), 0644)
+
+	report := NewRunReport("exec1")
+	client := NewClient(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	for _, name := range []string{"accounts", "missing"} {
+		cfg := &Config{
+			Source: Source{Conn: "LOCAL", Stream: "file://" + path.Join(folder, name+".csv")},
+			Target: Target{Conn: "LOCAL", Object: "file://" + path.Join(folder, name+".json")},
+		}
+		task, err := client.RunTask(context.Background(), cfg)
+		report.AddStream(cfg, task, err)
+	}
+	report.Finish(g.Error("1 stream failed"))
+
+	err := report.Write(path.Join(folder, "report.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bytes, _ := os.ReadFile(path.Join(folder, "report.json"))
+	written := RunReport{}
+	if !assert.NoError(t, g.Unmarshal(string(bytes), &written)) {
+		return
+	}
+
+	assert.Equal(t, "exec1", written.ExecID)
+	assert.Equal(t, ReportStatusPartial, written.Status)
+	assert.Equal(t, 1, written.ExitCode)
+	assert.Equal(t, ReportTotals{Streams: 2, Successes: 1, Failures: 1, Rows: 2, Bytes: written.Totals.Bytes}, written.Totals)
+	if assert.Len(t, written.Streams, 2) {
+		assert.Equal(t, ExecStatusSuccess, written.Streams[0].Status)
+		assert.EqualValues(t, 2, written.Streams[0].Rows)
+		assert.Equal(t, dbio.TypeFileLocal, written.Streams[0].Source.Type)
+		assert.Empty(t, written.Streams[0].Error)
+		assert.Equal(t, ExecStatusError, written.Streams[1].Status)
+		assert.NotEmpty(t, written.Streams[1].Error)
+	}
+}
@@ -0,0 +1,171 @@
+package sling
+
+import (
+	"math"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// RetryBackoff is how the delay between attempts grows
+type RetryBackoff string
+
+const (
+	RetryBackoffExponential RetryBackoff = "exponential"
+	RetryBackoffConstant    RetryBackoff = "constant"
+)
+
+// maxRetryDelay caps the delay between attempts
+var maxRetryDelay = 15 * time.Minute
+
+// RetryPolicy is how a failed stream is attempted again.
+// Only errors which are transient for the source or target type are retried
+// (see dbio.Type.IsRetryableError).
+type RetryPolicy struct {
+	Retries      *int          `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryDelay   *int          `json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"` // in seconds
+	RetryBackoff *RetryBackoff `json:"retry_backoff,omitempty" yaml:"retry_backoff,omitempty"`
+}
+
+// SetDefaults sets the unspecified values from the defaults
+func (rp *RetryPolicy) SetDefaults(defaults RetryPolicy) {
+	if rp.Retries == nil {
+		rp.Retries = defaults.Retries
+	}
+	if rp.RetryDelay == nil {
+		rp.RetryDelay = defaults.RetryDelay
+	}
+	if rp.RetryBackoff == nil {
+		rp.RetryBackoff = defaults.RetryBackoff
+	}
+}
+
+// Validate checks the values of the retry policy
+func (rp RetryPolicy) Validate() error {
+	if rp.Retries != nil && *rp.Retries < 0 {
+		return g.Error("invalid retries (%d), must be zero or more", *rp.Retries)
+	}
+	if rp.RetryDelay != nil && *rp.RetryDelay < 0 {
+		return g.Error("invalid retry_delay (%d), must be zero or more", *rp.RetryDelay)
+	}
+	if rp.RetryBackoff != nil && !g.In(*rp.RetryBackoff, RetryBackoffExponential, RetryBackoffConstant) {
+		return g.Error("invalid retry_backoff (%s), must be one of: %s, %s", *rp.RetryBackoff, RetryBackoffExponential, RetryBackoffConstant)
+	}
+	return nil
+}
+
+// connRetryPolicy returns the retry policy set in the properties of
+// the connection, such as `retries: 3` in env.yaml
+func connRetryPolicy(conn connection.Connection) (rp RetryPolicy) {
+	data := conn.DataS(true)
+	if val, ok := data["retries"]; ok {
+		rp.Retries = g.Int(cast.ToInt(val))
+	}
+	if val, ok := data["retry_delay"]; ok {
+		rp.RetryDelay = g.Int(cast.ToInt(val))
+	}
+	if val, ok := data["retry_backoff"]; ok {
+		backoff := RetryBackoff(val)
+		rp.RetryBackoff = &backoff
+	}
+	return rp
+}
+
+// MaxRetries returns the number of retries allowed
+func (rp RetryPolicy) MaxRetries() int {
+	if rp.Retries == nil {
+		return 0
+	}
+	return *rp.Retries
+}
+
+// Delay returns how long to wait after the failed attempt (starting at 1)
+func (rp RetryPolicy) Delay(attempt int) time.Duration {
+	delay := 10 * time.Second
+	if rp.RetryDelay != nil {
+		delay = time.Duration(*rp.RetryDelay) * time.Second
+	}
+
+	if rp.RetryBackoff == nil || *rp.RetryBackoff == RetryBackoffExponential {
+		factor := math.Pow(2, float64(attempt-1))
+		if float64(delay)*factor > float64(maxRetryDelay) {
+			return maxRetryDelay
+		}
+		delay = time.Duration(float64(delay) * factor)
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// isRetryableError returns true if the error is transient for the
+// source or target connection
+func (t *TaskExecution) isRetryableError(err error) bool {
+	for _, connType := range []dbio.Type{t.Config.SrcConn.Type, t.Config.TgtConn.Type} {
+		if connType.IsRetryableError(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry returns true if the failed attempt should be retried, per the
+// retry policy. The temp table and connections of the failed attempt
+// are cleaned up first, then it waits for the backoff delay.
+func (t *TaskExecution) retry() bool {
+	policy := t.Config.RetryPolicy
+	if t.Err == nil || t.Attempts > policy.MaxRetries() || t.Context.Ctx.Err() != nil {
+		return false
+	} else if !t.isRetryableError(t.Err) {
+		return false
+	}
+
+	delay := policy.Delay(t.Attempts)
+	t.warn("attempt %d of %d failed with a retryable error, retrying in %s:\n%s", t.Attempts, policy.MaxRetries()+1, delay, g.ErrMsgSimple(t.Err))
+	t.resetAttempt()
+	t.storeUpdate()
+
+	select {
+	case <-time.After(delay):
+	case <-t.Context.Ctx.Done():
+		return false
+	}
+
+	t.Err = nil
+	t.setState(func() { t.Attempts++ })
+	t.SetProgress("starting attempt %d", t.Attempts)
+	t.storeUpdate() // clears the stored error of the failed attempt
+	return true
+}
+
+// resetAttempt cleans up the temp table and connections, and resets
+// the state of the failed attempt
+func (t *TaskExecution) resetAttempt() {
+	t.Cleanup()
+
+	t.Context.Mux.Lock()
+	t.cleanupFuncs = []func(){}
+	t.setState(func() { t.df, t.rowsWritten = iop.NewDataflow(), 0 })
+	t.schema = schemaTracker{}
+	t.prevRowCount, t.prevByteCount = 0, 0
+	t.Context.Mux.Unlock()
+
+	t.Config.Target.columns = nil
+	t.Config.Target.TmpTableCreated = false
+
+	// pooled connections may be broken, do not reuse them
+	connPoolMux.Lock()
+	defer connPoolMux.Unlock()
+	for _, hash := range []string{t.Config.SrcConn.Hash(), t.Config.TgtConn.Hash()} {
+		if conn, ok := connPool[hash]; ok {
+			conn.Close()
+			delete(connPool, hash)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package sling
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+)
+
+// DriftPolicy is the action to take when a schema change is detected
+type DriftPolicy string
+
+const (
+	// DriftPolicyAllow applies the change (default)
+	DriftPolicyAllow DriftPolicy = "allow"
+	// DriftPolicyWarn applies the change, with a warning
+	DriftPolicyWarn DriftPolicy = "warn"
+	// DriftPolicyFail fails the stream
+	DriftPolicyFail DriftPolicy = "fail"
+	// DriftPolicyQuarantine loads the stream into a quarantine table,
+	// leaving the target table untouched
+	DriftPolicyQuarantine DriftPolicy = "quarantine"
+)
+
+// IsValid returns true if the policy is known
+func (dp DriftPolicy) IsValid() bool {
+	return g.In(dp, DriftPolicyAllow, DriftPolicyWarn, DriftPolicyFail, DriftPolicyQuarantine)
+}
+
+// SchemaChangeKind is the kind of schema change
+type SchemaChangeKind string
+
+const (
+	SchemaChangeAdded   SchemaChangeKind = "added"
+	SchemaChangeRemoved SchemaChangeKind = "removed"
+	SchemaChangeRetyped SchemaChangeKind = "retyped"
+)
+
+// SchemaContract is the declared schema of a stream,
+// with the policies to apply when the stream drifts from it.
+// If no columns are declared, the existing target table is the reference.
+// Contracts are supported for database targets only.
+type SchemaContract struct {
+	Columns        any          `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Drift          *DriftPolicy `json:"drift,omitempty" yaml:"drift,omitempty"`
+	NewColumns     *DriftPolicy `json:"new_columns,omitempty" yaml:"new_columns,omitempty"`
+	RemovedColumns *DriftPolicy `json:"removed_columns,omitempty" yaml:"removed_columns,omitempty"`
+	TypeChanges    *DriftPolicy `json:"type_changes,omitempty" yaml:"type_changes,omitempty"`
+}
+
+// Policy returns the policy to apply for a kind of change
+func (sc *SchemaContract) Policy(kind SchemaChangeKind) DriftPolicy {
+	if sc == nil {
+		return DriftPolicyAllow
+	}
+
+	var policy *DriftPolicy
+	switch kind {
+	case SchemaChangeAdded:
+		policy = sc.NewColumns
+	case SchemaChangeRemoved:
+		policy = sc.RemovedColumns
+	case SchemaChangeRetyped:
+		policy = sc.TypeChanges
+	}
+
+	if policy == nil {
+		policy = sc.Drift
+	}
+	if policy == nil || *policy == "" {
+		return DriftPolicyAllow
+	}
+	return DriftPolicy(strings.ToLower(string(*policy)))
+}
+
+// Validate checks the policy values
+func (sc *SchemaContract) Validate() error {
+	for _, policy := range []*DriftPolicy{sc.Drift, sc.NewColumns, sc.RemovedColumns, sc.TypeChanges} {
+		if policy == nil {
+			continue
+		}
+		if p := DriftPolicy(strings.ToLower(string(*policy))); !p.IsValid() {
+			return g.Error("invalid schema drift policy: %s. Expecting allow, warn, fail or quarantine", *policy)
+		}
+	}
+	return nil
+}
+
+// SchemaChange is a detected change of a stream schema
+type SchemaChange struct {
+	Stream  string           `json:"stream"`
+	Kind    SchemaChangeKind `json:"kind"`
+	Column  string           `json:"column"`
+	OldType iop.ColumnType   `json:"old_type,omitempty"`
+	NewType iop.ColumnType   `json:"new_type,omitempty"`
+	Policy  DriftPolicy      `json:"policy"`
+	Time    time.Time        `json:"time"`
+}
+
+// schemaTracker keeps track of the schema changes of a task
+type schemaTracker struct {
+	Changes     []SchemaChange
+	types       map[string]iop.ColumnType // last known type of each column
+	quarantined bool
+	mux         sync.Mutex
+}
+
+// SchemaChanges returns the schema changes detected during the run
+func (t *TaskExecution) SchemaChanges() []SchemaChange {
+	t.schema.mux.Lock()
+	defer t.schema.mux.Unlock()
+	return t.schema.Changes
+}
+
+// Quarantined returns true if the stream was quarantined due to schema drift
+func (t *TaskExecution) Quarantined() bool {
+	t.schema.mux.Lock()
+	defer t.schema.mux.Unlock()
+	return t.schema.quarantined
+}
+
+// addSchemaChange records a schema change, and applies the drift policy
+func (t *TaskExecution) addSchemaChange(change SchemaChange) (err error) {
+	t.schema.mux.Lock()
+	defer t.schema.mux.Unlock()
+
+	change.Stream = t.Config.StreamName
+	change.Policy = t.Config.Target.Options.SchemaContract.Policy(change.Kind)
+	change.Time = time.Now()
+	t.schema.Changes = append(t.schema.Changes, change)
+
+	if t.schema.types == nil {
+		t.schema.types = map[string]iop.ColumnType{}
+	}
+	if change.NewType != "" {
+		t.schema.types[strings.ToLower(change.Column)] = change.NewType
+	}
+
+	msg := change.String()
+	switch change.Policy {
+	case DriftPolicyFail:
+		return g.Error("schema drift detected: %s", msg)
+	case DriftPolicyWarn:
+		t.warn("schema drift detected: %s", msg)
+	case DriftPolicyQuarantine:
+		if !t.schema.quarantined {
+			t.warn("schema drift detected: %s. Stream will be quarantined.", msg)
+		}
+		t.schema.quarantined = true
+	default:
+		g.Debug("schema change: %s", msg)
+	}
+
+	return nil
+}
+
+// String returns a description of the change
+func (sc SchemaChange) String() string {
+	switch sc.Kind {
+	case SchemaChangeAdded:
+		return g.F("column %s (%s) was added", sc.Column, sc.NewType)
+	case SchemaChangeRemoved:
+		return g.F("column %s (%s) was removed", sc.Column, sc.OldType)
+	case SchemaChangeRetyped:
+		return g.F("column %s changed type from %s to %s", sc.Column, sc.OldType, sc.NewType)
+	}
+	return g.F("column %s changed", sc.Column)
+}
+
+// checkSchemaDrift compares the stream columns with the declared
+// contract columns, or the existing target table columns.
+// Nothing is checked without a schema contract.
+func (t *TaskExecution) checkSchemaDrift(tgtConn database.Connection, targetTable database.Table, columns iop.Columns) (err error) {
+	contract := t.Config.Target.Options.SchemaContract
+	if contract == nil {
+		return nil
+	}
+
+	var expected iop.Columns
+	if contract.Columns != nil {
+		expected = iop.NewColumns(castColumns(contract.Columns)...)
+	} else {
+		exists, err := database.TableExists(tgtConn, targetTable.FullName())
+		if err != nil {
+			return g.Error(err, "could not check table existence for %s", targetTable.FullName())
+		} else if !exists {
+			return nil
+		}
+
+		expected, err = tgtConn.GetColumns(targetTable.FullName())
+		if err != nil {
+			return g.Error(err, "could not get column list for %s", targetTable.FullName())
+		}
+	}
+
+	t.schema.mux.Lock()
+	t.schema.types = map[string]iop.ColumnType{}
+	for _, col := range expected {
+		t.schema.types[strings.ToLower(col.Name)] = col.Type
+	}
+	t.schema.mux.Unlock()
+
+	// merge onto a copy, to determine the added columns
+	_, added, _ := append(iop.Columns{}, expected...).Merge(columns, false)
+	for _, col := range added.AddedCols {
+		if isSlingMetadataColumn(col) {
+			continue
+		}
+		change := SchemaChange{Kind: SchemaChangeAdded, Column: col.Name, NewType: col.Type}
+		if err = t.addSchemaChange(change); err != nil {
+			return err
+		}
+	}
+
+	colMap := columns.FieldMap(true)
+	for _, expCol := range expected {
+		i, found := colMap[strings.ToLower(expCol.Name)]
+		if !found {
+			if isSlingMetadataColumn(expCol) {
+				continue
+			}
+			change := SchemaChange{Kind: SchemaChangeRemoved, Column: expCol.Name, OldType: expCol.Type}
+			if err = t.addSchemaChange(change); err != nil {
+				return err
+			}
+			continue
+		}
+
+		col := columns[i]
+		if col.Stats.TotalCnt > 0 && col.Stats.TotalCnt == col.Stats.NullCnt {
+			continue // all nulls, type is not meaningful
+		}
+		if !columnTypeFits(expCol.Type, col.Type) {
+			change := SchemaChange{Kind: SchemaChangeRetyped, Column: col.Name, OldType: expCol.Type, NewType: col.Type}
+			if err = t.addSchemaChange(change); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setSchemaChangeHooks wraps the dataflow OnColumnAdded / OnColumnChanged
+// hooks, to record the changes occurring while streaming
+func (t *TaskExecution) setSchemaChangeHooks(df *iop.Dataflow) {
+	if onColumnAdded := df.OnColumnAdded; onColumnAdded != nil {
+		df.OnColumnAdded = func(col iop.Column) error {
+			change := SchemaChange{Kind: SchemaChangeAdded, Column: col.Name, NewType: col.Type}
+			if err := t.addSchemaChange(change); err != nil {
+				return err
+			}
+			return onColumnAdded(col)
+		}
+	}
+
+	onColumnChanged := df.OnColumnChanged
+	if onColumnChanged == nil && t.Config.Target.Options.SchemaContract == nil {
+		return
+	}
+
+	df.OnColumnChanged = func(col iop.Column) error {
+		t.schema.mux.Lock()
+		oldType := t.schema.types[strings.ToLower(col.Name)]
+		t.schema.mux.Unlock()
+
+		if oldType == "" || !columnTypeFits(oldType, col.Type) {
+			change := SchemaChange{Kind: SchemaChangeRetyped, Column: col.Name, OldType: oldType, NewType: col.Type}
+			if err := t.addSchemaChange(change); err != nil {
+				return err
+			}
+		}
+
+		if onColumnChanged != nil {
+			return onColumnChanged(col)
+		}
+		return nil
+	}
+}
+
+// quarantineTempTable loads the temp table data into the quarantine table,
+// instead of the target table
+func (t *TaskExecution) quarantineTempTable(tgtConn database.Connection, targetTable database.Table, df *iop.Dataflow) (err error) {
+	suffix := lo.Ternary(tgtConn.GetType().DBNameUpperCase(), "_QUARANTINE", "_quarantine")
+	quarantineTable := targetTable
+	if g.In(tgtConn.GetType(), dbio.TypeDbOracle) && len(quarantineTable.Name) > 19 {
+		quarantineTable.Name = quarantineTable.Name[:19] // max is 30 chars
+	}
+	quarantineTable.Name = quarantineTable.Name + suffix
+	quarantineTable.DDL = ""
+
+	err = tgtConn.DropTable(quarantineTable.FullName())
+	if err != nil {
+		return g.Error(err, "could not drop table %s", quarantineTable.FullName())
+	}
+
+	sample := iop.NewDataset(df.Columns)
+	sample.Rows = df.Buffer
+	sample.Inferred = true
+	_, err = createTableIfNotExists(tgtConn, sample, &quarantineTable)
+	if err != nil {
+		return g.Error(err, "could not create table %s", quarantineTable.FullName())
+	}
+
+	cfg := *t.Config
+	cfg.Target.Object = quarantineTable.FullName()
+	cfg.Target.columns = nil
+	err = insertFromTemp(&cfg, tgtConn)
+	if err != nil {
+		return g.Error(err, "could not insert into quarantine table %s", quarantineTable.FullName())
+	}
+
+	t.warn("stream was quarantined into %s due to schema drift. Target table %s was not modified.", quarantineTable.FullName(), targetTable.FullName())
+	return nil
+}
+
+// printSchemaChanges prints the schema changes detected
+func (t *TaskExecution) printSchemaChanges() {
+	changes := t.SchemaChanges()
+	if len(changes) == 0 {
+		return
+	}
+
+	rows := lo.Map(changes, func(c SchemaChange, i int) []any {
+		return []any{c.Stream, c.Column, c.Kind, c.OldType, c.NewType, c.Policy}
+	})
+	env.Println("")
+	env.Println(g.F("Schema changes for %s:", t.Config.StreamName))
+	env.Println(g.PrettyTable([]string{"Stream", "Column", "Change", "Old Type", "New Type", "Policy"}, rows))
+}
+
+// columnTypeFits returns true if values of the actual type can
+// be loaded into a column of the expected type without loss
+func columnTypeFits(expected, actual iop.ColumnType) bool {
+	switch {
+	case expected == actual:
+		return true
+	case expected.IsString():
+		return true // anything can be a string
+	case expected.IsInteger():
+		return actual.IsInteger()
+	case expected.IsNumber():
+		return actual.IsNumber()
+	case expected.IsDatetime():
+		return actual.IsDatetime() || actual.IsDate()
+	case expected.IsDate():
+		return actual.IsDate()
+	case expected.IsBool():
+		return actual.IsBool()
+	case expected.IsJSON():
+		return actual.IsJSON()
+	case expected.IsBinary():
+		return actual.IsBinary()
+	}
+	return false
+}
+
+// isSlingMetadataColumn returns true for the columns added by sling, such
+// as _sling_loaded_at, from the stream metadata or the table column name
+func isSlingMetadataColumn(col iop.Column) bool {
+	if col.Metadata["sling_metadata"] != "" {
+		return true
+	}
+	return g.In(strings.ToLower(col.Name), slingLoadedAtColumn, slingStreamURLColumn, slingRowNumColumn, slingRowIDColumn)
+}
@@ -0,0 +1,62 @@
+package sling
+
+import (
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	warn, quarantine := DriftPolicyWarn, DriftPolicyQuarantine
+	contract := &SchemaContract{
+		Columns:     map[string]any{"id": "bigint", "name": "string", "amount": "decimal", "created": "datetime"},
+		Drift:       &warn,
+		TypeChanges: &quarantine,
+	}
+	assert.NoError(t, contract.Validate())
+	assert.Equal(t, DriftPolicyWarn, contract.Policy(SchemaChangeAdded))
+	assert.Equal(t, DriftPolicyQuarantine, contract.Policy(SchemaChangeRetyped))
+	assert.Equal(t, DriftPolicyAllow, (*SchemaContract)(nil).Policy(SchemaChangeRemoved))
+
+	// nothing is checked without a contract
+	task := &TaskExecution{Config: &Config{StreamName: "test"}}
+	task.Config.Target.Options = &TargetOptions{}
+	assert.NoError(t, task.checkSchemaDrift(nil, database.Table{}, iop.Columns{{Name: "id"}}))
+	assert.Empty(t, task.SchemaChanges())
+
+	task.Config.Target.Options.SchemaContract = contract
+	contract.Columns.(map[string]any)["_sling_loaded_at"] = "datetime" // metadata column, not removed
+
+	stats := iop.ColumnStats{TotalCnt: 10}
+	columns := iop.Columns{
+		{Name: "id", Type: iop.IntegerType, Stats: stats},
+		{Name: "name", Type: iop.IntegerType, Stats: stats}, // fits into string
+		{Name: "amount", Type: iop.StringType, Stats: stats},
+		{Name: "email", Type: iop.StringType, Stats: stats},
+	}
+	err := task.checkSchemaDrift(nil, database.Table{}, columns)
+	assert.NoError(t, err)
+	assert.True(t, task.Quarantined())
+
+	changes := lo.Map(task.SchemaChanges(), func(c SchemaChange, i int) string {
+		return g.F("%s:%s:%s", c.Kind, c.Column, c.Policy)
+	})
+	assert.ElementsMatch(t, []string{
+		"added:email:warn",
+		"removed:created:warn",
+		"retyped:amount:quarantine",
+	}, changes)
+
+	fail := DriftPolicyFail
+	contract.NewColumns = &fail
+	task = &TaskExecution{Config: task.Config}
+	err = task.checkSchemaDrift(nil, database.Table{}, columns)
+	assert.ErrorContains(t, err, "column email (string) was added")
+
+	invalid := DriftPolicy("ignore")
+	assert.Error(t, (&SchemaContract{Drift: &invalid}).Validate())
+}
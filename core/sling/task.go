@@ -1,25 +1,37 @@
 package sling
 
 import (
+	"context"
+	"log/slog"
 	"math"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
+	"github.com/samber/lo"
 	"github.com/segmentio/ksuid"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Set in the store/store.go file for history keeping
 var StoreInsert, StoreUpdate func(t *TaskExecution)
 
+// StateStore saves the executions, such as the local .sling.db
+// (see store.StoreInsert and store.StoreUpdate)
+type StateStore interface {
+	Insert(t *TaskExecution)
+	Update(t *TaskExecution)
+}
+
 // TaskExecution is a sling ELT task run, synonymous to an execution
 type TaskExecution struct {
 	ExecID    string     `json:"exec_id"`
@@ -32,6 +44,7 @@ type TaskExecution struct {
 	Bytes     uint64     `json:"bytes"`
 	Context   *g.Context `json:"-"`
 	Progress  string     `json:"progress"`
+	Attempts  int        `json:"attempts"`
 
 	df            *iop.Dataflow `json:"-"`
 	prevRowCount  uint64
@@ -44,6 +57,31 @@ type TaskExecution struct {
 	PBar           *ProgressBar       `json:"-"`
 	ProcStatsStart g.ProcStats        `json:"-"` // process stats at beginning
 	cleanupFuncs   []func()
+	schema         schemaTracker // schema changes detected
+	stage          string        // the current stage
+	rowsWritten    uint64        // the rows written into the target
+	runStart       time.Time     // when the run of the task type started
+
+	warnings            []string // the warnings logged during the run
+	warningsMux         sync.Mutex
+	stateMux            sync.Mutex // guards the state read by the metrics collector (see metrics.go)
+	incrementalValAfter string     // the incremental value after the write
+
+	// Reported is true if the run is added to a run report, which
+	// needs the incremental value after the write (see report.go)
+	Reported bool `json:"-"`
+
+	// TraceCtx is the context of the parent span, such as the replication's.
+	// When executing, it holds the span of the task (see tracing.go)
+	TraceCtx  context.Context `json:"-"`
+	traceSpan trace.Span
+	stageCtx  context.Context
+	stageSpan trace.Span
+
+	// set by the Client, for the runs of the client only (see client.go)
+	store      StateStore
+	logger     *slog.Logger
+	onProgress func(Progress)
 }
 
 // ExecutionStatus is an execution status object
@@ -72,6 +110,12 @@ func NewExecID() string {
 
 // NewTask creates a Sling task with given configuration
 func NewTask(execID string, cfg *Config) (t *TaskExecution) {
+	return newTask(execID, cfg, true)
+}
+
+// newTask creates the task. The output capture and progress bar are
+// only for the CLI, which runs one task at a time.
+func newTask(execID string, cfg *Config, cli bool) (t *TaskExecution) {
 	if execID == "" {
 		execID = NewExecID()
 	}
@@ -86,22 +130,24 @@ func NewTask(execID string, cfg *Config) (t *TaskExecution) {
 		cleanupFuncs: []func(){},
 	}
 
-	if args := os.Getenv("SLING_CLI_ARGS"); args != "" {
+	if args := os.Getenv("SLING_CLI_ARGS"); args != "" && cli {
 		t.AppendOutput(" -- args: " + args + "\n")
 	}
 
 	// stdErr output
-	go func() {
-		env.StdErrChn = make(chan string, 1000)
+	if cli {
+		go func() {
+			env.StdErrChn = make(chan string, 1000)
 
-		for {
-			if t.EndTime != nil {
-				env.StdErrChn = nil
-				break
+			for {
+				if t.EndTime != nil {
+					env.StdErrChn = nil
+					break
+				}
+				t.AppendOutput(<-env.StdErrChn) // process output
 			}
-			t.AppendOutput(<-env.StdErrChn) // process output
-		}
-	}()
+		}()
+	}
 
 	err := cfg.Prepare()
 	if err != nil {
@@ -115,7 +161,7 @@ func NewTask(execID string, cfg *Config) (t *TaskExecution) {
 		return
 	}
 
-	if ShowProgress {
+	if ShowProgress && cli {
 		// progress bar ticker
 		t.PBar = NewPBar(time.Second)
 		ticker1s := time.NewTicker(1 * time.Second)
@@ -139,7 +185,7 @@ func NewTask(execID string, cfg *Config) (t *TaskExecution) {
 
 				case <-ticker10s.C:
 					// update rows every 10sec
-					StoreUpdate(t)
+					t.storeUpdate()
 				default:
 					time.Sleep(100 * time.Millisecond)
 					if t.PBar.finished || t.df.Err() != nil {
@@ -158,9 +204,15 @@ func NewTask(execID string, cfg *Config) (t *TaskExecution) {
 // SetProgress sets the progress
 func (t *TaskExecution) SetProgress(progressText string, args ...interface{}) {
 	progressText = g.F(progressText, args...)
-	t.ProgressHist = append(t.ProgressHist, progressText)
-	t.Progress = progressText
-	if !t.PBar.started || t.PBar.finished {
+	t.setState(func() {
+		t.ProgressHist = append(t.ProgressHist, progressText)
+		t.Progress = progressText
+	})
+	t.sendProgress()
+	if t.logger != nil {
+		level := lo.Ternary(strings.HasSuffix(progressText, "failed"), slog.LevelError, slog.LevelInfo)
+		t.logger.Log(context.Background(), level, progressText, "exec_id", t.ExecID, "stream", t.streamName())
+	} else if !t.PBar.started || t.PBar.finished {
 		if strings.HasSuffix(progressText, "failed") {
 			progressText = env.RedString(progressText)
 		}
@@ -170,6 +222,43 @@ func (t *TaskExecution) SetProgress(progressText string, args ...interface{}) {
 	}
 }
 
+// warn logs the warning, and keeps it for the run report
+func (t *TaskExecution) warn(text string, args ...interface{}) {
+	text = g.F(text, args...)
+
+	t.warningsMux.Lock()
+	t.warnings = append(t.warnings, text)
+	t.warningsMux.Unlock()
+
+	if t.logger != nil {
+		t.logger.Warn(text, "exec_id", t.ExecID, "stream", t.streamName())
+	} else {
+		g.Warn(text)
+	}
+}
+
+// LogFields returns the fields of the task for the JSON log events
+// (see env.SetLogFields)
+func (t *TaskExecution) LogFields() map[string]any {
+	fields := map[string]any{
+		"exec_id": t.ExecID,
+		"stream":  t.streamName(),
+		"stage":   t.stage,
+		"rows":    t.GetCount(),
+	}
+	if t.Err != nil {
+		fields["error"] = g.ErrMsgSimple(t.Err)
+	}
+	return fields
+}
+
+// Warnings returns the warnings logged during the run
+func (t *TaskExecution) Warnings() []string {
+	t.warningsMux.Lock()
+	defer t.warningsMux.Unlock()
+	return t.warnings
+}
+
 // GetTotalBytes gets the inbound/oubound bytes of the task
 func (t *TaskExecution) GetTotalBytes() (rcBytes, txBytes uint64) {
 	procStatsEnd := g.GetProcStats(os.Getpid())
@@ -221,6 +310,34 @@ func (t *TaskExecution) GetBytes() (inBytes, outBytes uint64) {
 	return
 }
 
+// streamName returns the name of the stream, or the source stream
+func (t *TaskExecution) streamName() string {
+	if t.Config.StreamName != "" {
+		return t.Config.StreamName
+	}
+	return t.Config.Source.Stream
+}
+
+// storeInsert saves the new task with the state store of the client,
+// or with the local .sling.db (see StoreInsert)
+func (t *TaskExecution) storeInsert() {
+	if t.store != nil {
+		t.store.Insert(t)
+	} else if StoreInsert != nil {
+		StoreInsert(t)
+	}
+}
+
+// storeUpdate saves the task with the state store of the client,
+// or with the local .sling.db (see StoreUpdate)
+func (t *TaskExecution) storeUpdate() {
+	if t.store != nil {
+		t.store.Update(t)
+	} else if StoreUpdate != nil {
+		StoreUpdate(t)
+	}
+}
+
 func (t *TaskExecution) AppendOutput(text string) {
 	t.Output = t.Output + text
 }
@@ -381,47 +498,106 @@ func (t *TaskExecution) usingCheckpoint() bool {
 	return t.Config.Source.HasUpdateKey() && t.Config.Mode == IncrementalMode
 }
 
-func (t *TaskExecution) sourceOptionsMap() (options map[string]any) {
-	options = g.M()
-	g.Unmarshal(g.Marshal(t.Config.Source.Options), &options)
-
-	if t.Config.Source.Options.Columns != nil {
-		columns := iop.Columns{}
-		switch colsCasted := t.Config.Source.Options.Columns.(type) {
-		case map[string]any:
-			for colName, colType := range colsCasted {
-				col := iop.Column{
-					Name: colName,
-					Type: iop.ColumnType(cast.ToString(colType)),
-				}
-				columns = append(columns, col)
-			}
-		case map[any]any:
-			for colName, colType := range colsCasted {
-				col := iop.Column{
-					Name: cast.ToString(colName),
-					Type: iop.ColumnType(cast.ToString(colType)),
-				}
-				columns = append(columns, col)
+// castColumns parses the columns input, as a map of name to type,
+// or as a list of column objects
+func castColumns(columnsI any) (columns iop.Columns) {
+	switch colsCasted := columnsI.(type) {
+	case map[string]any:
+		for colName, colType := range colsCasted {
+			col := iop.Column{
+				Name: colName,
+				Type: iop.ColumnType(cast.ToString(colType)),
 			}
-		case []map[string]any:
-			for _, colItem := range colsCasted {
-				col := iop.Column{}
-				g.Unmarshal(g.Marshal(colItem), &col)
-				columns = append(columns, col)
+			columns = append(columns, col)
+		}
+	case map[any]any:
+		for colName, colType := range colsCasted {
+			col := iop.Column{
+				Name: cast.ToString(colName),
+				Type: iop.ColumnType(cast.ToString(colType)),
 			}
+			columns = append(columns, col)
+		}
+	case []map[string]any:
+		for _, colItem := range colsCasted {
+			col := iop.Column{}
+			g.Unmarshal(g.Marshal(colItem), &col)
+			columns = append(columns, col)
+		}
+	case []any:
+		for _, colItem := range colsCasted {
+			col := iop.Column{}
+			g.Unmarshal(g.Marshal(colItem), &col)
+			columns = append(columns, col)
+		}
+	case iop.Columns:
+		columns = colsCasted
+	default:
+		g.Warn("Columns input not handled: %T", columnsI)
+	}
+	return
+}
+
+// castTransforms returns the transforms to apply per column,
+// with key "*" for all columns
+func castTransforms(transforms any) (colTransforms map[string][]string) {
+	colTransforms = map[string][]string{}
+
+	makeTransformArray := func(val any) []string {
+		switch tVal := val.(type) {
 		case []any:
-			for _, colItem := range colsCasted {
-				col := iop.Column{}
-				g.Unmarshal(g.Marshal(colItem), &col)
-				columns = append(columns, col)
+			transformsArray := make([]string, len(tVal))
+			for i := range tVal {
+				transformsArray[i] = cast.ToString(tVal[i])
 			}
-		case iop.Columns:
-			columns = colsCasted
+			return transformsArray
+		case []string:
+			return tVal
 		default:
-			g.Warn("Config.Source.Options.Columns not handled: %T", t.Config.Source.Options.Columns)
+			g.Warn("did not handle transforms value input: %#v", val)
 		}
+		return nil
+	}
 
+	switch tVal := transforms.(type) {
+	case []any, []string:
+		colTransforms["*"] = makeTransformArray(tVal)
+	case map[string]any:
+		for k, v := range tVal {
+			colTransforms[k] = makeTransformArray(v)
+		}
+	case map[any]any:
+		for k, v := range tVal {
+			colTransforms[cast.ToString(k)] = makeTransformArray(v)
+		}
+	case map[string][]string:
+		for k, v := range tVal {
+			colTransforms[k] = makeTransformArray(v)
+		}
+	case map[string][]any:
+		for k, v := range tVal {
+			colTransforms[k] = makeTransformArray(v)
+		}
+	case map[any][]string:
+		for k, v := range tVal {
+			colTransforms[cast.ToString(k)] = makeTransformArray(v)
+		}
+	case map[any][]any:
+		for k, v := range tVal {
+			colTransforms[cast.ToString(k)] = makeTransformArray(v)
+		}
+	default:
+		g.Warn("did not handle transforms input: %#v", transforms)
+	}
+	return
+}
+
+func (t *TaskExecution) sourceOptionsMap() (options map[string]any) {
+	options = g.M()
+	g.Unmarshal(g.Marshal(t.Config.Source.Options), &options)
+
+	if t.Config.Source.Options.Columns != nil {
+		columns := castColumns(t.Config.Source.Options.Columns)
 		// parse length, precision, scale
 		for i := range columns {
 			columns[i].SetLengthPrecisionScale()
@@ -432,54 +608,7 @@ func (t *TaskExecution) sourceOptionsMap() (options map[string]any) {
 	}
 
 	if transforms := t.Config.Source.Options.Transforms; transforms != nil {
-		colTransforms := map[string][]string{}
-
-		makeTransformArray := func(val any) []string {
-			switch tVal := val.(type) {
-			case []any:
-				transformsArray := make([]string, len(tVal))
-				for i := range tVal {
-					transformsArray[i] = cast.ToString(tVal[i])
-				}
-				return transformsArray
-			case []string:
-				return tVal
-			default:
-				g.Warn("did not handle transforms value input: %#v", val)
-			}
-			return nil
-		}
-
-		switch tVal := transforms.(type) {
-		case []any, []string:
-			colTransforms["*"] = makeTransformArray(tVal)
-		case map[string]any:
-			for k, v := range tVal {
-				colTransforms[k] = makeTransformArray(v)
-			}
-		case map[any]any:
-			for k, v := range tVal {
-				colTransforms[cast.ToString(k)] = makeTransformArray(v)
-			}
-		case map[string][]string:
-			for k, v := range tVal {
-				colTransforms[k] = makeTransformArray(v)
-			}
-		case map[string][]any:
-			for k, v := range tVal {
-				colTransforms[k] = makeTransformArray(v)
-			}
-		case map[any][]string:
-			for k, v := range tVal {
-				colTransforms[cast.ToString(k)] = makeTransformArray(v)
-			}
-		case map[any][]any:
-			for k, v := range tVal {
-				colTransforms[cast.ToString(k)] = makeTransformArray(v)
-			}
-		default:
-			g.Warn("did not handle transforms input: %#v", transforms)
-		}
+		colTransforms := castTransforms(transforms)
 
 		for _, transf := range t.Config.Source.Options.extraTransforms {
 			if _, ok := colTransforms["*"]; !ok {
@@ -492,6 +621,16 @@ func (t *TaskExecution) sourceOptionsMap() (options map[string]any) {
 		// set as string so that StreamProcessor parses it
 		options["transforms"] = g.Marshal(colTransforms)
 	}
+
+	// row error handling is set at target, but applied when streaming
+	if tgtOptions := t.Config.Target.Options; tgtOptions != nil {
+		if tgtOptions.OnRowError != nil {
+			options["on_row_error"] = string(*tgtOptions.OnRowError)
+		}
+		if tgtOptions.MaxErrors != nil {
+			options["max_errors"] = *tgtOptions.MaxErrors
+		}
+	}
 	return
 }
 
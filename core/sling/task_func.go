@@ -83,6 +83,42 @@ func createTableIfNotExists(conn database.Connection, data iop.Dataset, table *d
 	return true, nil
 }
 
+// getTempTable returns the temp table to load into before writing to the
+// final table. Sets the temp table name in the target options if not provided
+func getTempTable(cfg *Config, tgtConn database.Connection) (tableTmp database.Table, err error) {
+	if cfg.Target.Options.TableTmp == "" {
+		tableTmp, err = database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+		if err != nil {
+			return tableTmp, g.Error(err, "could not parse object table name")
+		}
+		suffix := lo.Ternary(tgtConn.GetType().DBNameUpperCase(), "_TMP", "_tmp")
+		if g.In(tgtConn.GetType(), dbio.TypeDbOracle) {
+			if len(tableTmp.Name) > 24 {
+				tableTmp.Name = tableTmp.Name[:24] // max is 30 chars
+			}
+
+			// some weird column / commit error, not picking up latest columns
+			suffix2 := g.RandString(g.NumericRunes, 1) + g.RandString(g.AplhanumericRunes, 1)
+			suffix2 = lo.Ternary(
+				tgtConn.GetType().DBNameUpperCase(),
+				strings.ToUpper(suffix2),
+				strings.ToLower(suffix2),
+			)
+			suffix = suffix + suffix2
+		}
+
+		tableTmp.Name = tableTmp.Name + suffix
+		cfg.Target.Options.TableTmp = tableTmp.FullName()
+	} else {
+		tableTmp, err = database.ParseTableName(cfg.Target.Options.TableTmp, tgtConn.GetType())
+		if err != nil {
+			return tableTmp, g.Error(err, "could not parse temp table name")
+		}
+	}
+
+	return
+}
+
 func pullSourceTableColumns(cfg *Config, srcConn database.Connection, table string) (cols iop.Columns, err error) {
 	cfg.Source.columns, err = srcConn.GetColumns(table)
 	if err != nil {
@@ -116,6 +152,23 @@ func pullTargetTempTableColumns(cfg *Config, tgtConn database.Connection, force
 
 func insertFromTemp(cfg *Config, tgtConn database.Connection) (err error) {
 	// insert
+	sql, err := insertFromTempSQL(cfg, tgtConn)
+	if err != nil {
+		return
+	}
+
+	_, err = tgtConn.Exec(sql)
+	if err != nil {
+		err = g.Error(err, "Could not execute SQL: "+sql)
+		return
+	}
+	g.Debug("inserted rows into %s from temp table %s", cfg.Target.Object, cfg.Target.Options.TableTmp)
+	return
+}
+
+// insertFromTempSQL generates the sql to insert from the temp table into
+// the target table
+func insertFromTempSQL(cfg *Config, tgtConn database.Connection) (sql string, err error) {
 	tmpColumns, err := tgtConn.GetColumns(cfg.Target.Options.TableTmp)
 	if err != nil {
 		err = g.Error(err, "could not get column list for "+cfg.Target.Options.TableTmp)
@@ -161,23 +214,21 @@ func insertFromTemp(cfg *Config, tgtConn database.Connection) (err error) {
 		return
 	}
 
-	sql := g.R(
+	sql = g.R(
 		tgtConn.Template().Core["insert_from_table"],
 		"tgt_table", tgtTable.FullName(),
 		"src_table", srcTable.FullName(),
 		"tgt_fields", strings.Join(tgtFields, ", "),
 		"src_fields", strings.Join(srcFields, ", "),
 	)
-	_, err = tgtConn.Exec(sql)
-	if err != nil {
-		err = g.Error(err, "Could not execute SQL: "+sql)
-		return
-	}
-	g.Debug("inserted rows into %s from temp table %s", cfg.Target.Object, cfg.Target.Options.TableTmp)
 	return
 }
 
 func getIncrementalValue(cfg *Config, tgtConn database.Connection, srcConnVarMap map[string]string) (val string, err error) {
+	if tgtConn.GetType() == dbio.TypeDbPrometheus {
+		return "", g.Error("incremental mode is not supported with a prometheus target, use backfill or full-refresh")
+	}
+
 	// get table columns type for table creation if not exists
 	// in order to get max value
 	// does table exists?
@@ -251,8 +302,27 @@ func getIncrementalValue(cfg *Config, tgtConn database.Connection, srcConnVarMap
 	return
 }
 
-func getRate(cnt uint64) string {
-	return humanize.Commaf(math.Round(cast.ToFloat64(cnt) / time.Since(start).Seconds()))
+// setIncrementalValAfter gets the incremental value after the write,
+// for the run report. The target is only queried if the run is reported.
+func (t *TaskExecution) setIncrementalValAfter(tgtConn database.Connection, srcConnVarMap map[string]string) {
+	if !t.usingCheckpoint() || !t.Reported {
+		return
+	} else if t.rowsWritten == 0 {
+		t.incrementalValAfter = t.Config.IncrementalVal
+		return
+	}
+
+	val, err := getIncrementalValue(t.Config, tgtConn, srcConnVarMap)
+	if err != nil {
+		g.Debug("could not get incremental value after write: %s", err.Error())
+		return
+	}
+	t.incrementalValAfter = val
+}
+
+// getRate returns the rows per second since the run started
+func (t *TaskExecution) getRate(cnt uint64) string {
+	return humanize.Commaf(math.Round(cast.ToFloat64(cnt) / time.Since(t.runStart).Seconds()))
 }
 
 // GetSQLText process source sql file / text
@@ -269,6 +339,9 @@ func GetSQLText(sqlStringPath string) (string, error) {
 	return sqlStringPath, nil
 }
 
-func setStage(value string) {
+func (t *TaskExecution) setStage(value string) {
+	t.setState(func() { t.stage = value })
 	env.SetTelVal("stage", value)
+	t.startStageSpan(value)
+	t.sendProgress()
 }
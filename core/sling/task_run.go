@@ -7,6 +7,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	_ "net/http/pprof"
@@ -23,8 +24,8 @@ import (
 // connPool a way to cache connections to that they don't have to reconnect
 // for each replication steps
 var connPool = map[string]database.Connection{}
+var connPoolMux sync.Mutex
 
-var start time.Time
 var slingLoadedAtColumn = "_sling_loaded_at"
 var slingStreamURLColumn = "_sling_stream_url"
 var slingRowNumColumn = "_sling_row_num"
@@ -43,7 +44,11 @@ func init() {
 // Execute runs a Sling task.
 // This may be a file/db to file/db transfer
 func (t *TaskExecution) Execute() error {
-	env.SetLogger()
+	// the logger is set up at init for the client runs, which
+	// do not change the process environment (see Client)
+	if !t.Config.localEnv {
+		env.SetLogger()
+	}
 
 	done := make(chan struct{})
 	now := time.Now()
@@ -61,9 +66,12 @@ func (t *TaskExecution) Execute() error {
 	// set defaults
 	t.Config.SetDefault()
 
+	t.metricsStart()
+	t.startTraceSpan()
+
 	// print for debugging
 	g.Trace("using Config:\n%s", g.Pretty(t.Config))
-	env.SetTelVal("stage", "2 - task-execution")
+	t.setStage("2 - task-execution")
 
 	go func() {
 		defer close(done)
@@ -76,38 +84,55 @@ func (t *TaskExecution) Execute() error {
 			}
 		}()
 
-		t.Status = ExecStatusRunning
+		t.setState(func() { t.Status = ExecStatusRunning })
 
 		if t.Err != nil {
 			return
 		}
 
 		// update into store
-		StoreUpdate(t)
+		t.storeUpdate()
 
 		g.DebugLow("Sling version: %s (%s %s)", core.Version, runtime.GOOS, runtime.GOARCH)
 		g.DebugLow("type is %s", t.Type)
 		g.Debug("using source options: %s", g.Marshal(t.Config.Source.Options))
 		g.Debug("using target options: %s", g.Marshal(t.Config.Target.Options))
 
-		switch t.Type {
-		case DbSQL:
-			t.Err = t.runDbSQL()
-		case FileToDB:
-			t.Err = t.runFileToDB()
-		case DbToDb:
-			t.Err = t.runDbToDb()
-		case DbToFile:
-			t.Err = t.runDbToFile()
-		case FileToFile:
-			t.Err = t.runFileToFile()
-		default:
-			t.SetProgress("task execution configuration is invalid")
-			t.Err = g.Error("Cannot Execute. Task Type is not specified")
+		t.setState(func() { t.Attempts = 1 })
+		for {
+			switch t.Type {
+			case DbSQL:
+				t.Err = t.runDbSQL()
+			case FileToDB:
+				t.Err = t.runFileToDB()
+			case DbToDb:
+				t.Err = t.runDbToDb()
+			case DbToFile:
+				t.Err = t.runDbToFile()
+			case FileToFile:
+				t.Err = t.runFileToFile()
+			default:
+				t.SetProgress("task execution configuration is invalid")
+				t.Err = g.Error("Cannot Execute. Task Type is not specified")
+			}
+
+			// retry if the error is transient, per the retry policy
+			if !t.retry() {
+				break
+			}
+		}
+
+		// write the bad rows, if any
+		if err := t.writeDeadLetter(); err != nil {
+			if t.Err == nil {
+				t.Err = err
+			} else {
+				g.LogError(err)
+			}
 		}
 
 		// update into store
-		StoreUpdate(t)
+		t.storeUpdate()
 	}()
 
 	select {
@@ -127,10 +152,10 @@ func (t *TaskExecution) Execute() error {
 
 	if t.Err == nil {
 		t.SetProgress("execution succeeded")
-		t.Status = ExecStatusSuccess
+		t.setState(func() { t.Status = ExecStatusSuccess })
 	} else {
 		t.SetProgress("execution failed")
-		t.Status = ExecStatusError
+		t.setState(func() { t.Status = ExecStatusError })
 		if err := t.df.Context.Err(); err != nil && err.Error() != t.Err.Error() {
 			eG := g.ErrorGroup{}
 			eG.Add(err)
@@ -142,7 +167,12 @@ func (t *TaskExecution) Execute() error {
 	}
 
 	now2 := time.Now()
-	t.EndTime = &now2
+	t.setState(func() { t.EndTime = &now2 })
+	t.metricsEnd()
+	t.endTraceSpan()
+
+	// show schema changes
+	t.printSchemaChanges()
 
 	// show help text
 	if eh := ErrorHelper(t.Err); eh != "" && !t.Config.ReplicationMode {
@@ -152,7 +182,7 @@ func (t *TaskExecution) Execute() error {
 	}
 
 	// update into store
-	StoreUpdate(t)
+	t.storeUpdate()
 
 	return t.Err
 }
@@ -171,6 +201,8 @@ func (t *TaskExecution) getSrcDBConn(ctx context.Context) (conn database.Connect
 	)
 
 	// look for conn in cache
+	connPoolMux.Lock()
+	defer connPoolMux.Unlock()
 	if conn, ok := connPool[t.Config.SrcConn.Hash()]; ok {
 		return conn, nil
 	}
@@ -196,6 +228,8 @@ func (t *TaskExecution) getSrcDBConn(ctx context.Context) (conn database.Connect
 
 func (t *TaskExecution) getTgtDBConn(ctx context.Context) (conn database.Connection, err error) {
 	// look for conn in cache
+	connPoolMux.Lock()
+	defer connPoolMux.Unlock()
 	if conn, ok := connPool[t.Config.TgtConn.Hash()]; ok {
 		return conn, nil
 	}
@@ -228,7 +262,7 @@ func (t *TaskExecution) getTgtDBConn(ctx context.Context) (conn database.Connect
 
 func (t *TaskExecution) runDbSQL() (err error) {
 
-	start = time.Now()
+	t.runStart = time.Now()
 
 	tgtConn, err := t.getTgtDBConn(t.Context.Ctx)
 	if err != nil {
@@ -264,7 +298,7 @@ func (t *TaskExecution) runDbSQL() (err error) {
 
 func (t *TaskExecution) runDbToFile() (err error) {
 
-	start = time.Now()
+	t.runStart = time.Now()
 
 	srcConn, err := t.getSrcDBConn(t.Context.Ctx)
 	if err != nil {
@@ -285,7 +319,8 @@ func (t *TaskExecution) runDbToFile() (err error) {
 
 	t.SetProgress("reading from source database")
 	defer t.Cleanup()
-	t.df, err = t.ReadFromDB(t.Config, srcConn)
+	df, err := t.ReadFromDB(t.Config, srcConn)
+	t.setState(func() { t.df = df })
 	if err != nil {
 		err = g.Error(err, "Could not ReadFromDB")
 		return
@@ -298,12 +333,13 @@ func (t *TaskExecution) runDbToFile() (err error) {
 		t.SetProgress("writing to target file system (%s)", t.Config.TgtConn.Type)
 	}
 	cnt, err := t.WriteToFile(t.Config, t.df)
+	t.setState(func() { t.rowsWritten = cnt })
 	if err != nil {
 		err = g.Error(err, "Could not WriteToFile")
 		return
 	}
 
-	t.SetProgress("wrote %d rows [%s r/s] to %s", cnt, getRate(cnt), t.getTargetObjectValue())
+	t.SetProgress("wrote %d rows [%s r/s] to %s", cnt, t.getRate(cnt), t.getTargetObjectValue())
 
 	err = t.df.Err()
 	return
@@ -324,7 +360,7 @@ func (t *TaskExecution) runFolderToDB() (err error) {
 
 func (t *TaskExecution) runFileToDB() (err error) {
 
-	start = time.Now()
+	t.runStart = time.Now()
 
 	tgtConn, err := t.getTgtDBConn(t.Context.Ctx)
 	if err != nil {
@@ -361,7 +397,8 @@ func (t *TaskExecution) runFileToDB() (err error) {
 	} else {
 		t.SetProgress("reading from source file system (%s)", t.Config.SrcConn.Type)
 	}
-	t.df, err = t.ReadFromFile(t.Config)
+	df, err := t.ReadFromFile(t.Config)
+	t.setState(func() { t.df = df })
 	if err != nil {
 		if strings.Contains(err.Error(), "Provided 0 files") {
 			if t.usingCheckpoint() && t.Config.IncrementalVal != "" {
@@ -385,13 +422,16 @@ func (t *TaskExecution) runFileToDB() (err error) {
 	t.SetProgress("writing to target database [mode: %s]", t.Config.Mode)
 	defer t.Cleanup()
 	cnt, err := t.WriteToDb(t.Config, t.df, tgtConn)
+	t.setState(func() { t.rowsWritten = cnt })
 	if err != nil {
 		err = g.Error(err, "could not write to database")
 		return
 	}
 
-	elapsed := int(time.Since(start).Seconds())
-	t.SetProgress("inserted %d rows into %s in %d secs [%s r/s]", cnt, t.getTargetObjectValue(), elapsed, getRate(cnt))
+	t.setIncrementalValAfter(tgtConn, map[string]string{})
+
+	elapsed := int(time.Since(t.runStart).Seconds())
+	t.SetProgress("inserted %d rows into %s in %d secs [%s r/s]", cnt, t.getTargetObjectValue(), elapsed, t.getRate(cnt))
 
 	if err != nil {
 		err = g.Error(t.df.Err(), "error in transfer")
@@ -401,14 +441,15 @@ func (t *TaskExecution) runFileToDB() (err error) {
 
 func (t *TaskExecution) runFileToFile() (err error) {
 
-	start = time.Now()
+	t.runStart = time.Now()
 
 	if t.Config.Options.StdIn && t.Config.SrcConn.Type.IsUnknown() {
 		t.SetProgress("reading from stream (stdin)")
 	} else {
 		t.SetProgress("reading from source file system (%s)", t.Config.SrcConn.Type)
 	}
-	t.df, err = t.ReadFromFile(t.Config)
+	df, err := t.ReadFromFile(t.Config)
+	t.setState(func() { t.df = df })
 	if err != nil {
 		if strings.Contains(err.Error(), "Provided 0 files") {
 			if t.usingCheckpoint() && t.Config.IncrementalVal != "" {
@@ -432,12 +473,13 @@ func (t *TaskExecution) runFileToFile() (err error) {
 	}
 	defer t.Cleanup()
 	cnt, err := t.WriteToFile(t.Config, t.df)
+	t.setState(func() { t.rowsWritten = cnt })
 	if err != nil {
 		err = g.Error(err, "Could not WriteToFile")
 		return
 	}
 
-	t.SetProgress("wrote %d rows to %s [%s r/s]", cnt, t.getTargetObjectValue(), getRate(cnt))
+	t.SetProgress("wrote %d rows to %s [%s r/s]", cnt, t.getTargetObjectValue(), t.getRate(cnt))
 
 	if t.df.Err() != nil {
 		err = g.Error(t.df.Err(), "Error in runFileToFile")
@@ -446,7 +488,7 @@ func (t *TaskExecution) runFileToFile() (err error) {
 }
 
 func (t *TaskExecution) runDbToDb() (err error) {
-	start = time.Now()
+	t.runStart = time.Now()
 	if t.Config.Mode == Mode("") {
 		t.Config.Mode = FullRefreshMode
 	}
@@ -501,7 +543,8 @@ func (t *TaskExecution) runDbToDb() (err error) {
 	}
 
 	t.SetProgress("reading from source database")
-	t.df, err = t.ReadFromDB(t.Config, srcConn)
+	df, err := t.ReadFromDB(t.Config, srcConn)
+	t.setState(func() { t.df = df })
 	if err != nil {
 		err = g.Error(err, "Could not ReadFromDB")
 		return
@@ -520,17 +563,20 @@ func (t *TaskExecution) runDbToDb() (err error) {
 	t.SetProgress("writing to target database [mode: %s]", t.Config.Mode)
 	defer t.Cleanup()
 	cnt, err := t.WriteToDb(t.Config, t.df, tgtConn)
+	t.setState(func() { t.rowsWritten = cnt })
 	if err != nil {
 		err = g.Error(err, "Could not WriteToDb")
 		return
 	}
 
+	t.setIncrementalValAfter(tgtConn, srcConn.Template().Variable)
+
 	bytesStr := ""
 	if val := t.GetBytesString(); val != "" {
 		bytesStr = "[" + val + "]"
 	}
-	elapsed := int(time.Since(start).Seconds())
-	t.SetProgress("inserted %d rows into %s in %d secs [%s r/s] %s", cnt, t.getTargetObjectValue(), elapsed, getRate(cnt), bytesStr)
+	elapsed := int(time.Since(t.runStart).Seconds())
+	t.SetProgress("inserted %d rows into %s in %d secs [%s r/s] %s", cnt, t.getTargetObjectValue(), elapsed, t.getRate(cnt), bytesStr)
 
 	if t.df.Err() != nil {
 		err = g.Error(t.df.Err(), "Error running runDbToDb")
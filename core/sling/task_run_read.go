@@ -18,13 +18,45 @@ import (
 // ReadFromDB reads from a source database
 func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df *iop.Dataflow, err error) {
 
-	setStage("3 - prepare-dataflow")
+	t.setStage("3 - prepare-dataflow")
+
+	sTable, err := t.getSourceTable(cfg, srcConn)
+	if err != nil {
+		return t.df, err
+	}
+
+	span := t.startOperationSpan("bulk export", string(srcConn.GetType()), sTable.FullName())
+	df, err = srcConn.BulkExportFlow(sTable)
+	if err != nil {
+		EndSpan(span, err)
+		err = g.Error(err, "Could not BulkExportFlow")
+		return t.df, err
+	}
+
+	// the rows are read lazily, so end the span once the stream is consumed
+	t.AddCleanupTaskFirst(func() { EndSpan(span, df.Err()) })
+
+	err = t.setColumnKeys(df)
+	if err != nil {
+		err = g.Error(err, "Could not set column keys")
+		return t.df, err
+	}
+
+	g.Trace("%#v", df.Columns.Types())
+	t.setStage("3 - dataflow-stream")
+
+	return
+}
+
+// getSourceTable resolves the source table and builds the select query,
+// including the incremental / backfill where clause
+func (t *TaskExecution) getSourceTable(cfg *Config, srcConn database.Connection) (sTable database.Table, err error) {
 
 	selectFieldsStr := "*"
-	sTable, err := database.ParseTableName(cfg.Source.Stream, srcConn.GetType())
+	sTable, err = database.ParseTableName(cfg.Source.Stream, srcConn.GetType())
 	if err != nil {
 		err = g.Error(err, "Could not parse source stream text")
-		return t.df, err
+		return sTable, err
 	} else if sTable.Schema == "" {
 		sTable.Schema = cast.ToString(cfg.Source.Data["schema"])
 	}
@@ -36,7 +68,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		if err != nil {
 			err = g.Error(err, "Could not get getSQLText for: "+cfg.Source.Stream)
 			if sTable.Name == "" {
-				return t.df, err
+				return sTable, err
 			} else {
 				err = nil // don't return error in case the table full name ends with .sql
 			}
@@ -50,7 +82,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 	fMap, err := t.Config.GetFormatMap()
 	if err != nil {
 		err = g.Error(err, "could not get format map for sql")
-		return t.df, err
+		return sTable, err
 	}
 	sTable.SQL = g.Rm(sTable.SQL, fMap)
 
@@ -61,7 +93,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 	sTable.Columns, err = srcConn.GetSQLColumns(st)
 	if err != nil {
 		err = g.Error(err, "Could not get source columns")
-		return t.df, err
+		return sTable, err
 	}
 
 	if len(cfg.Source.Select) > 0 {
@@ -75,7 +107,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 
 		if len(excluded) > 0 {
 			if len(excluded) != len(cfg.Source.Select) {
-				return t.df, g.Error("All specified select columns must be excluded with prefix '-'. Cannot do partial exclude.")
+				return sTable, g.Error("All specified select columns must be excluded with prefix '-'. Cannot do partial exclude.")
 			}
 
 			q := database.GetQualifierQuote(srcConn.GetType())
@@ -90,7 +122,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 			})
 
 			if len(includedCols) == 0 {
-				return t.df, g.Error("All available columns were excluded")
+				return sTable, g.Error("All available columns were excluded")
 			}
 			fields = iop.Columns(includedCols).Names()
 		}
@@ -98,6 +130,12 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		selectFieldsStr = strings.Join(fields, ", ")
 	}
 
+	// PromQL has no where clause, the time range is passed in the query options
+	if srcConn.GetType() == dbio.TypeDbPrometheus {
+		sTable.SQL = t.prometheusQuery(cfg, sTable.SQL)
+		return
+	}
+
 	if t.usingCheckpoint() || t.Config.Mode == BackfillMode {
 		// default true value
 		incrementalWhereCond := "1=1"
@@ -154,7 +192,10 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 			)
 		}
 
-		if sTable.SQL == "" {
+		if t.storageRowRestriction(srcConn, sTable, selectFieldsStr) {
+			// the table is read directly, filtered by the read session
+			srcConn.SetProp("storage_row_restriction", incrementalWhereCond)
+		} else if sTable.SQL == "" {
 			sTable.SQL = g.R(
 				srcConn.GetTemplateValue("core.incremental_select"),
 				"fields", selectFieldsStr,
@@ -165,7 +206,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		} else {
 			if !(strings.Contains(sTable.SQL, "{incremental_where_cond}") || strings.Contains(sTable.SQL, "{incremental_value}")) {
 				err = g.Error("Since using incremental/backfill mode + custom SQL, with an `update_key`, the SQL text needs to contain a placeholder: {incremental_where_cond} or {incremental_value}. See https://docs.slingdata.io for help.")
-				return t.df, err
+				return sTable, err
 			}
 
 			sTable.SQL = g.R(
@@ -189,28 +230,50 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		sTable.SQL = sTable.Select(cfg.Source.Limit(), strings.Split(selectFieldsStr, ",")...)
 	}
 
-	df, err = srcConn.BulkExportFlow(sTable)
-	if err != nil {
-		err = g.Error(err, "Could not BulkExportFlow")
-		return t.df, err
+	return
+}
+
+// storageRowRestriction returns true if the where clause of a table stream
+// is passed as the row restriction of the BigQuery Storage Read API,
+// so that the table is read without running a query
+func (t *TaskExecution) storageRowRestriction(srcConn database.Connection, sTable database.Table, selectFieldsStr string) bool {
+	return srcConn.GetType() == dbio.TypeDbBigQuery &&
+		cast.ToBool(srcConn.GetProp("use_storage_api")) &&
+		!sTable.IsQuery() && selectFieldsStr == "*" && t.Config.Source.Limit() == 0
+}
+
+// prometheusQuery sets the query options (after the `#`) from the mode:
+// incremental resumes after the last loaded timestamp, and backfill
+// queries the range. Large ranges are queried in chunks
+func (t *TaskExecution) prometheusQuery(cfg *Config, query string) string {
+	options := g.M()
+	if parts := strings.Split(query, `#`); len(parts) > 1 {
+		g.Unmarshal(parts[len(parts)-1], &options)
+		query = strings.TrimSpace(strings.Join(parts[:len(parts)-1], `#`))
 	}
 
-	err = t.setColumnKeys(df)
-	if err != nil {
-		err = g.Error(err, "Could not set column keys")
-		return t.df, err
+	if t.usingCheckpoint() && cfg.IncrementalVal != "" {
+		options["after"] = cfg.IncrementalVal
+	} else if t.Config.Mode == BackfillMode {
+		rangeArr := strings.Split(*cfg.Source.Options.Range, ",")
+		options["start"] = strings.TrimSpace(rangeArr[0])
+		options["end"] = strings.TrimSpace(rangeArr[1])
 	}
 
-	g.Trace("%#v", df.Columns.Types())
-	setStage("3 - dataflow-stream")
+	if limit := cfg.Source.Limit(); limit > 0 {
+		options["limit"] = limit
+	}
 
-	return
+	if len(options) == 0 {
+		return query
+	}
+	return query + " # " + g.Marshal(options)
 }
 
 // ReadFromFile reads from a source file
 func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error) {
 
-	setStage("3 - prepare-dataflow")
+	t.setStage("3 - prepare-dataflow")
 
 	// sets metadata
 	metadata := t.setGetMetadata()
@@ -266,7 +329,7 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 	}
 
 	g.Trace("%#v", df.Columns.Types())
-	setStage("3 - dataflow-stream")
+	t.setStage("3 - dataflow-stream")
 
 	return
 }
@@ -10,19 +10,19 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
-	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // WriteToFile writes to a target file
 func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64, err error) {
 	var bw int64
 	defer t.PBar.Finish()
-	setStage("5 - load-into-final")
+	t.setStage("5 - load-into-final")
 
 	if uri := cfg.TgtConn.URL(); uri != "" {
 		dateMap := iop.GetISO8601DateMap(time.Now())
@@ -100,9 +100,9 @@ func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64,
 
 	g.DebugLow(
 		"wrote %s: %d rows [%s r/s]",
-		humanize.Bytes(cast.ToUint64(bw)), cnt, getRate(cnt),
+		humanize.Bytes(cast.ToUint64(bw)), cnt, t.getRate(cnt),
 	)
-	setStage("6 - closing")
+	t.setStage("6 - closing")
 
 	return
 }
@@ -120,6 +120,11 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
+	// prometheus has no tables, the samples are sent directly
+	if tgtConn.GetType() == dbio.TypeDbPrometheus {
+		return t.writeToPrometheus(cfg, df, tgtConn)
+	}
+
 	targetTable, err := database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
 	if err != nil {
 		return 0, g.Error(err, "could not parse object table name")
@@ -134,35 +139,12 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
-	var tableTmp database.Table
-	if cfg.Target.Options.TableTmp == "" {
-		tableTmp, err = database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
-		if err != nil {
-			return 0, g.Error(err, "could not parse object table name")
-		}
-		suffix := lo.Ternary(tgtConn.GetType().DBNameUpperCase(), "_TMP", "_tmp")
-		if g.In(tgtConn.GetType(), dbio.TypeDbOracle) {
-			if len(tableTmp.Name) > 24 {
-				tableTmp.Name = tableTmp.Name[:24] // max is 30 chars
-			}
+	// the temp table uses the default engine, so the staged rows are not merged
+	tgtConn.SetProp("table_engine", "")
 
-			// some weird column / commit error, not picking up latest columns
-			suffix2 := g.RandString(g.NumericRunes, 1) + g.RandString(g.AplhanumericRunes, 1)
-			suffix2 = lo.Ternary(
-				tgtConn.GetType().DBNameUpperCase(),
-				strings.ToUpper(suffix2),
-				strings.ToLower(suffix2),
-			)
-			suffix = suffix + suffix2
-		}
-
-		tableTmp.Name = tableTmp.Name + suffix
-		cfg.Target.Options.TableTmp = tableTmp.FullName()
-	} else {
-		tableTmp, err = database.ParseTableName(cfg.Target.Options.TableTmp, tgtConn.GetType())
-		if err != nil {
-			return 0, g.Error(err, "could not parse temp table name")
-		}
+	tableTmp, err := getTempTable(cfg, tgtConn)
+	if err != nil {
+		return 0, err
 	}
 
 	// set DDL
@@ -174,7 +156,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
-	setStage("4 - prepare-temp")
+	t.setStage("4 - prepare-temp")
 
 	// create schema if not exist
 	_, err = createSchemaIfNotExists(tgtConn, tableTmp.Schema)
@@ -215,6 +197,12 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
+	// check schema drift against contract or existing table
+	err = t.checkSchemaDrift(tgtConn, targetTable, sampleData.Columns)
+	if err != nil {
+		return
+	}
+
 	_, err = createTableIfNotExists(tgtConn, sampleData, &tableTmp)
 	if err != nil {
 		err = g.Error(err, "could not create temp table "+tableTmp.FullName())
@@ -223,10 +211,10 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	cfg.Target.Options.TableDDL = tableTmp.DDL
 	cfg.Target.TmpTableCreated = true
 	df.Columns = sampleData.Columns
-	setStage("4 - load-into-temp")
+	t.setStage("4 - load-into-temp")
 
 	t.AddCleanupTaskFirst(func() {
-		if cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) {
+		if cast.ToBool(cfg.getEnv("SLING_KEEP_TEMP")) {
 			return
 		}
 
@@ -241,10 +229,15 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		conn.Close()
 	})
 
-	err = tgtConn.BeginContext(df.Context.Ctx)
-	if err != nil {
-		err = g.Error(err, "could not open transaction to write to temp table")
-		return
+	// no transaction when isolating bad rows, since a failed
+	// statement aborts the whole transaction in some databases
+	rowErrorMode := cfg.RowErrorMode().Enabled()
+	if !rowErrorMode {
+		err = tgtConn.BeginContext(df.Context.Ctx)
+		if err != nil {
+			err = g.Error(err, "could not open transaction to write to temp table")
+			return
+		}
 	}
 
 	adjustColumnType := cfg.Target.Options.AdjustColumnType != nil && *cfg.Target.Options.AdjustColumnType
@@ -298,11 +291,22 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		}
 	}
 
+	// record schema changes while streaming
+	t.setSchemaChangeHooks(df)
+
+	// set per stream, since the connection can be shared in a replication
+	tgtConn.SetProp("copy_format", cfg.Target.Options.CopyFormat)
+
 	df.Unpause() // to create DDL and set column change functions
 	t.SetProgress("streaming data")
+	span := t.startOperationSpan("bulk import", string(tgtConn.GetType()), tableTmp.FullName())
 	cnt, err = tgtConn.BulkImportFlow(tableTmp.FullName(), df)
+	span.SetAttributes(attribute.Int64("sling.rows", int64(cnt)))
+	EndSpan(span, err)
 	if err != nil {
-		tgtConn.Rollback()
+		if !rowErrorMode {
+			tgtConn.Rollback()
+		}
 		if cast.ToBool(os.Getenv("SLING_CLI")) && cfg.sourceIsFile() {
 			err = g.Error(err, "could not insert into %s.", tableTmp.FullName())
 		} else {
@@ -311,7 +315,9 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
-	tgtConn.Commit()
+	if !rowErrorMode {
+		tgtConn.Commit()
+	}
 	t.PBar.Finish()
 
 	tCnt, _ := tgtConn.GetCount(tableTmp.FullName())
@@ -323,6 +329,12 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return
 	}
 
+	// leave target table untouched if quarantined
+	if t.Quarantined() {
+		err = t.quarantineTempTable(tgtConn, targetTable, df)
+		return
+	}
+
 	// pre SQL
 	if preSQL := cfg.Target.Options.PreSQL; preSQL != "" {
 		t.SetProgress("executing pre-sql")
@@ -345,8 +357,8 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		}
 	}
 
-	if cnt == 0 && !cast.ToBool(os.Getenv("SLING_ALLOW_EMPTY_TABLES")) {
-		g.Warn("No data or records found in stream. Nothing to do. To allow Sling to create empty tables, set SLING_ALLOW_EMPTY_TABLES=TRUE")
+	if cnt == 0 && !cast.ToBool(cfg.getEnv("SLING_ALLOW_EMPTY_TABLES")) {
+		t.warn("No data or records found in stream. Nothing to do. To allow Sling to create empty tables, set SLING_ALLOW_EMPTY_TABLES=TRUE")
 		return
 	} else if cnt > 0 {
 		// FIXME: find root cause of why columns don't synch while streaming
@@ -360,7 +372,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		if df.Count() <= 10000 {
 			err = tgtConn.CompareChecksums(tableTmp.FullName(), df.Columns)
 			if err != nil {
-				if os.Getenv("ERROR_ON_CHECKSUM_FAILURE") != "" {
+				if cfg.getEnv("ERROR_ON_CHECKSUM_FAILURE") != "" {
 					return
 				}
 				g.DebugLow(g.ErrMsgSimple(err))
@@ -383,7 +395,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	}
 
 	defer tgtConn.Rollback() // rollback in case of error
-	setStage("5 - prepare-final")
+	t.setStage("5 - prepare-final")
 
 	{
 		if cfg.Mode == FullRefreshMode {
@@ -400,6 +412,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		sample.Rows = df.Buffer
 		sample.Inferred = true // already inferred with SyncStats
 
+		tgtConn.SetProp("table_engine", cfg.Target.Options.TableEngine)
 		created, err := createTableIfNotExists(tgtConn, sample, &targetTable)
 		if err != nil {
 			err = g.Error(err, "could not create table "+targetTable.FullName())
@@ -452,7 +465,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	}
 
 	// Put data from tmp to final
-	setStage("5 - load-into-final")
+	t.setStage("5 - load-into-final")
 	if cnt == 0 {
 		t.SetProgress("0 rows inserted. Nothing to do.")
 	} else if cfg.Mode == "drop (need to optimize temp table in place)" {
@@ -496,7 +509,10 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		// create final if not exists
 		// delete from final and insert
 		// or update (such as merge or ON CONFLICT)
+		span := t.startOperationSpan("upsert", string(tgtConn.GetType()), targetTable.FullName())
 		rowAffCnt, err := tgtConn.Upsert(tableTmp.FullName(), targetTable.FullName(), cfg.Source.PrimaryKey())
+		span.SetAttributes(attribute.Int64("sling.rows", rowAffCnt))
+		EndSpan(span, err)
 		if err != nil {
 			err = g.Error(err, "Could not incremental from temp")
 			// data is still in temp table at this point
@@ -538,7 +554,28 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	}
 
 	err = df.Err()
-	setStage("6 - closing")
+	t.setStage("6 - closing")
 
 	return
 }
+
+// writeToPrometheus sends the rows as samples to the remote-write endpoint
+// of the target, mapped with the remote_write target options
+func (t *TaskExecution) writeToPrometheus(cfg *Config, df *iop.Dataflow, tgtConn database.Connection) (cnt uint64, err error) {
+	t.setStage("5 - load-into-final")
+
+	for k, v := range cfg.Target.Options.RemoteWrite.Props() {
+		tgtConn.SetProp(k, v)
+	}
+
+	span := t.startOperationSpan("remote write", string(tgtConn.GetType()), cfg.Target.Object)
+	cnt, err = tgtConn.BulkImportFlow(cfg.Target.Object, df)
+	span.SetAttributes(attribute.Int64("sling.rows", cast.ToInt64(cnt)))
+	EndSpan(span, err)
+	if err != nil {
+		return cnt, g.Error(err, "could not remote-write into %s", cfg.TgtConn.Info().Name)
+	}
+
+	t.setStage("6 - closing")
+	return cnt, nil
+}
@@ -0,0 +1,165 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans. It is a no-op unless InitTracing is called
+// with an OTLP endpoint configured.
+var tracer = otel.Tracer("github.com/slingdata-io/sling-cli")
+
+// InitTracing sets up the OTLP trace exporter, if the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// variables are set. The returned function flushes the pending spans.
+func InitTracing(ctx context.Context) (shutdown func(), err error) {
+	shutdown = func() {}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return shutdown, g.Error(err, "could not create OTLP trace exporter")
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "sling"
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", core.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer = provider.Tracer("github.com/slingdata-io/sling-cli")
+
+	shutdown = func() {
+		g.LogError(provider.Shutdown(context.Background()), "could not flush trace spans")
+	}
+
+	return shutdown, nil
+}
+
+// TraceParentContext returns the context with the parent span from the
+// TRACEPARENT (and TRACESTATE) variables, so that the spans of an
+// orchestrator (such as Airflow) are linked to sling's
+func TraceParentContext(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	if carrier["traceparent"] == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// StartSpan starts a span, child of the span in the context if any
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan sets the status of the span from the error, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, g.ErrMsgSimple(err))
+	}
+	span.End()
+}
+
+// startTraceSpan starts the span of the task (stream), child of TraceCtx
+func (t *TaskExecution) startTraceSpan() {
+	parent := t.TraceCtx
+	if parent == nil {
+		parent = TraceParentContext(t.Context.Ctx)
+	}
+
+	t.TraceCtx, t.traceSpan = StartSpan(parent, "stream "+t.metricsLabelValues()[0],
+		attribute.String("sling.exec_id", t.ExecID),
+		attribute.String("sling.stream", t.metricsLabelValues()[0]),
+		attribute.String("sling.type", string(t.Type)),
+		attribute.String("sling.mode", string(t.Config.Mode)),
+		attribute.String("sling.source.type", string(t.Config.SrcConn.Type)),
+		attribute.String("sling.target.type", string(t.Config.TgtConn.Type)),
+		attribute.String("sling.target.object", t.Config.Target.Object),
+	)
+}
+
+// endTraceSpan ends the spans of the stage and task, with the counts
+func (t *TaskExecution) endTraceSpan() {
+	t.endStageSpan()
+	if t.traceSpan == nil {
+		return
+	}
+
+	bytesRead, bytesWritten := t.GetBytes()
+	t.traceSpan.SetAttributes(
+		attribute.Int64("sling.rows_read", int64(t.GetCount())),
+		attribute.Int64("sling.rows_written", int64(t.rowsWritten)),
+		attribute.Int64("sling.bytes_read", int64(bytesRead)),
+		attribute.Int64("sling.bytes_written", int64(bytesWritten)),
+		attribute.Int("sling.attempts", t.Attempts),
+		attribute.String("sling.status", string(t.Status)),
+	)
+	EndSpan(t.traceSpan, t.Err)
+}
+
+// startStageSpan ends the span of the previous stage, and starts one for
+// the new stage, such as `4 - load-into-temp`
+func (t *TaskExecution) startStageSpan(stage string) {
+	if t.traceSpan == nil {
+		return
+	}
+	t.endStageSpan()
+
+	name := strings.TrimSpace(stage)
+	if parts := strings.SplitN(stage, " - ", 2); len(parts) == 2 {
+		name = parts[1]
+	}
+	t.stageCtx, t.stageSpan = StartSpan(t.TraceCtx, name, attribute.String("sling.stage", stage))
+}
+
+func (t *TaskExecution) endStageSpan() {
+	if t.stageSpan == nil {
+		return
+	}
+	t.stageSpan.SetAttributes(attribute.Int64("sling.rows", int64(t.GetCount())))
+	t.stageSpan.End()
+	t.stageSpan = nil
+}
+
+// startOperationSpan starts the span of a bulk operation, in the current stage
+func (t *TaskExecution) startOperationSpan(name, dbType, table string) trace.Span {
+	ctx := t.stageCtx
+	if ctx == nil {
+		ctx = t.TraceCtx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	_, span := StartSpan(ctx, name,
+		attribute.String("db.system", dbType),
+		attribute.String("db.sql.table", table),
+	)
+	return span
+}
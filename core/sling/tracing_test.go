@@ -0,0 +1,51 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTaskTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevTracer := tracer
+	tracer = provider.Tracer("test")
+	defer func() { tracer = prevTracer }()
+
+	os.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	defer os.Unsetenv("TRACEPARENT")
+
+	task := &TaskExecution{
+		Config:   &Config{StreamName: "public.tracing_test"},
+		TraceCtx: TraceParentContext(context.Background()),
+		df:       iop.NewDataflow(),
+	}
+
+	task.startTraceSpan()
+	task.setStage("3 - init-connections")
+	task.setStage("4 - load-into-temp")
+	EndSpan(task.startOperationSpan("bulk import", "postgres", "public.tracing_test_tmp"), nil)
+	task.endTraceSpan()
+
+	spans := recorder.Ended()
+	names := lo.Map(spans, func(s sdktrace.ReadOnlySpan, i int) string { return s.Name() })
+	assert.Equal(t, []string{"init-connections", "bulk import", "load-into-temp", "stream public.tracing_test"}, names)
+	if len(spans) != 4 {
+		return
+	}
+
+	streamSpan, stageSpan, opSpan := spans[3], spans[2], spans[1]
+	for _, span := range spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	}
+	assert.Equal(t, "00f067aa0ba902b7", streamSpan.Parent().SpanID().String())
+	assert.Equal(t, streamSpan.SpanContext().SpanID(), stageSpan.Parent().SpanID())
+	assert.Equal(t, stageSpan.SpanContext().SpanID(), opSpan.Parent().SpanID())
+}
@@ -48,6 +48,8 @@ func InitDB() {
 		&Execution{},
 		&Task{},
 		&Replication{},
+		&SchemaChange{},
+		&Job{},
 	}
 
 	for _, table := range allTables {
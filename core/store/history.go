@@ -0,0 +1,250 @@
+package store
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/sling"
+)
+
+// HistoryFilter filters the executions read from the local .sling.db
+type HistoryFilter struct {
+	Stream      string           // stream name, `*` as wildcard
+	Status      sling.ExecStatus // execution status
+	Replication string           // replication file path or md5
+	Since       *time.Time       // started at or after
+	Until       *time.Time       // started before
+	Limit       int              // max number of executions
+}
+
+// StreamStats are the statistics of the executions of a stream
+type StreamStats struct {
+	Stream       string    `json:"stream"`
+	Runs         int       `json:"runs"`
+	Failures     int       `json:"failures"`
+	FailureRate  float64   `json:"failure_rate"`
+	LastStatus   string    `json:"last_status"`
+	LastRows     uint64    `json:"last_rows"`
+	AvgRows      float64   `json:"avg_rows"`
+	LastBytes    uint64    `json:"last_bytes"`
+	AvgBytes     float64   `json:"avg_bytes"`
+	LastDuration float64   `json:"last_duration"` // in seconds
+	AvgDuration  float64   `json:"avg_duration"`  // in seconds
+	Durations    []float64 `json:"durations"`     // of the recent runs, oldest first
+}
+
+// Duration returns the duration of the execution in seconds
+func (e *Execution) Duration() float64 {
+	if e.StartTime == nil || e.EndTime == nil {
+		return 0
+	}
+	return e.EndTime.Sub(*e.StartTime).Seconds()
+}
+
+// ListExecutions returns the executions matching the filter, most recent first
+func ListExecutions(filter HistoryFilter) (execs []Execution, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	query := Db.Order("start_time desc, id desc")
+	if filter.Stream != "" {
+		// the executions saved before the stream column existed
+		// match on the stream name of the task config (see setStreamNames)
+		pattern := strings.ReplaceAll(filter.Stream, "*", "%")
+		taskMD5s := Db.Model(&Task{}).Select("md5").Where(
+			"coalesce(nullif(json_extract(cast(task as text), '$.stream_name'), ''), json_extract(cast(task as text), '$.source.stream')) like ?",
+			pattern,
+		)
+		query = query.Where("stream like ? or (coalesce(stream, '') = '' and task_md5 in (?))", pattern, taskMD5s)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Replication != "" {
+		query = query.Where("replication_md5 = ? or file_path like ?", filter.Replication, "%"+filter.Replication+"%")
+	}
+	if filter.Since != nil {
+		query = query.Where("start_time >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("start_time < ?", *filter.Until)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	err = query.Find(&execs).Error
+	if err != nil {
+		return nil, g.Error(err, "could not select executions from local .sling.db")
+	}
+
+	setStreamNames(execs)
+
+	return
+}
+
+// setStreamNames sets the stream name from the task config, for the
+// executions saved before the stream column existed
+func setStreamNames(execs []Execution) {
+	taskMD5s := lo.Uniq(lo.FilterMap(execs, func(e Execution, i int) (string, bool) {
+		return e.TaskMD5, e.Stream == ""
+	}))
+	if len(taskMD5s) == 0 {
+		return
+	}
+
+	tasks := []Task{}
+	if err := Db.Where("md5 in ?", taskMD5s).Find(&tasks).Error; err != nil {
+		g.DebugLow("could not select tasks from local .sling.db. %s", err.Error())
+		return
+	}
+
+	tasksMap := lo.KeyBy(tasks, func(t Task) string { return t.MD5 })
+	for i, exec := range execs {
+		if task, ok := tasksMap[exec.TaskMD5]; ok && exec.Stream == "" {
+			execs[i].Stream = lo.Ternary(task.Task.StreamName != "", task.Task.StreamName, task.Task.Source.Stream)
+		}
+	}
+}
+
+// GetExecution returns the executions (one per stream) of an exec id,
+// with the task and replication configs
+func GetExecution(execID string) (execs []Execution, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Where("exec_id = ?", execID).Order("id").Find(&execs).Error
+	if err != nil {
+		return nil, g.Error(err, "could not select execution %s from local .sling.db", execID)
+	} else if len(execs) == 0 {
+		return nil, g.Error("execution %s not found", execID)
+	}
+
+	setStreamNames(execs)
+	for i, exec := range execs {
+		task := &Task{}
+		if err = Db.Where("md5 = ?", exec.TaskMD5).First(task).Error; err == nil {
+			execs[i].Task = task
+		}
+
+		if exec.ReplicationMD5 != "" {
+			replication := &Replication{}
+			if err = Db.Where("md5 = ?", exec.ReplicationMD5).First(replication).Error; err == nil {
+				execs[i].Replication = replication
+			}
+		}
+	}
+
+	return execs, nil
+}
+
+// GetFailedStreams returns the streams of a replication execution which
+// failed, were interrupted or did not finish, as well as the (enabled) streams
+// of the replication which were not started, such as when the run aborted.
+// If execID is blank, the last execution of the replication file is used.
+func GetFailedStreams(execID, replicationPath string, replication sling.ReplicationConfig) (lastExecID string, streams []string, err error) {
+	if Db == nil {
+		return "", nil, g.Error("local .sling.db is not available")
+	}
+
+	filePaths := []string{replicationPath}
+	if absPath, err := filepath.Abs(replicationPath); err == nil {
+		filePaths = append(filePaths, absPath)
+	}
+
+	if execID == "" {
+		last := Execution{}
+		err = Db.Where("file_path in ? and replication_md5 != ''", filePaths).
+			Order("start_time desc, id desc").First(&last).Error
+		if err != nil {
+			return "", nil, g.Error(err, "could not find a previous execution of replication %s", replicationPath)
+		}
+		execID = last.ExecID
+	}
+
+	execs, err := GetExecution(execID)
+	if err != nil {
+		return execID, nil, err
+	} else if execs[0].ReplicationMD5 == "" {
+		return execID, nil, g.Error("execution %s is not a replication", execID)
+	} else if filePath := lo.FromPtr(execs[0].FilePath); !g.In(filePath, filePaths...) {
+		return execID, nil, g.Error("execution %s is of replication %s, not %s", execID, filePath, replicationPath)
+	}
+
+	recorded := map[string]bool{}
+	for _, exec := range execs {
+		recorded[replication.Normalize(exec.Stream)] = true
+		if exec.Status.IsFailure() || !exec.Status.IsFinished() {
+			streams = append(streams, exec.Stream)
+		}
+	}
+
+	for _, name := range replication.StreamsOrdered() {
+		if stream := replication.Streams[name]; stream != nil && stream.Disabled {
+			continue
+		} else if !recorded[replication.Normalize(name)] {
+			streams = append(streams, name)
+		}
+	}
+
+	return execID, lo.Uniq(streams), nil
+}
+
+// GetStreamStats returns the statistics per stream of the executions
+// matching the filter. The recent durations are of the last 10 runs.
+func GetStreamStats(filter HistoryFilter) (stats []StreamStats, err error) {
+	filter.Limit = 0
+	execs, err := ListExecutions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	statsMap := map[string]*StreamStats{}
+	for _, exec := range execs {
+		if !exec.Status.IsFinished() {
+			continue
+		}
+
+		// executions are most recent first
+		s, ok := statsMap[exec.Stream]
+		if !ok {
+			s = &StreamStats{
+				Stream:       exec.Stream,
+				LastStatus:   string(exec.Status),
+				LastRows:     exec.Rows,
+				LastBytes:    exec.Bytes,
+				LastDuration: exec.Duration(),
+			}
+			statsMap[exec.Stream] = s
+		}
+
+		s.Runs++
+		if exec.Status.IsFailure() {
+			s.Failures++
+		}
+		s.AvgRows += float64(exec.Rows)
+		s.AvgBytes += float64(exec.Bytes)
+		s.AvgDuration += exec.Duration()
+		if len(s.Durations) < 10 {
+			s.Durations = append([]float64{exec.Duration()}, s.Durations...)
+		}
+	}
+
+	for _, s := range statsMap {
+		s.FailureRate = float64(s.Failures) / float64(s.Runs)
+		s.AvgRows = s.AvgRows / float64(s.Runs)
+		s.AvgBytes = s.AvgBytes / float64(s.Runs)
+		s.AvgDuration = s.AvgDuration / float64(s.Runs)
+		stats = append(stats, *s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Stream < stats[j].Stream })
+
+	return stats, nil
+}
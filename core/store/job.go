@@ -0,0 +1,194 @@
+package store
+
+import (
+	"database/sql/driver"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"gorm.io/gorm"
+)
+
+// JobType is the type of config submitted to `sling serve`
+type JobType string
+
+const (
+	JobTypeTask        JobType = "task"
+	JobTypeReplication JobType = "replication"
+)
+
+// JobStreams are the streams selected to run, for a replication
+type JobStreams []string
+
+// Scan scan value into Jsonb, implements sql.Scanner interface
+func (js *JobStreams) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	return g.JSONScanner(js, value)
+}
+
+// Value return json value, implement driver.Valuer interface
+func (js JobStreams) Value() (driver.Value, error) {
+	return []byte(g.Marshal(js)), nil
+}
+
+// Job is a run submitted to `sling serve`, queued until executed.
+// The executions of its streams share the same exec id.
+type Job struct {
+	// ID auto-increments
+	ID int64 `json:"id,omitempty" gorm:"primaryKey"`
+
+	ExecID string  `json:"exec_id" gorm:"index"`
+	Type   JobType `json:"type"`
+
+	// Config is the task or replication config submitted (YAML or JSON)
+	Config  string     `json:"config,omitempty"`
+	Streams JobStreams `json:"streams,omitempty"`
+
+	Status    sling.ExecStatus `json:"status" gorm:"index"`
+	Err       *string          `json:"error,omitempty"`
+	Output    string           `json:"-"`
+	StartTime *time.Time       `json:"start_time,omitempty"`
+	EndTime   *time.Time       `json:"end_time,omitempty"`
+
+	CreatedDt time.Time `json:"created_dt" gorm:"autoCreateTime"`
+	UpdatedDt time.Time `json:"updated_dt" gorm:"autoUpdateTime"`
+}
+
+// InsertJob queues the job, if the number of queued jobs is under maxQueued.
+// The count and insert are done in a transaction, so that concurrent
+// submissions cannot exceed maxQueued
+func InsertJob(job *Job, maxQueued int) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	return Db.Transaction(func(tx *gorm.DB) error {
+		var queued int64
+		err := tx.Model(&Job{}).Where("status = ?", sling.ExecStatusQueued).Count(&queued).Error
+		if err != nil {
+			return g.Error(err, "could not count queued jobs")
+		} else if maxQueued > 0 && queued >= int64(maxQueued) {
+			return g.Error("job queue is full (%d queued)", queued)
+		}
+
+		job.Status = sling.ExecStatusQueued
+		if err = tx.Create(job).Error; err != nil {
+			return g.Error(err, "could not insert job into local .sling.db")
+		}
+		return nil
+	})
+}
+
+// UpdateJob saves the status, error, output and times of the job
+func UpdateJob(job *Job) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Model(job).Select("status", "err", "output", "start_time", "end_time").Updates(job).Error
+	if err != nil {
+		return g.Error(err, "could not update job %s in local .sling.db", job.ExecID)
+	}
+	return nil
+}
+
+// GetJob returns the job of the exec id
+func GetJob(execID string) (job *Job, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	jobs := []Job{}
+	err = Db.Where("exec_id = ?", execID).Limit(1).Find(&jobs).Error
+	if err != nil {
+		return nil, g.Error(err, "could not select job %s from local .sling.db", execID)
+	} else if len(jobs) == 0 {
+		return nil, g.Error("job %s not found", execID)
+	}
+	return &jobs[0], nil
+}
+
+// ListJobs returns the jobs, most recent first
+func ListJobs(status sling.ExecStatus, limit int) (jobs []Job, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	query := Db.Omit("output").Order("id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err = query.Find(&jobs).Error
+	if err != nil {
+		return nil, g.Error(err, "could not select jobs from local .sling.db")
+	}
+	return jobs, nil
+}
+
+// NextJob sets the oldest queued job as running and returns it, or nil if
+// none is queued
+func NextJob() (job *Job, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	for {
+		jobs := []Job{}
+		err = Db.Where("status = ?", sling.ExecStatusQueued).Order("id").Limit(1).Find(&jobs).Error
+		if err != nil {
+			return nil, g.Error(err, "could not select queued job from local .sling.db")
+		} else if len(jobs) == 0 {
+			return nil, nil
+		}
+
+		// only claim it if not cancelled in the meantime
+		now := time.Now()
+		result := Db.Model(&Job{}).Where("id = ? and status = ?", jobs[0].ID, sling.ExecStatusQueued).
+			Updates(map[string]any{"status": sling.ExecStatusRunning, "start_time": now})
+		if result.Error != nil {
+			return nil, g.Error(result.Error, "could not update job %s in local .sling.db", jobs[0].ExecID)
+		} else if result.RowsAffected == 1 {
+			job = &jobs[0]
+			job.Status = sling.ExecStatusRunning
+			job.StartTime = &now
+			return job, nil
+		}
+	}
+}
+
+// CancelJob sets the job as terminated if it is still queued.
+// Returns false if it is not queued.
+func CancelJob(execID string) (ok bool, err error) {
+	if Db == nil {
+		return false, g.Error("local .sling.db is not available")
+	}
+
+	now := time.Now()
+	result := Db.Model(&Job{}).Where("exec_id = ? and status = ?", execID, sling.ExecStatusQueued).
+		Updates(map[string]any{"status": sling.ExecStatusTerminated, "end_time": now})
+	if result.Error != nil {
+		return false, g.Error(result.Error, "could not cancel job %s in local .sling.db", execID)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// InterruptRunningJobs sets the jobs left running, by a server which
+// stopped, as interrupted
+func InterruptRunningJobs() (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Model(&Job{}).Where("status = ?", sling.ExecStatusRunning).
+		Update("status", sling.ExecStatusInterrupted).Error
+	if err != nil {
+		return g.Error(err, "could not update running jobs in local .sling.db")
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/flarco/g"
 	"github.com/flarco/g/net"
+	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core"
 	"github.com/slingdata-io/sling-cli/core/dbio/connection"
 	"github.com/slingdata-io/sling-cli/core/sling"
@@ -31,6 +32,13 @@ type Execution struct {
 	// Is an MD5 construct:`md5(Source, Target, Stream)`.
 	StreamID string `json:"stream_id,omitempty" sql:"not null" gorm:"index"`
 
+	// Stream is the name of the stream
+	Stream string `json:"stream,omitempty" gorm:"index"`
+
+	// RetryOf is the exec id of the execution which failed, when
+	// running with `--retry-failed`
+	RetryOf string `json:"retry_of,omitempty" gorm:"index"`
+
 	// ConfigMD5 points to config table. not null
 	TaskMD5        string `json:"task_md5,omitempty" sql:"not null" gorm:"index"`
 	ReplicationMD5 string `json:"replication_md5,omitempty" sql:"not null" gorm:"index"`
@@ -41,6 +49,7 @@ type Execution struct {
 	EndTime   *time.Time       `json:"end_time,omitempty" gorm:"index"`
 	Bytes     uint64           `json:"bytes,omitempty"`
 	ExitCode  int              `json:"exit_code,omitempty"`
+	Attempts  int              `json:"attempts,omitempty"`
 	Output    string           `json:"output,omitempty" sql:"default ''"`
 	Rows      uint64           `json:"rows,omitempty"`
 	Pid       int              `json:"pid,omitempty"`
@@ -95,6 +104,25 @@ type Replication struct {
 	UpdatedDt time.Time `json:"updated_dt" gorm:"autoUpdateTime"`
 }
 
+// SchemaChange is a schema change detected during an execution
+type SchemaChange struct {
+	// ID auto-increments
+	ID int64 `json:"id,omitempty" gorm:"primaryKey"`
+
+	ExecID   string `json:"exec_id,omitempty" gorm:"index"`
+	StreamID string `json:"stream_id,omitempty" gorm:"index"`
+
+	Stream  string `json:"stream,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Column  string `json:"column,omitempty"`
+	OldType string `json:"old_type,omitempty"`
+	NewType string `json:"new_type,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+
+	DetectedDt time.Time `json:"detected_dt,omitempty" gorm:"index"`
+	CreatedDt  time.Time `json:"created_dt,omitempty" gorm:"autoCreateTime"`
+}
+
 // Store saves the task into the local sqlite
 func ToExecutionObject(t *sling.TaskExecution) *Execution {
 
@@ -103,15 +131,18 @@ func ToExecutionObject(t *sling.TaskExecution) *Execution {
 	exec := Execution{
 		ExecID:         t.ExecID,
 		StreamID:       g.MD5(t.Config.Source.Conn, t.Config.Target.Conn, t.Config.Source.Stream),
+		Stream:         lo.Ternary(t.Config.StreamName != "", t.Config.StreamName, t.Config.Source.Stream),
 		Status:         t.Status,
 		StartTime:      t.StartTime,
 		EndTime:        t.EndTime,
 		Bytes:          bytes,
 		Output:         t.Output,
 		Rows:           t.GetCount(),
+		Attempts:       t.Attempts,
 		ProjectID:      g.String(t.Config.Env["SLING_PROJECT_ID"]),
 		FilePath:       g.String(t.Config.Env["SLING_CONFIG_PATH"]),
 		ReplicationMD5: os.Getenv("SLING_REPLICATION_MD5"),
+		RetryOf:        os.Getenv("SLING_RETRY_OF"),
 		Pid:            os.Getpid(),
 		Version:        core.Version,
 	}
@@ -249,9 +280,11 @@ func StoreUpdate(t *sling.TaskExecution) {
 	exec.StartTime = e.StartTime
 	exec.EndTime = e.EndTime
 	exec.Status = e.Status
+	clearErr := e.Err == nil && exec.Err != nil // retrying, after a failed attempt
 	exec.Err = e.Err
 	exec.Bytes = e.Bytes
 	exec.Rows = e.Rows
+	exec.Attempts = e.Attempts
 	exec.Output = e.Output
 
 	err = Db.Updates(exec).Error
@@ -260,10 +293,57 @@ func StoreUpdate(t *sling.TaskExecution) {
 		return
 	}
 
+	// clear the error of the previous attempt, since nil is skipped with Updates
+	if clearErr {
+		err = Db.Model(exec).Update("err", nil).Error
+		if err != nil {
+			g.DebugLow("could not clear execution error in local .sling.db. %s", err.Error())
+		}
+	}
+
+	if t.Status.IsFinished() {
+		storeSchemaChanges(t, exec.StreamID)
+	}
+
 	// send status
 	sendStatus(*exec)
 }
 
+// storeSchemaChanges saves the schema changes detected during the execution
+func storeSchemaChanges(t *sling.TaskExecution, streamID string) {
+	changes := t.SchemaChanges()
+	if len(changes) == 0 {
+		return
+	}
+
+	// replace, in case of multiple updates
+	err := Db.Where("exec_id = ? and stream_id = ?", t.ExecID, streamID).Delete(&SchemaChange{}).Error
+	if err != nil {
+		g.DebugLow("could not delete schema changes from local .sling.db. %s", err.Error())
+		return
+	}
+
+	records := make([]SchemaChange, len(changes))
+	for i, change := range changes {
+		records[i] = SchemaChange{
+			ExecID:     t.ExecID,
+			StreamID:   streamID,
+			Stream:     change.Stream,
+			Kind:       string(change.Kind),
+			Column:     change.Column,
+			OldType:    string(change.OldType),
+			NewType:    string(change.NewType),
+			Policy:     string(change.Policy),
+			DetectedDt: change.Time,
+		}
+	}
+
+	err = Db.Create(&records).Error
+	if err != nil {
+		g.DebugLow("could not insert schema changes into local .sling.db. %s", err.Error())
+	}
+}
+
 func sendStatus(exec Execution) {
 	if os.Getenv("SLING_STATUS_URL") == "" {
 		return